@@ -1,13 +1,22 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Client struct {
@@ -29,8 +38,29 @@ type Clienter interface {
 	GetCurrentBlock(ctx context.Context) (int, error)
 	// Subscribe - add address to observer
 	Subscribe(ctx context.Context, address string) error
-	// GetTransactions -  list of inbound or outbound transactions for an address
-	GetTransactions(ctx context.Context, address string) ([]Transaction, error)
+	// Unsubscribe - removes address from observer, returns count of removed transactions if parser purges them
+	Unsubscribe(ctx context.Context, address string) (int, error)
+	// ListSubscriptions - subscriptions ordered by address read after address, returns address to continue
+	// reading with, empty on the last page
+	ListSubscriptions(ctx context.Context, after string, limit int) ([]Subscription, string, error)
+	// GetSubscription - subscription of address with counters of its matched transactions
+	GetSubscription(ctx context.Context, address string) (Subscription, error)
+	// SetWebhook - sets url notified with POST of each transaction matched with address, signed with secret
+	SetWebhook(ctx context.Context, address string, webhook Webhook) error
+	// DelWebhook - removes webhook of address
+	DelWebhook(ctx context.Context, address string) error
+	// GetTransactions -  list of inbound or outbound transactions for an address read from cursor of options
+	// and filtered by options, returns options to continue reading with
+	GetTransactions(ctx context.Context, address string, opts TxOptions) ([]Transaction, TxOptions, error)
+	// AckTransactions - removes transactions read up to cursor, returns count of removed
+	AckTransactions(ctx context.Context, address string, cursor Cursor) (int, error)
+	// GetTransactionByHash - stored records of transaction with subscribers they were matched with
+	GetTransactionByHash(ctx context.Context, hash string) ([]Match, error)
+	// GetTransactionsInRange - stored transactions of all subscribers in blocks range [fromBlock, toBlock]
+	GetTransactionsInRange(ctx context.Context, fromBlock, toBlock int) ([]Match, error)
+	// StreamTransactions - calls handle with each event of transactions matched with addresses till ctx done,
+	// stream end or handle error, stream is resumed after event with lastEventID if it is not empty
+	StreamTransactions(ctx context.Context, addresses []string, lastEventID string, handle func(StreamEvent) error) error
 }
 
 var _ Clienter = (*Client)(nil)
@@ -71,6 +101,171 @@ func (c *Client) Subscribe(ctx context.Context, address string) error {
 	return nil
 }
 
+// Subscription - subscribed address with counters of its matched transactions
+type Subscription struct {
+	Address   string    `json:"address"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Matched - count of transactions matched since subscription, acknowledged and evicted ones included
+	Matched int `json:"matched"`
+	// Stored - count of matched transactions currently stored
+	Stored int `json:"stored"`
+}
+
+type unsubscribeResponse struct {
+	Removed int `json:"removed"`
+}
+
+func (c *Client) Unsubscribe(ctx context.Context, address string) (int, error) {
+	path, err := url.JoinPath("subscriptions", address)
+	if err != nil {
+		return 0, err
+	}
+	body, err := c.do(ctx, http.MethodDelete, path, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err = errors.Join(err, body.Close())
+	}()
+	var resp unsubscribeResponse
+	if err = json.NewDecoder(body).Decode(&resp); err != nil {
+		return 0, err
+	}
+
+	return resp.Removed, nil
+}
+
+func (c *Client) ListSubscriptions(ctx context.Context, after string, limit int) (subs []Subscription, next string, err error) {
+	query := url.Values{}
+	if after != "" {
+		query.Set("after", after)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	resp, err := c.get(ctx, "subscriptions", query)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		err = errors.Join(err, resp.Body.Close())
+	}()
+	if err = json.NewDecoder(resp.Body).Decode(&subs); err != nil {
+		return nil, "", err
+	}
+
+	return subs, resp.Header.Get(nextCursorHeader), nil
+}
+
+func (c *Client) GetSubscription(ctx context.Context, address string) (sub Subscription, err error) {
+	path, err := url.JoinPath("subscriptions", address)
+	if err != nil {
+		return Subscription{}, err
+	}
+	body, err := c.doGET(ctx, path)
+	if err != nil {
+		return Subscription{}, err
+	}
+	defer func() {
+		err = errors.Join(err, body.Close())
+	}()
+	if err = json.NewDecoder(body).Decode(&sub); err != nil {
+		return Subscription{}, err
+	}
+
+	return sub, nil
+}
+
+// Webhook - endpoint of subscription, payloads are signed with secret and verified by VerifyWebhook
+type Webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+func (c *Client) SetWebhook(ctx context.Context, address string, webhook Webhook) error {
+	path, err := url.JoinPath("subscriptions", address, "webhook")
+	if err != nil {
+		return err
+	}
+	body, err := c.do(ctx, http.MethodPut, path, webhook)
+	if err != nil {
+		return err
+	}
+
+	return body.Close()
+}
+
+func (c *Client) DelWebhook(ctx context.Context, address string) error {
+	path, err := url.JoinPath("subscriptions", address, "webhook")
+	if err != nil {
+		return err
+	}
+	body, err := c.do(ctx, http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+
+	return body.Close()
+}
+
+const (
+	webhookIDHeader        = "X-Webhook-Id"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleWebhook     = errors.New("stale webhook timestamp")
+)
+
+// WebhookPayload - body of webhook delivery, ID is the same for repeated deliveries of transaction
+type WebhookPayload struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	// Attempt - number of delivery attempt starting from 1
+	Attempt     int         `json:"attempt"`
+	Transaction Transaction `json:"transaction"`
+	// Removed - transaction was removed from chain by reorganization, alert of its delivery should be retracted
+	Removed bool `json:"removed"`
+}
+
+// VerifyWebhook - checks signature of webhook request body with secret and decodes payload, deliveries
+// with timestamp older than tolerance are rejected to prevent replays, tolerance 0 disables the check
+func VerifyWebhook(header http.Header, body []byte, secret string, tolerance time.Duration) (WebhookPayload, error) {
+	ts := header.Get(webhookTimestampHeader)
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return WebhookPayload{}, errors.Join(ErrInvalidSignature, err)
+	}
+	signature, ok := strings.CutPrefix(header.Get(webhookSignatureHeader), "sha256=")
+	if !ok {
+		return WebhookPayload{}, ErrInvalidSignature
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return WebhookPayload{}, errors.Join(ErrInvalidSignature, err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return WebhookPayload{}, ErrInvalidSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return WebhookPayload{}, ErrStaleWebhook
+	}
+	var payload WebhookPayload
+	if err = json.Unmarshal(body, &payload); err != nil {
+		return WebhookPayload{}, err
+	}
+	if payload.ID != header.Get(webhookIDHeader) {
+		return WebhookPayload{}, ErrInvalidSignature
+	}
+
+	return payload, nil
+}
+
 type Transaction struct {
 	BlockHash        string `json:"blockHash"`
 	BlockNumber      string `json:"blockNumber"`
@@ -86,33 +281,311 @@ type Transaction struct {
 	V                string `json:"v"`
 	R                string `json:"r"`
 	S                string `json:"s"`
+	// receipt fields, set when parser fetches receipts
+	Status            string `json:"status,omitempty"`
+	GasUsed           string `json:"gasUsed,omitempty"`
+	EffectiveGasPrice string `json:"effectiveGasPrice,omitempty"`
+	ContractAddress   string `json:"contractAddress,omitempty"`
+	Logs              []Log  `json:"logs,omitempty"`
+	// Kind - type of matched transfer, empty for top level transaction
+	Kind          string         `json:"kind,omitempty"`
+	TokenTransfer *TokenTransfer `json:"tokenTransfer,omitempty"`
+	// TraceAddress - position of internal call in parent transaction call tree
+	TraceAddress string `json:"traceAddress,omitempty"`
+}
+
+type TokenTransfer struct {
+	Token    string `json:"token"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Amount   string `json:"amount"`
+	LogIndex string `json:"logIndex"`
+}
+
+type Log struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	LogIndex        string   `json:"logIndex"`
+	TransactionHash string   `json:"transactionHash"`
+}
+
+// Cursor - position of transactions read, zero cursor reads all retained transactions
+type Cursor struct {
+	// After - sequence number of the last read transaction
+	After uint64
+}
+
+const (
+	DirectionIn   = "in"
+	DirectionOut  = "out"
+	DirectionSelf = "self"
+
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// TxOptions - cursor and filters of transactions read, zero options read all retained transactions
+type TxOptions struct {
+	Cursor
+	// Before - reads transactions stored before transaction with sequence number, unbounded if 0
+	Before uint64
+	// FromBlock, ToBlock - skips transactions of blocks out of range, ToBlock is unbounded if 0
+	FromBlock int
+	ToBlock   int
+	// Direction - DirectionIn, DirectionOut or DirectionSelf relative to address, any if empty
+	Direction string
+	// MinValue - min transferred value in wei, in token base units for token transfers
+	MinValue *big.Int
+	// Status - StatusSucceeded or StatusFailed, any if empty
+	Status string
+	// Order - OrderAsc or OrderDesc of storing, ascending if empty
+	Order string
+	// Limit - max count of returned transactions, unlimited if 0
+	Limit int
+	// Token - continuation token of the next page, other options are ignored if set
+	Token string
+}
+
+const (
+	nextCursorHeader = "X-Next-Cursor"
+	nextTokenHeader  = "X-Next-Token"
+)
+
+func (o TxOptions) values() url.Values {
+	values := url.Values{}
+	if o.Token != "" {
+		values.Set("token", o.Token)
+
+		return values
+	}
+	for name, value := range map[string]string{
+		"direction": o.Direction,
+		"status":    o.Status,
+		"order":     o.Order,
+	} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	for name, value := range map[string]uint64{
+		"after":     o.After,
+		"before":    o.Before,
+		"fromBlock": uint64(max(o.FromBlock, 0)),
+		"toBlock":   uint64(max(o.ToBlock, 0)),
+		"limit":     uint64(max(o.Limit, 0)),
+	} {
+		if value > 0 {
+			values.Set(name, strconv.FormatUint(value, 10))
+		}
+	}
+	if o.MinValue != nil {
+		values.Set("minValue", o.MinValue.String())
+	}
+
+	return values
 }
 
-func (c *Client) GetTransactions(ctx context.Context, address string) ([]Transaction, error) {
+// GetTransactions - returned options carry cursor of the last read transaction and continuation token
+// of the next page, token is empty if page is not full. Cursor of descending read is the oldest read
+// transaction, so it should not be acknowledged while older transactions are not read
+func (c *Client) GetTransactions(ctx context.Context, address string, opts TxOptions) ([]Transaction, TxOptions, error) {
 	path, err := url.JoinPath("transactions", address)
+	if err != nil {
+		return nil, opts, err
+	}
+	resp, err := c.get(ctx, path, opts.values())
+	if err != nil {
+		return nil, opts, err
+	}
+	defer func() {
+		err = errors.Join(err, resp.Body.Close())
+	}()
+	var txs []Transaction
+	if err = json.NewDecoder(resp.Body).Decode(&txs); err != nil {
+		return nil, opts, err
+	}
+	if next := resp.Header.Get(nextCursorHeader); next != "" {
+		if opts.After, err = strconv.ParseUint(next, 10, 64); err != nil {
+			return nil, opts, err
+		}
+	}
+	opts.Token = resp.Header.Get(nextTokenHeader)
+
+	return txs, opts, nil
+}
+
+type ackRequest struct {
+	UpTo uint64 `json:"upTo"`
+}
+
+type ackResponse struct {
+	Removed int `json:"removed"`
+}
+
+func (c *Client) AckTransactions(ctx context.Context, address string, cursor Cursor) (int, error) {
+	path, err := url.JoinPath("transactions", address, "ack")
+	if err != nil {
+		return 0, err
+	}
+	body, err := c.doPOST(ctx, path, ackRequest{UpTo: cursor.After})
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err = errors.Join(err, body.Close())
+	}()
+	var resp ackResponse
+	if err = json.NewDecoder(body).Decode(&resp); err != nil {
+		return 0, err
+	}
+
+	return resp.Removed, nil
+}
+
+// Match - stored transaction with subscriber address it was matched with
+type Match struct {
+	Address     string      `json:"address"`
+	Transaction Transaction `json:"transaction"`
+}
+
+func (c *Client) GetTransactionByHash(ctx context.Context, hash string) ([]Match, error) {
+	path, err := url.JoinPath("tx", hash)
 	if err != nil {
 		return nil, err
 	}
-	body, err := c.doGET(ctx, path)
+
+	return c.getMatches(ctx, path, nil)
+}
+
+func (c *Client) GetTransactionsInRange(ctx context.Context, fromBlock, toBlock int) ([]Match, error) {
+	return c.getMatches(ctx, "transactions", url.Values{
+		"fromBlock": {strconv.Itoa(fromBlock)},
+		"toBlock":   {strconv.Itoa(toBlock)},
+	})
+}
+
+func (c *Client) getMatches(ctx context.Context, path string, query url.Values) (matches []Match, err error) {
+	resp, err := c.get(ctx, path, query)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
-		err = errors.Join(err, body.Close())
+		err = errors.Join(err, resp.Body.Close())
 	}()
-	var txs []Transaction
-	if err = json.NewDecoder(body).Decode(&txs); err != nil {
+	if err = json.NewDecoder(resp.Body).Decode(&matches); err != nil {
 		return nil, err
 	}
 
-	return txs, nil
+	return matches, nil
+}
+
+// StreamEvent - event of transactions stream
+type StreamEvent struct {
+	// ID - position of stream after event to resume stream with
+	ID string
+	// Gap - transactions of address after resumed position are not kept by stream, they should be read
+	// with GetTransactions, Seq and Transaction are not set
+	Gap         bool
+	Address     string       `json:"address"`
+	Seq         uint64       `json:"seq"`
+	Transaction *Transaction `json:"transaction"`
+	// Removed - transaction of previous event was removed from chain by reorganization and should be retracted
+	Removed bool `json:"removed"`
+}
+
+var (
+	// ErrStreamAborted - parser ended stream with error event, e.g. consumer fell behind
+	ErrStreamAborted = errors.New("stream aborted")
+)
+
+func (c *Client) StreamTransactions(
+	ctx context.Context,
+	addresses []string,
+	lastEventID string,
+	handle func(StreamEvent) error,
+) (err error) {
+	query := url.Values{
+		"address": addresses,
+	}
+	if lastEventID != "" {
+		query.Set("lastEventId", lastEventID)
+	}
+	resp, err := c.get(ctx, "stream/transactions", query)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, resp.Body.Close())
+	}()
+
+	var (
+		reader    = bufio.NewReader(resp.Body)
+		id, event string
+		data      []byte
+	)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value...)
+		case "":
+			// empty line dispatches event, line starting with colon is comment
+			if line != "" || event == "" {
+				continue
+			}
+			streamEvent := StreamEvent{
+				ID:  id,
+				Gap: event == "gap",
+			}
+			if event == "error" {
+				return fmt.Errorf("%w: %s", ErrStreamAborted, data)
+			}
+			if err = json.Unmarshal(data, &streamEvent); err != nil {
+				return err
+			}
+			if err = handle(streamEvent); err != nil {
+				return err
+			}
+			event, data = "", data[:0]
+		}
+	}
 }
 
 func (c *Client) doGET(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := c.get(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
 	requestURL, err := url.JoinPath(c.addr, path)
 	if err != nil {
 		return nil, err
 	}
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
 	if err != nil {
 		return nil, err
@@ -125,7 +598,7 @@ func (c *Client) doGET(ctx context.Context, path string) (io.ReadCloser, error)
 		return nil, handleError(resp)
 	}
 
-	return resp.Body, nil
+	return resp, nil
 }
 func handleError(resp *http.Response) (err error) {
 	defer func() {
@@ -142,15 +615,24 @@ func handleError(resp *http.Response) (err error) {
 	)
 }
 func (c *Client) doPOST(ctx context.Context, path string, body any) (io.ReadCloser, error) {
+	return c.do(ctx, http.MethodPost, path, body)
+}
+
+// do - sends request with body encoded as JSON, request is sent without body if body is nil
+func (c *Client) do(ctx context.Context, method, path string, body any) (io.ReadCloser, error) {
 	requestURL, err := url.JoinPath(c.addr, path)
 	if err != nil {
 		return nil, err
 	}
-	buf := bytes.NewBuffer(nil)
-	if err = json.NewEncoder(buf).Encode(body); err != nil {
-		return nil, err
+	var reqBody io.Reader
+	if body != nil {
+		buf := bytes.NewBuffer(nil)
+		if err = json.NewEncoder(buf).Encode(body); err != nil {
+			return nil, err
+		}
+		reqBody = buf
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, buf)
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reqBody)
 	if err != nil {
 		return nil, err
 	}
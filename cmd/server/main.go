@@ -2,29 +2,94 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/dmitrorezn/tx-parser/internal/domain"
 	"github.com/dmitrorezn/tx-parser/internal/service"
 	ethrpcclient "github.com/dmitrorezn/tx-parser/internal/service/client/eth-client"
 	"github.com/dmitrorezn/tx-parser/internal/service/ports/http"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/file"
 	"github.com/dmitrorezn/tx-parser/internal/service/storage/memory"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/prefilter"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/redisstorage"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/sqlstorage"
 	"github.com/dmitrorezn/tx-parser/pkg/logger"
+	"github.com/dmitrorezn/tx-parser/pkg/redis"
 )
 
 var (
 	addr             = flag.String("addr", "localhost:80", "http server address")
-	ethAddr          = flag.String("eth_addr", "https://ethereum-rpc.publicnode.com", "http server address")
+	ethAddr          = flag.String("eth_addr", "https://ethereum-rpc.publicnode.com", "comma separated JSON-RPC addresses with optional #weight suffix, e.g. https://a,https://b#2")
+	ethMaxLag        = flag.Int("eth_max_lag", 3, "max count of blocks endpoint may lag behind the best endpoint to receive calls")
+	ethTimeout       = flag.Duration("eth_timeout", 10*time.Second, "timeout of single JSON-RPC call attempt")
+	ethRetries       = flag.Int("eth_retries", 3, "max attempts of JSON-RPC call on retryable errors")
+	ethRPS           = flag.Float64("eth_rps", 0, "max JSON-RPC requests per second per endpoint, unlimited if 0")
+	ethProbeInterval = flag.Duration("eth_probe", 15*time.Second, "interval of endpoints health probing")
+	ethWsAddr        = flag.String("eth_ws", "", "websocket JSON-RPC address to process pushed heads, polling only if empty")
+	ethWsIdle        = flag.Duration("eth_ws_idle", time.Minute, "time without pushed head after which websocket is considered silent and redialed")
+	ethWsPoll        = flag.Duration("eth_ws_poll", time.Minute, "interval of polling node while heads are pushed in case push stops without disconnect")
 	fetchTxsInterval = flag.Duration("interval", 10*time.Second, "fetch transactions interval")
 	blockStart       = flag.Int("blockStart", 0, "block from where to start")
 	workers          = flag.Int("workers", 10, "count handle matching workers")
+	reorgDepth       = flag.Int("reorgDepth", 64, "count of recent blocks checked on chain reorganization")
+	confirmations    = flag.Int("confirmations", 0, "count of blocks behind head to wait before processing block")
+	maxBatch         = flag.Int("batch", 1, "max count of blocks processed per interval while catching up chain head")
+	ethBatchSize     = flag.Int("eth_batch", 100, "max count of calls in one JSON-RPC batch request")
+	receipts         = flag.Bool("receipts", true, "fetch receipts to attach status, gas used and logs to transactions")
+	tokens           = flag.Bool("tokens", true, "match ERC-20 Transfer events of receipts with subscribers")
+	tracer           = flag.String("tracer", "", "node tracer to match internal transfers: callTracer or parity, disabled if empty")
+	maxBlockRange    = flag.Int("max_block_range", 1000, "max count of blocks of transactions lookup by block range")
+	unsubscribePurge = flag.Bool("unsubscribe_purge", false, "remove stored transactions of address on unsubscribe, otherwise they are kept for lookups and resubscription")
+	headTag          = flag.String("head", string(domain.BlockTagLatest), "head block to follow: latest, safe or finalized")
+	storageKind      = flag.String("storage", storageMemory, "storage of subscribers, transactions and processed blocks: memory, file, sql or redis")
+	dataDir          = flag.String("data_dir", "data", "directory of file storage")
+	sqlDriver        = flag.String("sql_driver", "sqlite", "database/sql driver of sql storage, pure-Go sqlite driver is linked")
+	sqlDSN           = flag.String("sql_dsn", "tx-parser.db", "data source name of sql storage")
+	redisAddr        = flag.String("redis_addr", "localhost:6379", "address of redis storage")
+	redisPassword    = flag.String("redis_password", "", "password of redis storage")
+	redisDB          = flag.Int("redis_db", 0, "database of redis storage")
+	redisPrefix      = flag.String("redis_prefix", "tx-parser:", "prefix of redis storage keys, distinct per chain or environment sharing redis")
+	retentionTxs     = flag.Int("retention_txs", 0, "max count of retained transactions per address of memory storage, unlimited if 0")
+	retentionBlocks  = flag.Int("retention_blocks", 0, "max age in blocks of retained transactions of memory storage, unlimited if 0")
+	retentionAge     = flag.Duration("retention_age", 0, "max age of retained transactions of memory storage, unlimited if 0")
+	memoryBudget     = flag.Int64("memory_budget", 0, "max estimated bytes of transactions of memory storage, unlimited if 0")
+	compactInterval  = flag.Duration("compact_interval", time.Minute, "interval of memory storage retention compaction")
+	prefilterEnabled = flag.Bool("prefilter", false, "answer lookups of not subscribed addresses from in-process bloom filter before storage")
+	prefilterSubs    = flag.Int("prefilter_subscribers", 100_000, "count of subscribers bloom filter is sized for")
+	prefilterFP      = flag.Float64("prefilter_fp", 0.01, "target false positive rate of bloom filter")
+	prefilterCheck   = flag.Duration("prefilter_check", time.Minute, "interval of bloom filter false positive rate check, filter is rebuilt beyond twice the target")
+	adminToken       = flag.String("admin_token", "", "bearer token of admin snapshot and dead-letter queue endpoints, admin endpoints are disabled if empty")
+	streamBuffer     = flag.Int("stream_buffer", 256, "max count of undelivered events of stream or websocket consumer, consumer is disconnected when it is full")
+	streamReplay     = flag.Int("stream_replay", 64, "count of recent matched transactions kept per listened address to resume streams")
+	streamRetention  = flag.Duration("stream_retention", 5*time.Minute, "time recent matched transactions of address are kept to resume streams after its last stream is gone")
+	wsOrigins        = flag.String("ws_origins", "", "comma separated origins of pages allowed to open websocket besides the same origin, * allows any")
+	streamHeartbeat  = flag.Duration("stream_heartbeat", 15*time.Second, "interval of heartbeat comments of idle streams and websocket pings")
+	webhookAttempts  = flag.Int("webhook_attempts", 8, "count of webhook delivery attempts before delivery is moved to dead-letter queue")
+	webhookBackoff   = flag.Duration("webhook_backoff", 10*time.Second, "delay after the first failed webhook delivery attempt, doubled after each next one")
+	webhookMaxBack   = flag.Duration("webhook_max_backoff", time.Hour, "max delay between webhook delivery attempts")
+	webhookTimeout   = flag.Duration("webhook_timeout", 10*time.Second, "timeout of webhook delivery request")
+)
+
+const (
+	storageMemory = "memory"
+	storageFile   = "file"
+	storageSQL    = "sql"
+	storageRedis  = "redis"
+
+	commandExport = "export"
+	commandImport = "import"
 )
 
 func main() {
@@ -38,26 +103,211 @@ func main() {
 		logger.WithWriter(os.Stdout),
 		logger.WithLevel(slog.LevelDebug),
 	))
-	client, err := ethrpcclient.NewJsonRpcClient(*ethAddr)
+	if tag := domain.BlockTag(*headTag); !tag.Valid() {
+		loggr.Panic(ctx, "head", slog.Any("error", domain.ErrInvalidBlockTag), slog.String("head", *headTag))
+	}
+	if !ethrpcclient.Tracer(*tracer).Valid() {
+		loggr.Panic(ctx, "tracer", slog.String("tracer", *tracer))
+	}
+	// subscribers added by other replicas sharing redis are not in filter of this process,
+	// so their transactions would be skipped
+	if *prefilterEnabled && *storageKind == storageRedis {
+		loggr.Panic(ctx, "prefilter", slog.Any("error", prefilter.ErrSharedBackend), slog.String("storage", *storageKind))
+	}
+	endpoints, err := parseEndpoints(*ethAddr,
+		ethrpcclient.WithMaxBatchSize(*ethBatchSize),
+		ethrpcclient.WithTracer(ethrpcclient.Tracer(*tracer)),
+		ethrpcclient.WithTimeout(*ethTimeout),
+		ethrpcclient.WithRetry(*ethRetries, 100*time.Millisecond, 5*time.Second),
+		ethrpcclient.WithRateLimit(*ethRPS, max(int(*ethRPS), 1)),
+	)
 	if err != nil {
-		loggr.Panic(ctx, "NewJsonRpcClient", slog.Any("error", err))
+		loggr.Panic(ctx, "parseEndpoints", slog.Any("error", err))
+	}
+	client, err := ethrpcclient.NewMultiClient(endpoints, ethrpcclient.WithMaxLag(*ethMaxLag))
+	if err != nil {
+		loggr.Panic(ctx, "NewMultiClient", slog.Any("error", err))
+	}
+	cfgOptions := []service.ConfigOption{
+		service.WithReorgDepth(*reorgDepth),
+		service.WithConfirmations(*confirmations),
+		service.WithHeadTag(domain.BlockTag(*headTag)),
+		service.WithMaxBatch(*maxBatch),
+		service.WithReceipts(*receipts),
+		service.WithTokenTransfers(*tokens),
+		service.WithInternalTransfers(*tracer != ""),
+		service.WithMaxBlockRange(*maxBlockRange),
+		service.WithPurgeOnUnsubscribe(*unsubscribePurge),
+		service.WithStreamBuffer(*streamBuffer),
+		service.WithStreamReplay(*streamReplay),
+		service.WithStreamRetention(*streamRetention),
+		service.WithWebhookRetries(*webhookAttempts, *webhookBackoff, *webhookMaxBack),
+		service.WithWebhookTimeout(*webhookTimeout),
+		service.WithReorgHandler(func(ctx context.Context, reorg service.Reorg) {
+			for _, retracted := range reorg.Retracted {
+				loggr.Info(ctx, "retracted transaction",
+					slog.String("address", string(retracted.Address)),
+					slog.String("hash", retracted.Transaction.Hash),
+					slog.String("block_hash", retracted.Transaction.BlockHash),
+				)
+			}
+		}),
+	}
+	wg := sync.WaitGroup{}
+	if len(endpoints) > 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			client.Run(ctx, *ethProbeInterval)
+		}()
+	}
+	if *ethWsAddr != "" {
+		headsWatcher := ethrpcclient.NewHeadsWatcher(*ethWsAddr, ethrpcclient.WithIdleTimeout(*ethWsIdle))
+		cfgOptions = append(cfgOptions,
+			service.WithHeadsNotifier(headsWatcher),
+			service.WithPushedHeadsPoll(*ethWsPoll),
+		)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			headsWatcher.Run(ctx)
+		}()
 	}
 	var (
-		storage          = memory.NewStorage()
-		blockNumberStore = memory.NewBlockNumberStorage()
-		cfg              = service.NewConfig(*fetchTxsInterval, *workers)
-		svc              = service.NewService(client, blockNumberStore, storage, loggr, cfg)
-		handler          = httpport.NewHandler(svc)
+		storage          service.Storage
+		blockNumberStore service.BlocksStorage
 	)
-	if *blockStart != 0 {
+	switch *storageKind {
+	case storageMemory:
+		memoryStorage := memory.NewStorage(
+			memory.WithRetention(domain.Retention{
+				MaxTxs:    *retentionTxs,
+				MaxBlocks: *retentionBlocks,
+				MaxAge:    *retentionAge,
+			}),
+			memory.WithMemoryBudget(*memoryBudget),
+			memory.WithCompactHandler(func(eviction memory.Eviction) {
+				loggr.Info(ctx, "evicted transactions",
+					slog.Int("by_count", eviction.ByCount),
+					slog.Int("by_blocks", eviction.ByBlocks),
+					slog.Int("by_age", eviction.ByAge),
+					slog.Int("by_memory", eviction.ByMemory),
+				)
+			}),
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			memoryStorage.Run(ctx, *compactInterval)
+		}()
+		storage, blockNumberStore = memoryStorage, memory.NewBlockNumberStorage()
+	case storageFile:
+		fileStorage, err := file.Open(*dataDir)
+		if err != nil {
+			loggr.Panic(ctx, "file.Open", slog.Any("error", err), slog.String("data_dir", *dataDir))
+		}
+		defer func() {
+			if err := fileStorage.Close(); err != nil {
+				loggr.Error(ctx, "file.Close", slog.Any("error", err))
+			}
+		}()
+		storage, blockNumberStore = fileStorage, fileStorage
+	case storageSQL:
+		dsn := *sqlDSN
+		if *sqlDriver == "sqlite" {
+			dsn = sqlstorage.SQLiteDSN(dsn)
+		}
+		db, err := sql.Open(*sqlDriver, dsn)
+		if err != nil {
+			loggr.Panic(ctx, "sql.Open", slog.Any("error", err), slog.String("sql_driver", *sqlDriver))
+		}
+		sqlStorage, err := sqlstorage.New(ctx, db, sqlstorage.WithDialect(sqlstorage.DialectByDriver(*sqlDriver)))
+		if err != nil {
+			loggr.Panic(ctx, "sqlstorage.New", slog.Any("error", err))
+		}
+		defer func() {
+			if err := sqlStorage.Close(); err != nil {
+				loggr.Error(ctx, "sqlstorage.Close", slog.Any("error", err))
+			}
+		}()
+		storage, blockNumberStore = sqlStorage, sqlStorage
+	case storageRedis:
+		redisStorage := redisstorage.New(
+			redis.New(*redisAddr, redis.WithPassword(*redisPassword), redis.WithDB(*redisDB)),
+			redisstorage.WithPrefix(*redisPrefix),
+		)
+		defer func() {
+			if err := redisStorage.Close(); err != nil {
+				loggr.Error(ctx, "redisstorage.Close", slog.Any("error", err))
+			}
+		}()
+		storage, blockNumberStore = redisStorage, redisStorage
+	default:
+		loggr.Panic(ctx, "storage", slog.String("storage", *storageKind))
+	}
+	if *prefilterEnabled {
+		prefiltered, err := prefilter.New(ctx, storage,
+			prefilter.WithExpectedSubscribers(*prefilterSubs),
+			prefilter.WithFalsePositiveRate(*prefilterFP),
+		)
+		if err != nil {
+			loggr.Panic(ctx, "prefilter.New", slog.Any("error", err))
+		}
+		stats := prefiltered.Stats()
+		loggr.Info(ctx, "prefilter built",
+			slog.Int("subscribers", stats.Subscribers),
+			slog.Float64("false_positive_rate", stats.FalsePositiveRate),
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			prefiltered.Run(ctx, *prefilterCheck, func(err error) {
+				stats := prefiltered.Stats()
+				loggr.Info(ctx, "prefilter rebuilt",
+					slog.Any("error", err),
+					slog.Int("subscribers", stats.Subscribers),
+					slog.Int64("filtered", stats.Filtered),
+					slog.Int64("passed", stats.Passed),
+					slog.Float64("false_positive_rate", stats.FalsePositiveRate),
+				)
+			})
+		}()
+		storage = prefiltered
+	}
+	cfg := service.NewConfig(*fetchTxsInterval, *workers, cfgOptions...)
+	var (
+		svc     = service.NewService(client, blockNumberStore, storage, loggr, cfg)
+		handler = httpport.NewHandler(svc,
+			httpport.WithAdminToken(*adminToken),
+			httpport.WithStreamHeartbeat(*streamHeartbeat),
+			httpport.WithWSAllowedOrigins(splitList(*wsOrigins)...),
+		)
+	)
+	// snapshot subcommands run against storage and exit without processing blocks
+	if command := flag.Arg(0); command != "" {
+		if err = runSnapshot(ctx, loggr, svc, *storageKind, command, flag.Arg(1)); err != nil {
+			loggr.Error(ctx, command, slog.Any("error", err))
+		}
+		cancel()
+		wg.Wait()
+
+		return
+	}
+	// restored checkpoint of durable storage takes precedence over start block
+	if *blockStart != 0 && blockNumberStore.GetCurrentBlock() == 0 {
 		blockNumberStore.SetCurrentBlock(*blockStart)
 	}
 	httpServer := &http.Server{
 		Addr:    *addr,
 		Handler: handler,
 	}
-
-	wg := sync.WaitGroup{}
+	// streams are open till closed by server, shutdown waits for them
+	httpServer.RegisterOnShutdown(handler.Close)
 
 	wg.Add(1)
 	go func() {
@@ -66,6 +316,13 @@ func main() {
 		svc.Run(ctx)
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		svc.RunWebhooks(ctx)
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -89,3 +346,96 @@ func main() {
 	loggr.Info(ctx, "Server gracefully stopped")
 	loggr.Info(ctx, "LAST_PROCESSED_BLOCK", slog.Int("NUMBER", blockNumberStore.GetCurrentBlock()))
 }
+
+// runSnapshot - exports snapshot to or imports snapshot from file at path
+func runSnapshot(ctx context.Context, loggr *logger.Logger, svc *service.Service, kind, command, path string) error {
+	if path == "" {
+		return fmt.Errorf("usage: %s [flags] export|import <file>", os.Args[0])
+	}
+	// memory storage of subcommand process is empty on start and lost on exit
+	if kind == storageMemory {
+		return fmt.Errorf("%s requires durable storage, set -storage file, sql or redis", command)
+	}
+	switch command {
+	case commandExport:
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		stats, err := svc.Export(ctx, f)
+		if err = errors.Join(err, f.Close()); err != nil {
+			return err
+		}
+		loggr.Info(ctx, "snapshot exported",
+			slog.String("path", path),
+			slog.Int("subscribers", stats.Subscribers),
+			slog.Int("webhooks", stats.Webhooks),
+			slog.Int("transactions", stats.Transactions),
+		)
+	case commandImport:
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		stats, err := svc.Import(ctx, f)
+		if err != nil {
+			return err
+		}
+		loggr.Info(ctx, "snapshot imported",
+			slog.String("path", path),
+			slog.Int("subscribers", stats.Subscribers),
+			slog.Int("webhooks", stats.Webhooks),
+			slog.Int("transactions", stats.Transactions),
+			slog.Int("duplicates", stats.Duplicates),
+			slog.Int("invalid", stats.Invalid),
+			slog.Int("current_block", stats.CurrentBlock),
+		)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	return nil
+}
+
+// splitList - splits comma separated values skipping empty ones
+func splitList(values string) []string {
+	var result []string
+	for _, value := range strings.Split(values, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+// parseEndpoints - parses comma separated addresses with optional #weight suffix
+func parseEndpoints(addrs string, options ...ethrpcclient.Option) ([]ethrpcclient.Endpoint, error) {
+	var endpoints []ethrpcclient.Endpoint
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		weight := 1
+		if idx := strings.LastIndex(addr, "#"); idx != -1 {
+			w, err := strconv.Atoi(addr[idx+1:])
+			if err != nil {
+				return nil, fmt.Errorf("endpoint %s weight: %w", addr, err)
+			}
+			addr, weight = addr[:idx], w
+		}
+		client, err := ethrpcclient.NewJsonRpcClient(addr, options...)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, ethrpcclient.Endpoint{
+			Name:   addr,
+			Client: client,
+			Weight: weight,
+		})
+	}
+
+	return endpoints, nil
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"errors"
+	"math/big"
 	"strings"
 )
 
@@ -31,15 +32,147 @@ type Transaction struct {
 	V                string  `json:"v"`
 	R                string  `json:"r"`
 	S                string  `json:"s"`
+	// receipt fields, set when receipts fetching is enabled
+	Status            string  `json:"status,omitempty"`
+	GasUsed           string  `json:"gasUsed,omitempty"`
+	EffectiveGasPrice string  `json:"effectiveGasPrice,omitempty"`
+	ContractAddress   Address `json:"contractAddress,omitempty"`
+	Logs              []Log   `json:"logs,omitempty"`
+	// Kind - type of matched transfer, empty for top level transaction
+	Kind          TxKind         `json:"kind,omitempty"`
+	TokenTransfer *TokenTransfer `json:"tokenTransfer,omitempty"`
+	// TraceAddress - position of internal call in parent transaction call tree, e.g. "0-1"
+	TraceAddress string `json:"traceAddress,omitempty"`
+}
+
+// Key - identity of matched record of address, token and internal transfers share hash
+// of their parent transaction and differ by log index or trace address
+func (tx Transaction) Key() string {
+	switch {
+	case tx.Kind == TxKindToken && tx.TokenTransfer != nil:
+		return tx.Hash + ":log:" + tx.TokenTransfer.LogIndex
+	case tx.Kind == TxKindInternal:
+		return tx.Hash + ":trace:" + tx.TraceAddress
+	default:
+		return tx.Hash
+	}
+}
+
+type TxKind string
+
+const (
+	TxKindToken    TxKind = "token"
+	TxKindInternal TxKind = "internal"
+)
+
+// AsInternalTransfer - internal transfer record stored alongside parent transaction,
+// from, to and value are taken from the traced call
+func (tx Transaction) AsInternalTransfer(call Transaction) Transaction {
+	tx.Kind = TxKindInternal
+	tx.From = call.From
+	tx.To = call.To
+	tx.Value = call.Value
+	tx.TraceAddress = call.TraceAddress
+	tx.Input = ""
+	tx.Logs = nil
+
+	return tx
+}
+
+const (
+	TxStatusSuccess = "0x1"
+	TxStatusFailed  = "0x0"
+)
+
+// WithReceipt - returns transaction with execution result from receipt
+func (tx Transaction) WithReceipt(receipt Receipt) Transaction {
+	tx.Status = receipt.Status
+	tx.GasUsed = receipt.GasUsed
+	tx.EffectiveGasPrice = receipt.EffectiveGasPrice
+	tx.ContractAddress = receipt.ContractAddress
+	tx.Logs = receipt.Logs
+
+	return tx
+}
+
+type Receipt struct {
+	TransactionHash   string  `json:"transactionHash"`
+	Status            string  `json:"status"`
+	GasUsed           string  `json:"gasUsed"`
+	EffectiveGasPrice string  `json:"effectiveGasPrice"`
+	ContractAddress   Address `json:"contractAddress"`
+	Logs              []Log   `json:"logs"`
+}
+
+type Log struct {
+	Address         Address  `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	LogIndex        string   `json:"logIndex"`
+	TransactionHash string   `json:"transactionHash"`
+}
+
+// BlockTag - named block of the node used as chain head
+type BlockTag string
+
+const (
+	BlockTagLatest    BlockTag = "latest"
+	BlockTagSafe      BlockTag = "safe"
+	BlockTagFinalized BlockTag = "finalized"
+)
+
+func (t BlockTag) Valid() bool {
+	return t == BlockTagLatest || t == BlockTagSafe || t == BlockTagFinalized
+}
+
+type Block struct {
+	Number       string        `json:"number"`
+	Hash         string        `json:"hash"`
+	ParentHash   string        `json:"parentHash"`
+	Transactions []Transaction `json:"transactions"`
 }
 
 func (tx Transaction) BelongsToAddr(addr Address) bool {
 	return tx.From == addr || tx.To == addr
 }
 
+// Direction - direction of transfer relative to address, token transfers are directed by their event
+func (tx Transaction) Direction(addr Address) Direction {
+	from, to := tx.From, tx.To
+	if tx.Kind == TxKindToken && tx.TokenTransfer != nil {
+		from, to = tx.TokenTransfer.From, tx.TokenTransfer.To
+	}
+	switch out, in := strings.EqualFold(string(from), string(addr)), strings.EqualFold(string(to), string(addr)); {
+	case out && in:
+		return DirectionSelf
+	case out:
+		return DirectionOut
+	default:
+		return DirectionIn
+	}
+}
+
+// TransferValue - transferred value in wei, amount in token base units for token transfers
+func (tx Transaction) TransferValue() (*big.Int, bool) {
+	if tx.Kind == TxKindToken && tx.TokenTransfer != nil {
+		return new(big.Int).SetString(tx.TokenTransfer.Amount, 10)
+	}
+	value := strings.TrimPrefix(tx.Value, addrPrefix)
+	if value == "" {
+		return new(big.Int), true
+	}
+
+	return new(big.Int).SetString(value, 16)
+}
+
 var (
 	ErrAddressNotSubscribed     = errors.New("address not subscribed")
 	ErrAddressAlreadySubscribed = errors.New("address already subscribed")
 	ErrNoTransactions           = errors.New("no transactions")
 	ErrInvalidAddress           = errors.New("invalid address")
+	ErrInvalidBlockTag          = errors.New("invalid block tag")
+	ErrTransactionNotFound      = errors.New("transaction not found")
+	ErrInvalidBlockRange        = errors.New("invalid block range")
+	ErrInvalidSnapshot          = errors.New("invalid snapshot")
+	ErrUnsupportedSnapshot      = errors.New("unsupported snapshot version")
 )
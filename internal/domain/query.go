@@ -0,0 +1,191 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
+)
+
+// TxQuery - cursor and filters of address transactions read, zero query reads all retained transactions.
+// Every stored transaction gets sequence number increasing in order of storing
+type TxQuery struct {
+	// After - reads transactions with sequence number greater than After
+	After uint64 `json:"after,omitempty"`
+	// Before - reads transactions with sequence number less than Before, unbounded if 0
+	Before uint64 `json:"before,omitempty"`
+	// FromBlock, ToBlock - skips transactions of blocks out of range, ToBlock is unbounded if 0
+	FromBlock int `json:"fromBlock,omitempty"`
+	ToBlock   int `json:"toBlock,omitempty"`
+	// Direction - direction of transfer relative to queried address, any if empty
+	Direction Direction `json:"direction,omitempty"`
+	// MinValue - min transferred value in wei, in token base units for token transfers
+	MinValue *big.Int `json:"minValue,omitempty"`
+	// Status - execution result, transactions without receipt status are skipped if set
+	Status TxResult `json:"status,omitempty"`
+	// Order - order of storing transactions are read in, ascending if empty
+	Order TxOrder `json:"order,omitempty"`
+	// Limit - max count of returned transactions, unlimited if 0
+	Limit int `json:"limit,omitempty"`
+}
+
+// Direction - direction of transfer relative to address
+type Direction string
+
+const (
+	DirectionIn   Direction = "in"
+	DirectionOut  Direction = "out"
+	DirectionSelf Direction = "self"
+)
+
+// TxResult - execution result of transaction from its receipt
+type TxResult string
+
+const (
+	TxResultSucceeded TxResult = "succeeded"
+	TxResultFailed    TxResult = "failed"
+)
+
+type TxOrder string
+
+const (
+	TxOrderAsc  TxOrder = "asc"
+	TxOrderDesc TxOrder = "desc"
+)
+
+var (
+	ErrInvalidTxQuery = errors.New("invalid transactions query")
+)
+
+// Validate - checks filters of query
+func (q TxQuery) Validate() error {
+	switch {
+	case q.FromBlock < 0 || q.ToBlock < 0 || q.ToBlock != 0 && q.ToBlock < q.FromBlock:
+		return errors.Join(ErrInvalidTxQuery, ErrInvalidBlockRange)
+	case q.Limit < 0:
+		return errors.Join(ErrInvalidTxQuery, errors.New("negative limit"))
+	case q.MinValue != nil && q.MinValue.Sign() < 0:
+		return errors.Join(ErrInvalidTxQuery, errors.New("negative min value"))
+	}
+	switch q.Direction {
+	case "", DirectionIn, DirectionOut, DirectionSelf:
+	default:
+		return errors.Join(ErrInvalidTxQuery, errors.New("unknown direction "+string(q.Direction)))
+	}
+	switch q.Status {
+	case "", TxResultSucceeded, TxResultFailed:
+	default:
+		return errors.Join(ErrInvalidTxQuery, errors.New("unknown status "+string(q.Status)))
+	}
+	switch q.Order {
+	case "", TxOrderAsc, TxOrderDesc:
+	default:
+		return errors.Join(ErrInvalidTxQuery, errors.New("unknown order "+string(q.Order)))
+	}
+
+	return nil
+}
+
+// Desc - query reads transactions from the newest one
+func (q TxQuery) Desc() bool {
+	return q.Order == TxOrderDesc
+}
+
+// Cursor - cursor of query in query order
+func (q TxQuery) Cursor() uint64 {
+	if q.Desc() {
+		return q.Before
+	}
+
+	return q.After
+}
+
+// HasCursor - query continues read after cursor, including query of continuation token
+func (q TxQuery) HasCursor() bool {
+	return q.After != 0 || q.Before != 0
+}
+
+// InCursor - reports whether sequence number seq is within query cursor bounds
+func (q TxQuery) InCursor(seq uint64) bool {
+	return seq > q.After && (q.Before == 0 || seq < q.Before)
+}
+
+// Matches - reports whether transaction of address with sequence number seq is read by query
+func (q TxQuery) Matches(addr Address, seq uint64, tx Transaction) bool {
+	if !q.InCursor(seq) {
+		return false
+	}
+	if q.FromBlock != 0 || q.ToBlock != 0 {
+		number, err := converter.ParseHexInt(tx.BlockNumber)
+		if err != nil || number < q.FromBlock || q.ToBlock != 0 && number > q.ToBlock {
+			return false
+		}
+	}
+	if q.Direction != "" && tx.Direction(addr) != q.Direction {
+		return false
+	}
+	if q.MinValue != nil {
+		value, ok := tx.TransferValue()
+		if !ok || value.Cmp(q.MinValue) < 0 {
+			return false
+		}
+	}
+	switch q.Status {
+	case TxResultSucceeded:
+		return tx.Status == TxStatusSuccess
+	case TxResultFailed:
+		return tx.Status == TxStatusFailed
+	}
+
+	return true
+}
+
+// Continue - query of the page after transaction with sequence number next in query order
+func (q TxQuery) Continue(next uint64) TxQuery {
+	if q.Desc() {
+		q.Before = next
+	} else {
+		q.After = next
+	}
+
+	return q
+}
+
+// Token - opaque continuation token of query
+func (q TxQuery) Token() string {
+	data, _ := json.Marshal(q)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseTxQueryToken - query of continuation token returned by Token
+func ParseTxQueryToken(token string) (TxQuery, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return TxQuery{}, errors.Join(ErrInvalidTxQuery, err)
+	}
+	var q TxQuery
+	if err = json.Unmarshal(data, &q); err != nil {
+		return TxQuery{}, errors.Join(ErrInvalidTxQuery, err)
+	}
+
+	return q, q.Validate()
+}
+
+// TxPage - transactions read by query in query order
+type TxPage struct {
+	Transactions []Transaction
+	// Next - cursor to continue reading with, sequence number of the last read transaction
+	// or cursor of query if nothing was read
+	Next uint64
+	// NextToken - continuation token of the next page, empty if page is not full, so the last page may be empty
+	NextToken string
+}
+
+// MatchedTx - stored transaction with subscriber address it was matched with
+type MatchedTx struct {
+	Address     Address     `json:"address"`
+	Transaction Transaction `json:"transaction"`
+}
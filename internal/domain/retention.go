@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// Retention - limits of transactions retained for address, zero limit is unlimited.
+// Transactions beyond limits are evicted starting from the oldest one
+type Retention struct {
+	// MaxTxs - max count of retained transactions
+	MaxTxs int `json:"maxTxs,omitempty"`
+	// MaxBlocks - max age of transactions in blocks behind the newest stored block
+	MaxBlocks int `json:"maxBlocks,omitempty"`
+	// MaxAge - max time since transaction was stored
+	MaxAge time.Duration `json:"maxAge,omitempty"`
+}
+
+func (r Retention) Valid() bool {
+	return r.MaxTxs >= 0 && r.MaxBlocks >= 0 && r.MaxAge >= 0
+}
+
+var (
+	ErrInvalidRetention      = errors.New("invalid retention")
+	ErrRetentionNotSupported = errors.New("retention not supported by storage")
+)
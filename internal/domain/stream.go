@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// StreamEvent - transaction matched with address, processed block or reorganization pushed to stream listeners
+type StreamEvent struct {
+	Address Address `json:"address,omitempty"`
+	// Seq - sequence number of matched transactions of address, increasing since hub start
+	Seq         uint64       `json:"seq,omitempty"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+	// Removed - transaction was removed from chain by reorganization, its previous event should be retracted
+	Removed bool `json:"removed,omitempty"`
+	// Block - number of processed block, set for block events only after transactions of block,
+	// common ancestor of reorganization for reorg events
+	Block int `json:"block,omitempty"`
+	// Orphaned - hashes of blocks rolled back to Block from the highest one, set for reorg events only
+	Orphaned []string `json:"orphaned,omitempty"`
+}
+
+// StreamCursor - position of stream of several addresses, sequences are valid in hub epoch only
+type StreamCursor struct {
+	// Epoch - hub instance sequences belong to, sequences of other epoch are not replayed
+	Epoch string
+	// Seqs - sequence of the last received event per address
+	Seqs map[Address]uint64
+}
+
+var (
+	ErrInvalidStreamCursor = errors.New("invalid stream cursor")
+)
+
+// String - cursor formatted as "epoch/address:seq,address:seq" with addresses in ascending order
+func (c StreamCursor) String() string {
+	addrs := make([]Address, 0, len(c.Seqs))
+	for addr := range c.Seqs {
+		addrs = append(addrs, addr)
+	}
+	slices.Sort(addrs)
+
+	var b strings.Builder
+	b.WriteString(c.Epoch)
+	b.WriteByte('/')
+	for i, addr := range addrs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(string(addr))
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(c.Seqs[addr], 10))
+	}
+
+	return b.String()
+}
+
+// ParseStreamCursor - parses cursor formatted by StreamCursor.String
+func ParseStreamCursor(s string) (StreamCursor, error) {
+	epoch, positions, ok := strings.Cut(s, "/")
+	if !ok || epoch == "" {
+		return StreamCursor{}, fmt.Errorf("%w: %s", ErrInvalidStreamCursor, s)
+	}
+	cursor := StreamCursor{
+		Epoch: epoch,
+		Seqs:  make(map[Address]uint64),
+	}
+	if positions == "" {
+		return cursor, nil
+	}
+	for _, position := range strings.Split(positions, ",") {
+		addr, v, ok := strings.Cut(position, ":")
+		if !ok {
+			return StreamCursor{}, fmt.Errorf("%w: %s", ErrInvalidStreamCursor, position)
+		}
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return StreamCursor{}, errors.Join(ErrInvalidStreamCursor, err)
+		}
+		cursor.Seqs[Address(addr)] = seq
+	}
+
+	return cursor, nil
+}
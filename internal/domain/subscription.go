@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// Subscription - subscribed address with counters of its matched transactions
+type Subscription struct {
+	Address   Address   `json:"address"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Matched - count of transactions matched since subscription, acknowledged and evicted ones included
+	Matched int `json:"matched"`
+	// Stored - count of matched transactions currently stored
+	Stored int `json:"stored"`
+}
+
+// SubscriptionQuery - cursor of subscriptions read in order of addresses
+type SubscriptionQuery struct {
+	// After - the last read address, reads from the first address if empty
+	After Address
+	// Limit - max count of returned subscriptions, unlimited if 0
+	Limit int
+}
+
+// SubscriptionPage - subscriptions read by query ordered by address
+type SubscriptionPage struct {
+	Subscriptions []Subscription
+	// Next - cursor to continue reading with, empty if there are no more subscriptions
+	Next Address
+}
+
+// Page - addresses of page read by query from addresses sorted in ascending order and cursor of the next page
+func (q SubscriptionQuery) Page(sorted []Address) ([]Address, Address) {
+	start, _ := slices.BinarySearch(sorted, q.After)
+	if start < len(sorted) && sorted[start] == q.After {
+		start++
+	}
+	page := sorted[start:]
+	if q.Limit <= 0 || len(page) <= q.Limit {
+		return page, ""
+	}
+	page = page[:q.Limit]
+
+	return page, page[len(page)-1]
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"math/big"
+	"strings"
+)
+
+// TransferEventTopic - keccak256 hash of Transfer(address,address,uint256) event signature
+const TransferEventTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+const (
+	topicLen      = len(addrPrefix) + 64
+	transferTopic = 3 // signature, indexed from and indexed to
+)
+
+type TokenTransfer struct {
+	// Token - address of token contract which emitted event
+	Token Address `json:"token"`
+	From  Address `json:"from"`
+	To    Address `json:"to"`
+	// Amount - decimal amount in token base units
+	Amount   string `json:"amount"`
+	LogIndex string `json:"logIndex"`
+}
+
+// DecodeTokenTransfer - decodes ERC-20 Transfer event, ERC-721 transfers with indexed token id are skipped
+func DecodeTokenTransfer(log Log) (TokenTransfer, bool) {
+	if len(log.Topics) != transferTopic || !strings.EqualFold(log.Topics[0], TransferEventTopic) {
+		return TokenTransfer{}, false
+	}
+	from, ok := topicAddress(log.Topics[1])
+	if !ok {
+		return TokenTransfer{}, false
+	}
+	to, ok := topicAddress(log.Topics[2])
+	if !ok {
+		return TokenTransfer{}, false
+	}
+	if len(log.Data) != topicLen {
+		return TokenTransfer{}, false
+	}
+	amount, ok := new(big.Int).SetString(log.Data[len(addrPrefix):], 16)
+	if !ok {
+		return TokenTransfer{}, false
+	}
+
+	return TokenTransfer{
+		Token:    log.Address,
+		From:     from,
+		To:       to,
+		Amount:   amount.String(),
+		LogIndex: log.LogIndex,
+	}, true
+}
+
+// topicAddress - address from 32 bytes left padded topic
+func topicAddress(topic string) (Address, bool) {
+	if len(topic) != topicLen {
+		return "", false
+	}
+
+	return Address(addrPrefix + strings.ToLower(topic[topicLen-(addrLen-len(addrPrefix)):])), true
+}
+
+// TokenTransfers - decoded ERC-20 transfers from transaction receipt logs
+func (tx Transaction) TokenTransfers() []TokenTransfer {
+	var transfers []TokenTransfer
+	for _, log := range tx.Logs {
+		if transfer, ok := DecodeTokenTransfer(log); ok {
+			transfers = append(transfers, transfer)
+		}
+	}
+
+	return transfers
+}
+
+// AsTokenTransfer - token transfer record stored alongside parent transaction
+func (tx Transaction) AsTokenTransfer(transfer TokenTransfer) Transaction {
+	tx.Kind = TxKindToken
+	tx.TokenTransfer = &transfer
+
+	return tx
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Webhook - endpoint notified with signed POST of each transaction matched with subscribed address
+type Webhook struct {
+	URL string `json:"url"`
+	// Secret - key of HMAC-SHA256 signature of delivered payloads
+	Secret string `json:"secret"`
+}
+
+func (w Webhook) Valid() bool {
+	u, err := url.Parse(w.URL)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && w.Secret != ""
+}
+
+// DeliveryStatus - state of webhook delivery, delivered ones are removed
+type DeliveryStatus string
+
+const (
+	// DeliveryPending - delivery is attempted at its next attempt time
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDead - delivery failed all attempts and waits in dead-letter queue to be replayed
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// Delivery - webhook delivery of transaction matched with address
+type Delivery struct {
+	ID          string      `json:"id"`
+	Address     Address     `json:"address"`
+	Transaction Transaction `json:"transaction"`
+	// Removed - transaction was removed from chain by reorganization, delivered one should be retracted
+	Removed   bool           `json:"removed,omitempty"`
+	Status    DeliveryStatus `json:"status"`
+	CreatedAt time.Time      `json:"createdAt"`
+	// NextAttempt - time pending delivery is due at
+	NextAttempt time.Time `json:"nextAttempt"`
+	// Attempts - failed attempts from the first one
+	Attempts []DeliveryAttempt `json:"attempts,omitempty"`
+}
+
+// DeliveryAttempt - result of failed delivery attempt
+type DeliveryAttempt struct {
+	At time.Time `json:"at"`
+	// StatusCode - response status, 0 if request failed without response
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error"`
+}
+
+// DeliveryQuery - cursor of dead deliveries read in order of ids
+type DeliveryQuery struct {
+	// After - id of the last read delivery, reads from the first delivery if empty
+	After string
+	// Limit - max count of returned deliveries, unlimited if 0
+	Limit int
+}
+
+// NewDelivery - pending delivery of address transaction due now, id is the same for repeated matches of record
+// in the same block
+func NewDelivery(addr Address, tx Transaction, now time.Time) Delivery {
+	return newDelivery(addr, tx, false, now)
+}
+
+// NewRemovedDelivery - pending delivery of address transaction removed from chain by reorganization due now
+func NewRemovedDelivery(addr Address, tx Transaction, now time.Time) Delivery {
+	return newDelivery(addr, tx, true, now)
+}
+
+// newDelivery - delivery with id of record in block, so transaction included again after reorganization
+// is delivered once more
+func newDelivery(addr Address, tx Transaction, removed bool, now time.Time) Delivery {
+	id := string(addr) + "/" + tx.BlockHash + "/" + tx.Key()
+	if removed {
+		id += "/removed"
+	}
+	sum := sha256.Sum256([]byte(id))
+
+	return Delivery{
+		ID:          hex.EncodeToString(sum[:16]),
+		Address:     addr,
+		Transaction: tx,
+		Removed:     removed,
+		Status:      DeliveryPending,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+}
+
+var (
+	ErrInvalidWebhook      = errors.New("invalid webhook")
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrDeliveryNotFound    = errors.New("delivery not found")
+	ErrWebhookNotSupported = errors.New("webhooks not supported by storage")
+	ErrDeliveryNotDead     = errors.New("delivery is not dead")
+)
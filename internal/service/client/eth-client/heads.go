@@ -0,0 +1,152 @@
+package ethrpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
+)
+
+const (
+	defaultReconnectDelay    = time.Second
+	defaultMaxReconnectDelay = 30 * time.Second
+	defaultIdleTimeout       = time.Minute
+)
+
+// HeadsWatcher - follows newHeads websocket subscription, reconnects and resubscribes when connection is lost
+type HeadsWatcher struct {
+	addr              string
+	reconnectDelay    time.Duration
+	maxReconnectDelay time.Duration
+	idleTimeout       time.Duration
+
+	heads     chan int
+	connected atomic.Bool
+}
+
+type HeadsWatcherOption func(*HeadsWatcher)
+
+// WithReconnectDelay - initial delay before reconnect, doubled after each failed attempt up to max delay
+func WithReconnectDelay(delay, maxDelay time.Duration) HeadsWatcherOption {
+	return func(w *HeadsWatcher) {
+		w.reconnectDelay = delay
+		w.maxReconnectDelay = max(delay, maxDelay)
+	}
+}
+
+// WithIdleTimeout - time without pushed head after which connection is considered silent and is redialed
+func WithIdleTimeout(timeout time.Duration) HeadsWatcherOption {
+	return func(w *HeadsWatcher) {
+		w.idleTimeout = timeout
+	}
+}
+
+func NewHeadsWatcher(addr string, options ...HeadsWatcherOption) *HeadsWatcher {
+	w := &HeadsWatcher{
+		addr:              addr,
+		reconnectDelay:    defaultReconnectDelay,
+		maxReconnectDelay: defaultMaxReconnectDelay,
+		idleTimeout:       defaultIdleTimeout,
+		heads:             make(chan int, 1),
+	}
+	for _, opt := range options {
+		opt(w)
+	}
+
+	return w
+}
+
+// Heads - numbers of pushed heads, only the latest head is kept if consumer is slow
+func (w *HeadsWatcher) Heads() <-chan int {
+	return w.heads
+}
+
+// Connected - reports whether heads subscription is active
+func (w *HeadsWatcher) Connected() bool {
+	return w.connected.Load()
+}
+
+// Run - keeps subscription alive until ctx is done
+func (w *HeadsWatcher) Run(ctx context.Context) {
+	delay := w.reconnectDelay
+	for {
+		if w.watch(ctx) {
+			// subscription was established, so reconnect starts with initial delay
+			delay = w.reconnectDelay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, w.maxReconnectDelay)
+	}
+}
+
+type header struct {
+	Number string `json:"number"`
+}
+
+// watch - forwards heads of single connection till it is closed or no head is pushed for idle timeout,
+// returns true if subscription was established
+func (w *HeadsWatcher) watch(ctx context.Context) bool {
+	client, err := DialWs(ctx, w.addr)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		w.connected.Store(false)
+		_ = client.Close()
+	}()
+	sub, err := client.Subscribe(ctx, "newHeads")
+	if err != nil {
+		return false
+	}
+	w.connected.Store(true)
+
+	// half-open connection is neither closed nor delivers heads
+	idle := time.NewTimer(w.idleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-idle.C:
+			return true
+		case <-ctx.Done():
+			unsubscribeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			_ = sub.Unsubscribe(unsubscribeCtx)
+			cancel()
+
+			return true
+		case notification, ok := <-sub.Notifications():
+			if !ok {
+				return true
+			}
+			idle.Reset(w.idleTimeout)
+			var head header
+			if err = json.Unmarshal(notification, &head); err != nil {
+				continue
+			}
+			number, err := converter.ParseHexInt(head.Number)
+			if err != nil {
+				continue
+			}
+			w.push(number)
+		}
+	}
+}
+
+func (w *HeadsWatcher) push(number int) {
+	for {
+		select {
+		case w.heads <- number:
+			return
+		default:
+		}
+		select {
+		case <-w.heads:
+		default:
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package ethrpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+// EndpointClient - node API served by single endpoint
+type EndpointClient interface {
+	GetBlockNumber(ctx context.Context) (int, error)
+	GetBlockNumberByTag(ctx context.Context, tag domain.BlockTag) (int, error)
+	GetBlockByNumber(ctx context.Context, number int) (domain.Block, error)
+	GetBlocksByRange(ctx context.Context, from, to int) ([]domain.Block, error)
+	GetBlockReceipts(ctx context.Context, number int, txHashes []string) ([]domain.Receipt, error)
+	GetBlockInternalTxs(ctx context.Context, number int) ([]domain.Transaction, error)
+}
+
+var _ EndpointClient = (*JsonRpcClient)(nil)
+
+type Endpoint struct {
+	Name   string
+	Client EndpointClient
+	// Weight - relative preference of endpoint with the same health, 1 if not set
+	Weight int
+}
+
+var (
+	ErrNoEndpoints = errors.New("no endpoints")
+)
+
+const (
+	defaultMaxLag = 3
+	// ewmaAlpha - weight of the latest observation in latency and error rate moving averages
+	ewmaAlpha = 0.2
+)
+
+// MultiClient - routes calls to the healthiest endpoint and fails over to the next one on errors,
+// endpoints lagging behind the best known head are avoided
+type MultiClient struct {
+	endpoints []*endpoint
+	maxLag    int
+}
+
+type MultiClientOption func(*MultiClient)
+
+// WithMaxLag - max count of blocks endpoint head may lag behind the best known head to receive calls
+func WithMaxLag(maxLag int) MultiClientOption {
+	return func(m *MultiClient) {
+		m.maxLag = max(maxLag, 0)
+	}
+}
+
+func NewMultiClient(endpoints []Endpoint, options ...MultiClientOption) (*MultiClient, error) {
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	m := &MultiClient{
+		maxLag: defaultMaxLag,
+	}
+	for _, opt := range options {
+		opt(m)
+	}
+	for _, e := range endpoints {
+		m.endpoints = append(m.endpoints, &endpoint{
+			name:   e.Name,
+			client: e.Client,
+			weight: max(e.Weight, 1),
+		})
+	}
+
+	return m, nil
+}
+
+type endpoint struct {
+	name   string
+	client EndpointClient
+	weight int
+
+	mu        sync.Mutex
+	latency   time.Duration
+	errorRate float64
+	head      int
+}
+
+// EndpointStats - health of endpoint
+type EndpointStats struct {
+	Name      string
+	Weight    int
+	Latency   time.Duration
+	ErrorRate float64
+	Head      int
+}
+
+func (e *endpoint) observe(latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var failed float64
+	if err != nil {
+		failed = 1
+	}
+	e.errorRate = ewmaAlpha*failed + (1-ewmaAlpha)*e.errorRate
+	if err != nil {
+		return
+	}
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(ewmaAlpha*float64(latency) + (1-ewmaAlpha)*float64(e.latency))
+	}
+}
+
+func (e *endpoint) observeHead(head int) {
+	e.mu.Lock()
+	e.head = max(e.head, head)
+	e.mu.Unlock()
+}
+
+func (e *endpoint) stats() EndpointStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return EndpointStats{
+		Name:      e.name,
+		Weight:    e.weight,
+		Latency:   e.latency,
+		ErrorRate: e.errorRate,
+		Head:      e.head,
+	}
+}
+
+// score - higher is healthier, failing endpoint gets zero score but still may be used as the last resort
+func (s EndpointStats) score() float64 {
+	return float64(s.Weight) * (1 - s.ErrorRate) / (1 + s.Latency.Seconds()*1000)
+}
+
+// Stats - health of all endpoints
+func (m *MultiClient) Stats() []EndpointStats {
+	stats := make([]EndpointStats, len(m.endpoints))
+	for i, e := range m.endpoints {
+		stats[i] = e.stats()
+	}
+
+	return stats
+}
+
+// candidates - endpoints ordered by health, lagging endpoints are skipped while there are up to date ones
+func (m *MultiClient) candidates() []*endpoint {
+	type candidate struct {
+		endpoint *endpoint
+		stats    EndpointStats
+	}
+	var (
+		all      = make([]candidate, len(m.endpoints))
+		bestHead int
+	)
+	for i, e := range m.endpoints {
+		all[i] = candidate{endpoint: e, stats: e.stats()}
+		bestHead = max(bestHead, all[i].stats.Head)
+	}
+	slices.SortStableFunc(all, func(a, b candidate) int {
+		aLags, bLags := bestHead-a.stats.Head > m.maxLag, bestHead-b.stats.Head > m.maxLag
+		switch {
+		case aLags && !bLags:
+			return 1
+		case !aLags && bLags:
+			return -1
+		}
+		scoreA, scoreB := a.stats.score(), b.stats.score()
+		switch {
+		case scoreA > scoreB:
+			return -1
+		case scoreA < scoreB:
+			return 1
+		default:
+			return 0
+		}
+	})
+	endpoints := make([]*endpoint, len(all))
+	for i, c := range all {
+		endpoints[i] = c.endpoint
+	}
+
+	return endpoints
+}
+
+// call - tries candidates in order of health till the first successful call
+func call[T any](ctx context.Context, m *MultiClient, fn func(e *endpoint) (T, error)) (T, error) {
+	var joinedErr error
+	for _, e := range m.candidates() {
+		start := time.Now()
+		result, err := fn(e)
+		if ctx.Err() != nil {
+			return result, errors.Join(err, ctx.Err())
+		}
+		e.observe(time.Since(start), err)
+		if err == nil {
+			return result, nil
+		}
+		joinedErr = errors.Join(joinedErr, fmt.Errorf("endpoint %s: %w", e.name, err))
+	}
+	var zero T
+
+	return zero, joinedErr
+}
+
+func (m *MultiClient) GetBlockNumber(ctx context.Context) (int, error) {
+	return call(ctx, m, func(e *endpoint) (int, error) {
+		head, err := e.client.GetBlockNumber(ctx)
+		if err == nil {
+			e.observeHead(head)
+		}
+
+		return head, err
+	})
+}
+
+func (m *MultiClient) GetBlockNumberByTag(ctx context.Context, tag domain.BlockTag) (int, error) {
+	return call(ctx, m, func(e *endpoint) (int, error) {
+		return e.client.GetBlockNumberByTag(ctx, tag)
+	})
+}
+
+func (m *MultiClient) GetBlockByNumber(ctx context.Context, number int) (domain.Block, error) {
+	return call(ctx, m, func(e *endpoint) (domain.Block, error) {
+		return e.client.GetBlockByNumber(ctx, number)
+	})
+}
+
+func (m *MultiClient) GetBlocksByRange(ctx context.Context, from, to int) ([]domain.Block, error) {
+	return call(ctx, m, func(e *endpoint) ([]domain.Block, error) {
+		return e.client.GetBlocksByRange(ctx, from, to)
+	})
+}
+
+func (m *MultiClient) GetBlockReceipts(ctx context.Context, number int, txHashes []string) ([]domain.Receipt, error) {
+	return call(ctx, m, func(e *endpoint) ([]domain.Receipt, error) {
+		return e.client.GetBlockReceipts(ctx, number, txHashes)
+	})
+}
+
+func (m *MultiClient) GetBlockInternalTxs(ctx context.Context, number int) ([]domain.Transaction, error) {
+	return call(ctx, m, func(e *endpoint) ([]domain.Transaction, error) {
+		return e.client.GetBlockInternalTxs(ctx, number)
+	})
+}
+
+// Probe - refreshes head and health of every endpoint concurrently
+func (m *MultiClient) Probe(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, e := range m.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			head, err := e.client.GetBlockNumber(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			e.observe(time.Since(start), err)
+			if err == nil {
+				e.observeHead(head)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Run - probes endpoints on interval until ctx is done, so failed endpoints can recover
+func (m *MultiClient) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.Probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
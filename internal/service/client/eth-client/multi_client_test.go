@@ -0,0 +1,122 @@
+package ethrpcclient
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEndpoint struct {
+	EndpointClient
+
+	head  int
+	err   error
+	calls atomic.Int32
+}
+
+func (f *fakeEndpoint) GetBlockNumber(_ context.Context) (int, error) {
+	f.calls.Add(1)
+
+	return f.head, f.err
+}
+
+func (f *fakeEndpoint) GetBlockByNumber(_ context.Context, number int) (domain.Block, error) {
+	f.calls.Add(1)
+	if f.err != nil {
+		return domain.Block{}, f.err
+	}
+	if number > f.head {
+		return domain.Block{}, ErrBlockNotFound
+	}
+
+	return domain.Block{Number: converter.FormatHexInt(number), Hash: "0x1"}, nil
+}
+
+func TestMultiClientFailover(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		failing = &fakeEndpoint{head: 100, err: errors.New("429 too many requests")}
+		healthy = &fakeEndpoint{head: 100}
+	)
+	client, err := NewMultiClient([]Endpoint{
+		{Name: "failing", Client: failing, Weight: 10},
+		{Name: "healthy", Client: healthy},
+	})
+	require.NoError(t, err)
+
+	// failing endpoint is preferred by weight until it accumulates errors
+	head, err := client.GetBlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 100, head)
+	require.Equal(t, int32(1), failing.calls.Load())
+	require.Equal(t, int32(1), healthy.calls.Load())
+
+	for range 10 {
+		_, err = client.GetBlockByNumber(ctx, 100)
+		require.NoError(t, err)
+	}
+	require.Less(t, failing.calls.Load(), int32(5))
+
+	failing.err = nil
+	healthy.err = errors.New("502 bad gateway")
+	_, err = client.GetBlockByNumber(ctx, 100)
+	require.NoError(t, err)
+
+	stats := client.Stats()
+	require.Len(t, stats, 2)
+	require.Greater(t, stats[0].ErrorRate, 0.0)
+	require.Greater(t, stats[1].ErrorRate, 0.0)
+}
+
+func TestMultiClientAvoidsLaggingEndpoint(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		lagging = &fakeEndpoint{head: 90}
+		synced  = &fakeEndpoint{head: 100}
+	)
+	client, err := NewMultiClient([]Endpoint{
+		{Name: "lagging", Client: lagging, Weight: 10},
+		{Name: "synced", Client: synced},
+	}, WithMaxLag(2))
+	require.NoError(t, err)
+
+	client.Probe(ctx)
+	lagging.calls.Store(0)
+
+	for number := 95; number <= 100; number++ {
+		block, err := client.GetBlockByNumber(ctx, number)
+		require.NoError(t, err)
+		require.Equal(t, converter.FormatHexInt(number), block.Number)
+	}
+	require.Zero(t, lagging.calls.Load())
+
+	// all endpoints are used when synced one fails
+	synced.err = errors.New("connection refused")
+	_, err = client.GetBlockByNumber(ctx, 90)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), lagging.calls.Load())
+}
+
+func TestMultiClientAllFailed(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := NewMultiClient([]Endpoint{
+		{Name: "a", Client: &fakeEndpoint{err: errors.New("a failed")}},
+		{Name: "b", Client: &fakeEndpoint{err: errors.New("b failed")}},
+	})
+	require.NoError(t, err)
+
+	_, err = client.GetBlockNumber(ctx)
+	require.ErrorContains(t, err, "endpoint a: a failed")
+	require.ErrorContains(t, err, "endpoint b: b failed")
+
+	_, err = NewMultiClient(nil)
+	require.ErrorIs(t, err, ErrNoEndpoints)
+}
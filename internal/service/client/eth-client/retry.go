@@ -0,0 +1,172 @@
+package ethrpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HTTPError - non 200 response of node
+type HTTPError struct {
+	StatusCode int
+	// RetryAfter - delay requested by node with Retry-After header
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP ERROR code=%d", e.StatusCode)
+}
+
+var retryableStatuses = map[int]struct{}{
+	http.StatusTooManyRequests:    {},
+	http.StatusBadGateway:         {},
+	http.StatusServiceUnavailable: {},
+	http.StatusGatewayTimeout:     {},
+}
+
+// retryableCodes - JSON-RPC error codes of rate limited or temporary unavailable node
+var retryableCodes = map[int]struct{}{
+	-32005: {}, // limit exceeded
+	-32097: {}, // rate limited by some providers
+}
+
+func retryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		_, ok := retryableStatuses[httpErr.StatusCode]
+
+		return ok
+	}
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		_, ok := retryableCodes[rpcErr.Code]
+
+		return ok
+	}
+	// transport errors and timeouts of single attempt are retried while parent context is alive
+	var netErr net.Error
+
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// parseRetryAfter - parses Retry-After header in seconds or HTTP date format
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// backoff - exponential delay with full jitter before next attempt
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.maxDelay
+	if shift := attempt - 1; shift < 32 {
+		delay = min(p.baseDelay<<shift, p.maxDelay)
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return rand.N(delay) + 1
+}
+
+// WithRetry - retries retryable HTTP statuses, JSON-RPC errors and transport errors up to max attempts
+// with exponential backoff and jitter, Retry-After header of node is honored
+func WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(c *JsonRpcClient) {
+		c.retry = retryPolicy{
+			maxAttempts: max(maxAttempts, 1),
+			baseDelay:   baseDelay,
+			maxDelay:    max(baseDelay, maxDelay),
+		}
+	}
+}
+
+// WithTimeout - timeout of single call attempt
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *JsonRpcClient) {
+		c.timeout = timeout
+	}
+}
+
+// WithRateLimit - limits requests per second with token bucket allowing bursts of given size
+func WithRateLimit(rps float64, burst int) Option {
+	return func(c *JsonRpcClient) {
+		if rps <= 0 {
+			c.limiter = nil
+
+			return
+		}
+		c.limiter = newTokenBucket(rps, max(burst, 1))
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *JsonRpcClient) {
+		c.httpClient = client
+	}
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait - blocks until token is available or ctx is done
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
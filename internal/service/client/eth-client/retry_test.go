@@ -0,0 +1,149 @@
+package ethrpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newFlakyNode - node stand-in which fails first requests with given response
+func newFlakyNode(t *testing.T, failures int32, fail func(w http.ResponseWriter, id int)) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if requests.Add(1) <= failures {
+			fail(w, req.Id)
+
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+			"jsonrpc": jsonRpcVersion, "id": req.Id, "result": "0x64",
+		}))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+
+	tooManyRequests := func(w http.ResponseWriter, _ int) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	limitExceeded := func(w http.ResponseWriter, id int) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"jsonrpc": jsonRpcVersion, "id": id, "error": rpcError{Code: -32005, Message: "limit exceeded"},
+		})
+	}
+	tests := map[string]struct {
+		failures         int32
+		fail             func(w http.ResponseWriter, id int)
+		options          []Option
+		expectedStatus   int
+		expectedRequests int32
+	}{
+		"1. Success: retried 429": {
+			failures:         2,
+			fail:             tooManyRequests,
+			options:          []Option{WithRetry(3, time.Millisecond, 10*time.Millisecond)},
+			expectedRequests: 3,
+		},
+		"2. Success: retried limit exceeded": {
+			failures:         1,
+			fail:             limitExceeded,
+			options:          []Option{WithRetry(3, time.Millisecond, 10*time.Millisecond)},
+			expectedRequests: 2,
+		},
+		"3. Err: attempts exceeded": {
+			failures:         3,
+			fail:             tooManyRequests,
+			options:          []Option{WithRetry(3, time.Millisecond, 10*time.Millisecond)},
+			expectedStatus:   http.StatusTooManyRequests,
+			expectedRequests: 3,
+		},
+		"4. Err: not retryable status": {
+			failures: 1,
+			fail: func(w http.ResponseWriter, _ int) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			options:          []Option{WithRetry(3, time.Millisecond, 10*time.Millisecond)},
+			expectedStatus:   http.StatusUnauthorized,
+			expectedRequests: 1,
+		},
+		"5. Err: retries disabled by default": {
+			failures:         1,
+			fail:             tooManyRequests,
+			expectedStatus:   http.StatusTooManyRequests,
+			expectedRequests: 1,
+		},
+		"6. Success: retried attempt timeout": {
+			failures: 1,
+			fail: func(w http.ResponseWriter, _ int) {
+				time.Sleep(100 * time.Millisecond)
+			},
+			options: []Option{
+				WithTimeout(20 * time.Millisecond),
+				WithRetry(2, time.Millisecond, 10*time.Millisecond),
+			},
+			expectedRequests: 2,
+		},
+	}
+	for name, testCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, requests := newFlakyNode(t, testCase.failures, testCase.fail)
+
+			client, err := NewJsonRpcClient(srv.URL, testCase.options...)
+			require.NoError(t, err)
+
+			number, err := client.GetBlockNumber(ctx)
+			require.Equal(t, testCase.expectedRequests, requests.Load())
+			if testCase.expectedStatus != 0 {
+				var httpErr *HTTPError
+				require.ErrorAs(t, err, &httpErr)
+				require.Equal(t, testCase.expectedStatus, httpErr.StatusCode)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, 100, number)
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	require.Equal(t, 2*time.Second, parseRetryAfter("2"))
+	require.Zero(t, parseRetryAfter(""))
+	require.Zero(t, parseRetryAfter("soon"))
+	require.InDelta(t, 10*time.Second, parseRetryAfter(time.Now().Add(10*time.Second).UTC().Format(http.TimeFormat)), float64(time.Second))
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx := context.Background()
+	srv, requests := newFlakyNode(t, 0, nil)
+
+	const (
+		rps   = 50
+		burst = 2
+		calls = 7
+	)
+	client, err := NewJsonRpcClient(srv.URL, WithRateLimit(rps, burst))
+	require.NoError(t, err)
+
+	start := time.Now()
+	for range calls {
+		_, err = client.GetBlockNumber(ctx)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(calls), requests.Load())
+	// burst is served immediately, the rest is limited by rate
+	require.GreaterOrEqual(t, time.Since(start), (calls-burst)*time.Second/rps-10*time.Millisecond)
+}
@@ -6,25 +6,53 @@ import (
 	"errors"
 	"net/http"
 	"sync/atomic"
+	"time"
 
 	"github.com/dmitrorezn/tx-parser/internal/domain"
 	"github.com/dmitrorezn/tx-parser/pkg/converter"
 )
 
 type JsonRpcClient struct {
-	httpClient *http.Client
-	addr       string
+	httpClient   *http.Client
+	addr         string
+	maxBatchSize int
+	tracer       Tracer
+	timeout      time.Duration
+	retry        retryPolicy
+	limiter      *tokenBucket
 }
 
-func NewJsonRpcClient(addr string) (*JsonRpcClient, error) {
-	return &JsonRpcClient{
-		addr:       addr,
-		httpClient: http.DefaultClient,
-	}, nil
+const (
+	defaultMaxBatchSize = 100
+)
+
+type Option func(*JsonRpcClient)
+
+// WithMaxBatchSize - max count of calls sent in one batch request, bigger batches are split
+func WithMaxBatchSize(size int) Option {
+	return func(c *JsonRpcClient) {
+		c.maxBatchSize = max(size, 1)
+	}
+}
+
+func NewJsonRpcClient(addr string, options ...Option) (*JsonRpcClient, error) {
+	c := &JsonRpcClient{
+		addr:         addr,
+		httpClient:   http.DefaultClient,
+		maxBatchSize: defaultMaxBatchSize,
+		retry:        retryPolicy{maxAttempts: 1},
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+
+	return c, nil
 }
 
 var (
-	ErrCallBlockchain = errors.New("err call blockchain")
+	ErrCallBlockchain       = errors.New("err call blockchain")
+	ErrMissingBatchResponse = errors.New("missing batch response")
+	ErrBlockNotFound        = errors.New("block not found")
 )
 
 type rpcError struct {
@@ -41,6 +69,7 @@ func (e rpcError) Error() string {
 }
 
 type rpcResponse struct {
+	Id     int             `json:"id"`
 	Result json.RawMessage `json:"result"`
 	Error  *rpcError
 }
@@ -79,19 +108,111 @@ func (c *JsonRpcClient) GetBlockNumber(ctx context.Context) (int, error) {
 
 type numberAndFullTxFlag [2]any
 
-func (c *JsonRpcClient) GetBlockTxsByNumber(ctx context.Context, number int) ([]domain.Transaction, error) {
+func (c *JsonRpcClient) GetBlockNumberByTag(ctx context.Context, tag domain.BlockTag) (int, error) {
+	var (
+		params = numberAndFullTxFlag{
+			tag,   // block tag
+			false, // return only tx hashes
+		}
+		header struct {
+			Number string `json:"number"`
+		}
+	)
+	if err := c.doRequest(ctx, "eth_getBlockByNumber", &header, params[:]...); err != nil {
+		return 0, errors.Join(err, ErrCallBlockchain)
+	}
+
+	return converter.ParseHexInt(header.Number)
+}
+
+func (c *JsonRpcClient) GetBlockByNumber(ctx context.Context, number int) (domain.Block, error) {
 	var (
 		params = numberAndFullTxFlag{
 			converter.FormatHexInt(number), //block number hex formatted
 			true,                           // return full tx data
 		}
-		response struct {
-			Txs []domain.Transaction `json:"transactions"`
-		}
+		block domain.Block
 	)
-	if err := c.doRequest(ctx, "eth_getBlockByNumber", &response, params[:]...); err != nil {
+	if err := c.doRequest(ctx, "eth_getBlockByNumber", &block, params[:]...); err != nil {
+		return domain.Block{}, errors.Join(err, ErrCallBlockchain)
+	}
+	// node responds with null result for block it has not seen yet
+	if block.Hash == "" {
+		return domain.Block{}, errors.Join(ErrBlockNotFound, ErrCallBlockchain)
+	}
+
+	return block, nil
+}
+
+// GetBlocksByRange - fetches blocks in range [from, to] with batch requests,
+// returns blocks in order till the first failed one
+func (c *JsonRpcClient) GetBlocksByRange(ctx context.Context, from, to int) ([]domain.Block, error) {
+	var (
+		blocks = make([]domain.Block, to-from+1)
+		calls  = make([]BatchElem, len(blocks))
+	)
+	for i := range calls {
+		calls[i] = BatchElem{
+			Method: "eth_getBlockByNumber",
+			Params: []any{converter.FormatHexInt(from + i), true},
+			Result: &blocks[i],
+		}
+	}
+	if err := c.BatchCall(ctx, calls); err != nil {
+		return nil, errors.Join(err, ErrCallBlockchain)
+	}
+	for i, call := range calls {
+		if call.Error != nil {
+			return blocks[:i], errors.Join(call.Error, ErrCallBlockchain)
+		}
+		if blocks[i].Hash == "" {
+			return blocks[:i], errors.Join(ErrBlockNotFound, ErrCallBlockchain)
+		}
+	}
+
+	return blocks, nil
+}
+
+func (c *JsonRpcClient) GetBlockTxsByNumber(ctx context.Context, number int) ([]domain.Transaction, error) {
+	block, err := c.GetBlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+
+	return block.Transactions, nil
+}
+
+// GetBlockReceipts - fetches receipts of block transactions with eth_getBlockReceipts,
+// falls back to eth_getTransactionReceipt batch calls when node does not support it
+func (c *JsonRpcClient) GetBlockReceipts(ctx context.Context, number int, txHashes []string) ([]domain.Receipt, error) {
+	var receipts []domain.Receipt
+	err := c.doRequest(ctx, "eth_getBlockReceipts", &receipts, converter.FormatHexInt(number))
+	var rpcErr *rpcError
+	if err == nil || !errors.As(err, &rpcErr) {
+		if err != nil {
+			return nil, errors.Join(err, ErrCallBlockchain)
+		}
+
+		return receipts, nil
+	}
+
+	receipts = make([]domain.Receipt, len(txHashes))
+	calls := make([]BatchElem, len(txHashes))
+	for i, hash := range txHashes {
+		calls[i] = BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Params: []any{hash},
+			Result: &receipts[i],
+		}
+	}
+	if err = c.BatchCall(ctx, calls); err != nil {
 		return nil, errors.Join(err, ErrCallBlockchain)
 	}
+	for _, call := range calls {
+		if call.Error != nil {
+			return nil, errors.Join(call.Error, ErrCallBlockchain)
+		}
+	}
 
-	return response.Txs, nil
+	return receipts, nil
 }
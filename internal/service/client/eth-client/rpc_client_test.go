@@ -2,8 +2,14 @@ package ethrpcclient
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,3 +42,262 @@ func TestGetBlockTxs(t *testing.T) {
 	require.NotNil(t, txs)
 	t.Log(len(txs))
 }
+
+type rpcHandler func(method string, params []json.RawMessage) (any, *rpcError)
+
+// newNode - starts JSON-RPC node stand-in serving single and batch requests, counts http requests
+func newNode(t *testing.T, handler rpcHandler) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		var raw json.RawMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&raw))
+
+		type request struct {
+			Id     int               `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		handle := func(req request) map[string]any {
+			result, err := handler(req.Method, req.Params)
+			if err != nil {
+				return map[string]any{"jsonrpc": jsonRpcVersion, "id": req.Id, "error": err}
+			}
+			return map[string]any{"jsonrpc": jsonRpcVersion, "id": req.Id, "result": result}
+		}
+		if raw[0] != '[' {
+			var req request
+			require.NoError(t, json.Unmarshal(raw, &req))
+			require.NoError(t, json.NewEncoder(w).Encode(handle(req)))
+
+			return
+		}
+		var reqs []request
+		require.NoError(t, json.Unmarshal(raw, &reqs))
+		responses := make([]map[string]any, 0, len(reqs))
+		// respond in reversed order to check correlation by id
+		for i := len(reqs) - 1; i >= 0; i-- {
+			responses = append(responses, handle(reqs[i]))
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(responses))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func blockHandler(method string, params []json.RawMessage) (any, *rpcError) {
+	if method != "eth_getBlockByNumber" {
+		return nil, &rpcError{Code: -32601, Message: "method not found"}
+	}
+	var number string
+	if err := json.Unmarshal(params[0], &number); err != nil {
+		return nil, &rpcError{Code: -32602, Message: err.Error()}
+	}
+	if number == "0x0" {
+		return nil, &rpcError{Code: -32000, Message: "block not available"}
+	}
+
+	return domain.Block{Number: number, Hash: "0xhash" + number}, nil
+}
+
+func TestBatchCall(t *testing.T) {
+	ctx := context.Background()
+	srv, requests := newNode(t, blockHandler)
+
+	client, err := NewJsonRpcClient(srv.URL, WithMaxBatchSize(2))
+	require.NoError(t, err)
+
+	var (
+		numbers = []string{"0x1", "0x0", "0x3", "0x4", "0x5"}
+		blocks  = make([]domain.Block, len(numbers))
+		calls   = make([]BatchElem, len(numbers))
+	)
+	for i, number := range numbers {
+		calls[i] = BatchElem{
+			Method: "eth_getBlockByNumber",
+			Params: []any{number, true},
+			Result: &blocks[i],
+		}
+	}
+	require.NoError(t, client.BatchCall(ctx, calls))
+	require.Equal(t, int32(3), requests.Load())
+
+	for i, call := range calls {
+		if numbers[i] == "0x0" {
+			require.EqualError(t, call.Error, "block not available")
+
+			continue
+		}
+		require.NoError(t, call.Error)
+		require.Equal(t, "0xhash"+numbers[i], blocks[i].Hash)
+	}
+}
+
+func TestGetBlocksByRange(t *testing.T) {
+	ctx := context.Background()
+	srv, requests := newNode(t, blockHandler)
+
+	client, err := NewJsonRpcClient(srv.URL)
+	require.NoError(t, err)
+
+	blocks, err := client.GetBlocksByRange(ctx, 10, 19)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), requests.Load())
+	require.Len(t, blocks, 10)
+	for i, block := range blocks {
+		require.Equal(t, converter.FormatHexInt(10+i), block.Number)
+	}
+}
+
+func TestGetBlockReceipts(t *testing.T) {
+	ctx := context.Background()
+
+	receiptHandler := func(method string, params []json.RawMessage) (any, *rpcError) {
+		if method != "eth_getTransactionReceipt" {
+			return nil, &rpcError{Code: -32601, Message: "method not found"}
+		}
+		var hash string
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return nil, &rpcError{Code: -32602, Message: err.Error()}
+		}
+
+		return domain.Receipt{TransactionHash: hash, Status: domain.TxStatusFailed}, nil
+	}
+	tests := map[string]struct {
+		handler          rpcHandler
+		expectedRequests int32
+	}{
+		"1. Success: block receipts": {
+			handler: func(method string, params []json.RawMessage) (any, *rpcError) {
+				if method != "eth_getBlockReceipts" {
+					return nil, &rpcError{Code: -32601, Message: "method not found"}
+				}
+
+				return []domain.Receipt{
+					{TransactionHash: "0x1", Status: domain.TxStatusFailed},
+					{TransactionHash: "0x2", Status: domain.TxStatusFailed},
+				}, nil
+			},
+			expectedRequests: 1,
+		},
+		"2. Success: fallback to transaction receipts": {
+			handler:          receiptHandler,
+			expectedRequests: 2,
+		},
+	}
+	for name, testCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, requests := newNode(t, testCase.handler)
+
+			client, err := NewJsonRpcClient(srv.URL)
+			require.NoError(t, err)
+
+			receipts, err := client.GetBlockReceipts(ctx, 1, []string{"0x1", "0x2"})
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedRequests, requests.Load())
+			require.Equal(t, []domain.Receipt{
+				{TransactionHash: "0x1", Status: domain.TxStatusFailed},
+				{TransactionHash: "0x2", Status: domain.TxStatusFailed},
+			}, receipts)
+		})
+	}
+}
+
+func TestGetBlockInternalTxs(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		multisig = domain.Address("0x00000000000000000000000000000000000000a1")
+		payee    = domain.Address("0x00000000000000000000000000000000000000b2")
+		library  = domain.Address("0x00000000000000000000000000000000000000c3")
+	)
+	expected := []domain.Transaction{
+		{
+			Hash:             "0xtx",
+			TransactionIndex: "0x0",
+			From:             multisig,
+			To:               payee,
+			Value:            "0xde0b6b3a7640000",
+			TraceAddress:     "1",
+		},
+	}
+	tests := map[string]struct {
+		tracer  Tracer
+		handler rpcHandler
+	}{
+		"1. Success: callTracer": {
+			tracer: TracerCallTracer,
+			handler: func(method string, _ []json.RawMessage) (any, *rpcError) {
+				if method != "debug_traceBlockByNumber" {
+					return nil, &rpcError{Code: -32601, Message: "method not found"}
+				}
+
+				return []callTrace{
+					{
+						TxHash: "0xtx",
+						Result: callFrame{
+							Type: "CALL", From: payee, To: multisig, Value: "0x0",
+							Calls: []callFrame{
+								{Type: "DELEGATECALL", From: multisig, To: library, Value: "0x1"},
+								{Type: "CALL", From: multisig, To: payee, Value: "0xde0b6b3a7640000"},
+								{Type: "CALL", From: multisig, To: payee, Value: "0x1", Error: "execution reverted"},
+							},
+						},
+					},
+				}, nil
+			},
+		},
+		"2. Success: parity trace_block": {
+			tracer: TracerParity,
+			handler: func(method string, _ []json.RawMessage) (any, *rpcError) {
+				if method != "trace_block" {
+					return nil, &rpcError{Code: -32601, Message: "method not found"}
+				}
+				trace := func(callType string, from, to domain.Address, value string, path ...int) parityTrace {
+					var t parityTrace
+					t.Type = "call"
+					t.Action.CallType = callType
+					t.Action.From, t.Action.To, t.Action.Value = from, to, value
+					t.TraceAddress = path
+					t.TransactionHash = "0xtx"
+
+					return t
+				}
+
+				// value of calls of reverted call and of failed transaction is not transferred
+				reverted := trace("call", multisig, payee, "0x1", 2)
+				reverted.Error = "Reverted"
+				failed := []parityTrace{
+					trace("call", payee, multisig, "0x1"),
+					trace("call", multisig, payee, "0x1", 0),
+				}
+				failed[0].Error = "Reverted"
+				for i := range failed {
+					failed[i].TransactionHash, failed[i].TransactionPosition = "0xfailed", 1
+				}
+
+				return append([]parityTrace{
+					trace("call", payee, multisig, "0x1"),
+					trace("delegatecall", multisig, library, "0x1", 0),
+					trace("call", multisig, payee, "0xde0b6b3a7640000", 1),
+					reverted,
+					trace("call", payee, library, "0x1", 2, 0),
+				}, failed...), nil
+			},
+		},
+	}
+	for name, testCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, _ := newNode(t, testCase.handler)
+
+			client, err := NewJsonRpcClient(srv.URL, WithTracer(testCase.tracer))
+			require.NoError(t, err)
+
+			txs, err := client.GetBlockInternalTxs(ctx, 1)
+			require.NoError(t, err)
+			require.Equal(t, expected, txs)
+		})
+	}
+}
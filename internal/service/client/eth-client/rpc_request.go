@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"time"
 )
 
 func (c *JsonRpcClient) doRequest(ctx context.Context, method string, result any, params ...any) error {
@@ -13,10 +15,56 @@ func (c *JsonRpcClient) doRequest(ctx context.Context, method string, result any
 	if err != nil {
 		return err
 	}
+
+	return c.post(ctx, payload, func(body io.Reader) error {
+		var response rpcResponse
+		if err := json.NewDecoder(body).Decode(&response); err != nil {
+			return err
+		}
+		if response.Error != nil {
+			return response.Error
+		}
+
+		return json.Unmarshal(response.Result, result)
+	})
+}
+
+// post - sends payload respecting rate limit and call timeout, retries retryable failures with backoff
+func (c *JsonRpcClient) post(ctx context.Context, payload []byte, decode func(body io.Reader) error) error {
+	for attempt := 1; ; attempt++ {
+		err := c.postOnce(ctx, payload, decode)
+		if err == nil || attempt >= c.retry.maxAttempts || !retryable(err) {
+			return err
+		}
+		delay := c.retry.backoff(attempt)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			delay = max(delay, httpErr.RetryAfter)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *JsonRpcClient) postOnce(ctx context.Context, payload []byte, decode func(body io.Reader) error) (err error) {
+	if c.limiter != nil {
+		if err = c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
 	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.addr, bytes.NewReader(payload))
 	if err != nil {
 		return err
 	}
+	request.Header.Set("Content-Type", "application/json")
 	resp, err := c.httpClient.Do(request)
 	if err != nil {
 		return err
@@ -24,16 +72,91 @@ func (c *JsonRpcClient) doRequest(ctx context.Context, method string, result any
 	defer func() {
 		err = errors.Join(err, resp.Body.Close())
 	}()
-	var response rpcResponse
-	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return err
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		return &HTTPError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
-	if response.Error != nil {
-		return response.Error
+
+	return decode(resp.Body)
+}
+
+// BatchElem - single call of batch request, Error is set if call failed
+type BatchElem struct {
+	Method string
+	Params []any
+	Result any
+	Error  error
+}
+
+// BatchCall - sends calls in batch requests of max batch size, responses are correlated with calls by id,
+// returned error means whole batch failed while failed calls have their own errors
+func (c *JsonRpcClient) BatchCall(ctx context.Context, calls []BatchElem) error {
+	for start := 0; start < len(calls); start += c.maxBatchSize {
+		if err := c.doBatchRequest(ctx, calls[start:min(start+c.maxBatchSize, len(calls))]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *JsonRpcClient) doBatchRequest(ctx context.Context, calls []BatchElem) error {
+	var (
+		requests = make([]Request, len(calls))
+		byId     = make(map[int]*BatchElem, len(calls))
+	)
+	for i := range calls {
+		requests[i] = newRequest(calls[i].Method, calls[i].Params...)
+		byId[requests[i].Id] = &calls[i]
+	}
+	payload, err := json.Marshal(requests)
+	if err != nil {
+		return err
 	}
-	if err = json.Unmarshal(response.Result, result); err != nil {
+	var responses []rpcResponse
+	err = c.post(ctx, payload, func(body io.Reader) error {
+		var raw json.RawMessage
+		if err := json.NewDecoder(body).Decode(&raw); err != nil {
+			return err
+		}
+		// node responds with single error object when batch is rejected
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '{' {
+			var response rpcResponse
+			if err := json.Unmarshal(raw, &response); err != nil {
+				return err
+			}
+			if response.Error != nil {
+				return response.Error
+			}
+
+			return ErrMissingBatchResponse
+		}
+
+		return json.Unmarshal(raw, &responses)
+	})
+	if err != nil {
 		return err
 	}
+	for _, response := range responses {
+		call, ok := byId[response.Id]
+		if !ok {
+			continue
+		}
+		delete(byId, response.Id)
+		if response.Error != nil {
+			call.Error = response.Error
+
+			continue
+		}
+		call.Error = json.Unmarshal(response.Result, call.Result)
+	}
+	for _, call := range byId {
+		call.Error = ErrMissingBatchResponse
+	}
 
-	return err
+	return nil
 }
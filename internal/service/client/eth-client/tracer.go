@@ -0,0 +1,198 @@
+package ethrpcclient
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
+)
+
+// Tracer - node API used to trace internal calls of block transactions
+type Tracer string
+
+const (
+	TracerNone Tracer = ""
+	// TracerCallTracer - debug_traceBlockByNumber with built-in callTracer (geth, reth, nethermind)
+	TracerCallTracer Tracer = "callTracer"
+	// TracerParity - trace_block of parity trace module (erigon, nethermind)
+	TracerParity Tracer = "parity"
+)
+
+func (t Tracer) Valid() bool {
+	return t == TracerNone || t == TracerCallTracer || t == TracerParity
+}
+
+var (
+	ErrTracerNotConfigured = errors.New("tracer not configured")
+)
+
+// WithTracer - enables tracing of internal transfers with given node API
+func WithTracer(tracer Tracer) Option {
+	return func(c *JsonRpcClient) {
+		c.tracer = tracer
+	}
+}
+
+const (
+	callTypeDelegate = "DELEGATECALL"
+	callTypeStatic   = "STATICCALL"
+)
+
+type callFrame struct {
+	Type  string         `json:"type"`
+	From  domain.Address `json:"from"`
+	To    domain.Address `json:"to"`
+	Value string         `json:"value"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+type callTrace struct {
+	TxHash string    `json:"txHash"`
+	Result callFrame `json:"result"`
+}
+
+type parityTrace struct {
+	Action struct {
+		CallType string         `json:"callType"`
+		From     domain.Address `json:"from"`
+		To       domain.Address `json:"to"`
+		Value    string         `json:"value"`
+	} `json:"action"`
+	Result *struct {
+		Address domain.Address `json:"address"`
+	} `json:"result"`
+	Error               string `json:"error"`
+	TraceAddress        []int  `json:"traceAddress"`
+	TransactionHash     string `json:"transactionHash"`
+	TransactionPosition int    `json:"transactionPosition"`
+	Type                string `json:"type"`
+}
+
+// GetBlockInternalTxs - traces block and flattens successful value bearing internal calls,
+// returned transactions have only hash, transaction index, from, to, value and trace address set
+func (c *JsonRpcClient) GetBlockInternalTxs(ctx context.Context, number int) ([]domain.Transaction, error) {
+	switch c.tracer {
+	case TracerCallTracer:
+		var traces []callTrace
+		err := c.doRequest(ctx, "debug_traceBlockByNumber", &traces,
+			converter.FormatHexInt(number),
+			map[string]string{"tracer": "callTracer"},
+		)
+		if err != nil {
+			return nil, errors.Join(err, ErrCallBlockchain)
+		}
+
+		return flattenCallTraces(traces), nil
+	case TracerParity:
+		var traces []parityTrace
+		if err := c.doRequest(ctx, "trace_block", &traces, converter.FormatHexInt(number)); err != nil {
+			return nil, errors.Join(err, ErrCallBlockchain)
+		}
+
+		return flattenParityTraces(traces), nil
+	default:
+		return nil, ErrTracerNotConfigured
+	}
+}
+
+func flattenCallTraces(traces []callTrace) []domain.Transaction {
+	var txs []domain.Transaction
+	for txIdx, trace := range traces {
+		// root frame is transaction itself
+		if trace.Result.Error != "" {
+			continue
+		}
+		txs = appendCallFrames(txs, trace.TxHash, txIdx, nil, trace.Result.Calls)
+	}
+
+	return txs
+}
+
+func appendCallFrames(
+	txs []domain.Transaction,
+	txHash string,
+	txIdx int,
+	path []int,
+	frames []callFrame,
+) []domain.Transaction {
+	for i, frame := range frames {
+		// reverted call does not transfer value including its sub calls
+		if frame.Error != "" {
+			continue
+		}
+		framePath := append(path[:len(path):len(path)], i)
+		if frame.Type != callTypeDelegate && frame.Type != callTypeStatic && hasValue(frame.Value) {
+			txs = append(txs, domain.Transaction{
+				Hash:             txHash,
+				TransactionIndex: converter.FormatHexInt(txIdx),
+				From:             frame.From,
+				To:               frame.To,
+				Value:            frame.Value,
+				TraceAddress:     formatTraceAddress(framePath),
+			})
+		}
+		txs = appendCallFrames(txs, txHash, txIdx, framePath, frame.Calls)
+	}
+
+	return txs
+}
+
+func flattenParityTraces(traces []parityTrace) []domain.Transaction {
+	// reverted call does not transfer value including its sub calls, failed transaction is reverted
+	// trace with empty trace address which is prefix of all traces of transaction
+	reverted := make(map[string][][]int)
+	for _, trace := range traces {
+		if trace.Error != "" {
+			reverted[trace.TransactionHash] = append(reverted[trace.TransactionHash], trace.TraceAddress)
+		}
+	}
+	var txs []domain.Transaction
+	for _, trace := range traces {
+		// trace with empty trace address is transaction itself
+		if len(trace.TraceAddress) == 0 || !hasValue(trace.Action.Value) {
+			continue
+		}
+		if slices.ContainsFunc(reverted[trace.TransactionHash], func(path []int) bool {
+			return len(path) <= len(trace.TraceAddress) && slices.Equal(path, trace.TraceAddress[:len(path)])
+		}) {
+			continue
+		}
+		to := trace.Action.To
+		switch {
+		case trace.Type == "create" && trace.Result != nil:
+			to = trace.Result.Address
+		case trace.Type != "call":
+			continue
+		case trace.Action.CallType == "delegatecall" || trace.Action.CallType == "staticcall":
+			continue
+		}
+		txs = append(txs, domain.Transaction{
+			Hash:             trace.TransactionHash,
+			TransactionIndex: converter.FormatHexInt(trace.TransactionPosition),
+			From:             trace.Action.From,
+			To:               to,
+			Value:            trace.Action.Value,
+			TraceAddress:     formatTraceAddress(trace.TraceAddress),
+		})
+	}
+
+	return txs
+}
+
+func hasValue(value string) bool {
+	return value != "" && strings.TrimLeft(strings.TrimPrefix(value, "0x"), "0") != ""
+}
+
+func formatTraceAddress(path []int) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = strconv.Itoa(p)
+	}
+
+	return strings.Join(parts, "-")
+}
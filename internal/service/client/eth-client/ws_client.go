@@ -0,0 +1,238 @@
+package ethrpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/dmitrorezn/tx-parser/pkg/websocket"
+)
+
+var (
+	ErrConnectionClosed = errors.New("connection closed")
+)
+
+// WsClient - JSON-RPC client over websocket supporting eth_subscribe notifications
+type WsClient struct {
+	conn *websocket.Conn
+
+	mu            sync.Mutex
+	pending       map[int]*pendingCall
+	subscriptions map[string]*Subscription
+	err           error
+
+	done chan struct{}
+}
+
+type pendingCall struct {
+	response chan rpcResponse
+	// subscription - registered by read loop as soon as subscribe response arrives,
+	// so notifications sent right after response are not lost
+	subscription *Subscription
+}
+
+// Subscription - stream of eth_subscription notification results
+type Subscription struct {
+	id            string
+	client        *WsClient
+	notifications chan json.RawMessage
+}
+
+const (
+	subscriptionBuffer = 64
+)
+
+// DialWs - connects to ws:// or wss:// JSON-RPC endpoint
+func DialWs(ctx context.Context, addr string) (*WsClient, error) {
+	conn, err := websocket.Dial(ctx, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &WsClient{
+		conn:          conn,
+		pending:       make(map[int]*pendingCall),
+		subscriptions: make(map[string]*Subscription),
+		done:          make(chan struct{}),
+	}
+	go c.readLoop()
+
+	return c, nil
+}
+
+type wsMessage struct {
+	Id     *int            `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+func (c *WsClient) readLoop() {
+	var err error
+	defer func() {
+		c.mu.Lock()
+		c.err = errors.Join(ErrConnectionClosed, err)
+		for _, sub := range c.subscriptions {
+			close(sub.notifications)
+		}
+		c.subscriptions = nil
+		c.mu.Unlock()
+		close(c.done)
+	}()
+	for {
+		var p []byte
+		if _, p, err = c.conn.ReadMessage(); err != nil {
+			return
+		}
+		var msg wsMessage
+		if err = json.Unmarshal(p, &msg); err != nil {
+			return
+		}
+		if msg.Id == nil {
+			c.notify(msg.Params.Subscription, msg.Params.Result)
+
+			continue
+		}
+		c.mu.Lock()
+		call, ok := c.pending[*msg.Id]
+		delete(c.pending, *msg.Id)
+		if ok && call.subscription != nil && msg.Error == nil {
+			if err = json.Unmarshal(msg.Result, &call.subscription.id); err == nil {
+				c.subscriptions[call.subscription.id] = call.subscription
+			}
+		}
+		c.mu.Unlock()
+		if ok {
+			call.response <- rpcResponse{Id: *msg.Id, Result: msg.Result, Error: msg.Error}
+		}
+	}
+}
+
+// notify - delivers notification, slow subscriber drops the oldest notifications
+func (c *WsClient) notify(id string, result json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sub, ok := c.subscriptions[id]
+	if !ok {
+		return
+	}
+	for {
+		select {
+		case sub.notifications <- result:
+			return
+		default:
+		}
+		select {
+		case <-sub.notifications:
+		default:
+		}
+	}
+}
+
+// Done - closed when connection is lost
+func (c *WsClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err - reason of lost connection
+func (c *WsClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+func (c *WsClient) Close() error {
+	return c.conn.Close()
+}
+
+// Call - sends JSON-RPC request and waits for response
+func (c *WsClient) Call(ctx context.Context, method string, result any, params ...any) error {
+	return c.call(ctx, nil, method, result, params...)
+}
+
+func (c *WsClient) call(ctx context.Context, sub *Subscription, method string, result any, params ...any) error {
+	request := newRequest(method, params...)
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	call := &pendingCall{
+		response:     make(chan rpcResponse, 1),
+		subscription: sub,
+	}
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+
+		return c.err
+	}
+	c.pending[request.Id] = call
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, request.Id)
+		c.mu.Unlock()
+	}()
+	if err = c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return c.Err()
+	case response := <-call.response:
+		if response.Error != nil {
+			return response.Error
+		}
+		if result == nil {
+			return nil
+		}
+
+		return json.Unmarshal(response.Result, result)
+	}
+}
+
+// Subscribe - calls eth_subscribe with given params, e.g. "newHeads"
+func (c *WsClient) Subscribe(ctx context.Context, params ...any) (*Subscription, error) {
+	sub := &Subscription{
+		client:        c,
+		notifications: make(chan json.RawMessage, subscriptionBuffer),
+	}
+	if err := c.call(ctx, sub, "eth_subscribe", nil, params...); err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+func (s *Subscription) ID() string {
+	return s.id
+}
+
+// Notifications - closed when connection is lost
+func (s *Subscription) Notifications() <-chan json.RawMessage {
+	return s.notifications
+}
+
+// Unsubscribe - calls eth_unsubscribe and stops notifications delivery
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	var ok bool
+	if err := s.client.Call(ctx, "eth_unsubscribe", &ok, s.id); err != nil {
+		return err
+	}
+	s.client.mu.Lock()
+	if _, exist := s.client.subscriptions[s.id]; exist {
+		delete(s.client.subscriptions, s.id)
+		close(s.notifications)
+	}
+	s.client.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package ethrpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
+	"github.com/dmitrorezn/tx-parser/pkg/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// newWsNode - starts websocket JSON-RPC node stand-in which pushes given heads after newHeads subscription
+// and drops connection, returns count of subscriptions
+func newWsNode(t *testing.T, heads ...int) (string, *atomic.Int32) {
+	return newWsNodeOf(t, true, heads...)
+}
+
+// newWsNodeOf - node stand-in which keeps connection silently open after pushed heads if drop is not set
+func newWsNodeOf(t *testing.T, drop bool, heads ...int) (string, *atomic.Int32) {
+	var subscriptions atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req Request
+			if err = json.Unmarshal(p, &req); err != nil {
+				return
+			}
+			response := map[string]any{"jsonrpc": jsonRpcVersion, "id": req.Id}
+			switch req.Method {
+			case "eth_subscribe":
+				subID := converter.FormatHexInt(int(subscriptions.Add(1)))
+				response["result"] = subID
+				p, _ = json.Marshal(response)
+				if err = conn.WriteMessage(websocket.TextMessage, p); err != nil {
+					return
+				}
+				for _, head := range heads {
+					p, _ = json.Marshal(map[string]any{
+						"jsonrpc": jsonRpcVersion,
+						"method":  "eth_subscription",
+						"params": map[string]any{
+							"subscription": subID,
+							"result":       map[string]string{"number": converter.FormatHexInt(head)},
+						},
+					})
+					if err = conn.WriteMessage(websocket.TextMessage, p); err != nil {
+						return
+					}
+				}
+				// drop connection to check resubscription
+				if drop {
+					return
+				}
+
+				continue
+			case "eth_unsubscribe":
+				response["result"] = true
+			default:
+				response["error"] = rpcError{Code: -32601, Message: "method not found"}
+			}
+			p, _ = json.Marshal(response)
+			if err = conn.WriteMessage(websocket.TextMessage, p); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), &subscriptions
+}
+
+func TestWsClientSubscribe(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := newWsNode(t, 100, 101)
+
+	client, err := DialWs(ctx, addr)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	sub, err := client.Subscribe(ctx, "newHeads")
+	require.NoError(t, err)
+	require.Equal(t, "0x1", sub.ID())
+
+	var numbers []string
+	for notification := range sub.Notifications() {
+		var head header
+		require.NoError(t, json.Unmarshal(notification, &head))
+		numbers = append(numbers, head.Number)
+	}
+	require.Equal(t, []string{"0x64", "0x65"}, numbers)
+
+	<-client.Done()
+	require.ErrorIs(t, client.Err(), ErrConnectionClosed)
+	require.ErrorIs(t, client.Call(ctx, "eth_blockNumber", nil), ErrConnectionClosed)
+}
+
+func TestHeadsWatcherResubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	addr, subscriptions := newWsNode(t, 100)
+
+	watcher := NewHeadsWatcher(addr, WithReconnectDelay(time.Millisecond, 10*time.Millisecond))
+	go watcher.Run(ctx)
+
+	for range 3 {
+		select {
+		case head := <-watcher.Heads():
+			require.Equal(t, 100, head)
+		case <-time.After(5 * time.Second):
+			t.Fatal("head was not pushed")
+		}
+	}
+	require.GreaterOrEqual(t, subscriptions.Load(), int32(3))
+}
+
+func TestHeadsWatcherIdle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	addr, subscriptions := newWsNodeOf(t, false, 100)
+
+	watcher := NewHeadsWatcher(addr,
+		WithReconnectDelay(time.Millisecond, 10*time.Millisecond),
+		WithIdleTimeout(50*time.Millisecond),
+	)
+	go watcher.Run(ctx)
+
+	// silent connection is redialed and subscribed again
+	require.Eventually(t, func() bool {
+		return subscriptions.Load() >= 3
+	}, 5*time.Second, time.Millisecond)
+}
@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+const (
+	defaultStreamBuffer = 256
+	defaultStreamReplay = 64
+	// defaultStreamRetention - time recent events of address are kept after its last listener is gone
+	defaultStreamRetention = 5 * time.Minute
+)
+
+var (
+	// ErrSlowConsumer - listener was closed because its buffer of undelivered events is full
+	ErrSlowConsumer = errors.New("slow consumer")
+	// ErrStreamClosed - listener was closed by its context or by Close
+	ErrStreamClosed = errors.New("stream closed")
+)
+
+// Hub - fans out transactions matched with addresses to stream listeners,
+// recent events of listened addresses are kept to be replayed on listener resume.
+// Events of addresses which were never listened are not kept, and recent events of address
+// are dropped when it is not listened for retention, only its sequence is kept
+type Hub struct {
+	// epoch - identifies hub instance, sequences of addresses are started over in each epoch
+	epoch  string
+	buffer int
+	replay int
+	retain time.Duration
+
+	mu    sync.Mutex
+	addrs map[domain.Address]*addrEvents
+	// pruned - time recent events of addresses without listeners were last dropped
+	pruned time.Time
+	// blocks - listeners of processed blocks
+	blocks map[*Listener]struct{}
+}
+
+// addrEvents - sequence, recent events and listeners of address
+type addrEvents struct {
+	seq    uint64
+	recent []domain.StreamEvent
+	// listeners - nil when address is not listened
+	listeners map[*Listener]struct{}
+	// idle - time the last listener of address was gone
+	idle time.Time
+}
+
+type HubOption func(*Hub)
+
+// WithReplayRetention - time recent events of address are kept to be replayed after its last listener is gone
+func WithReplayRetention(retain time.Duration) HubOption {
+	return func(h *Hub) {
+		h.retain = max(retain, 0)
+	}
+}
+
+// NewHub - hub with per listener buffer of undelivered events and count of recent events replayed per address
+func NewHub(buffer, replay int, options ...HubOption) *Hub {
+	h := &Hub{
+		epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		buffer: max(buffer, 1),
+		replay: max(replay, 0),
+		retain: defaultStreamRetention,
+		addrs:  make(map[domain.Address]*addrEvents),
+		pruned: time.Now(),
+		blocks: make(map[*Listener]struct{}),
+	}
+	for _, opt := range options {
+		opt(h)
+	}
+
+	return h
+}
+
+type listenOptions struct {
+	blocks bool
+}
+
+type ListenOption func(*listenOptions)
+
+// WithBlockEvents - listener receives events of processed blocks along with transactions
+func WithBlockEvents() ListenOption {
+	return func(o *listenOptions) {
+		o.blocks = true
+	}
+}
+
+// Listener - events of addresses listened through hub
+type Listener struct {
+	hub    *Hub
+	addrs  []domain.Address
+	events chan domain.StreamEvent
+	gaps   []domain.Address
+	cursor domain.StreamCursor
+
+	// stop - stops close of listener on context done
+	stop func() bool
+	done chan struct{}
+	once sync.Once
+	err  error
+}
+
+// Events - events of listened addresses in order of publishing per address
+func (l *Listener) Events() <-chan domain.StreamEvent {
+	return l.events
+}
+
+// Gaps - addresses with events after resume cursor which are not kept by hub anymore,
+// they should be read from stored transactions
+func (l *Listener) Gaps() []domain.Address {
+	return l.gaps
+}
+
+// Cursor - position of hub epoch listener starts from, it is advanced by the caller with received events
+func (l *Listener) Cursor() domain.StreamCursor {
+	return l.cursor
+}
+
+// Done - closed when listener is closed
+func (l *Listener) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err - reason of listener close, ErrSlowConsumer if listener fell behind
+func (l *Listener) Err() error {
+	<-l.done
+
+	return l.err
+}
+
+// Close - stops listening, events buffered before close are still readable from Events
+func (l *Listener) Close() {
+	l.hub.mu.Lock()
+	defer l.hub.mu.Unlock()
+
+	l.hub.remove(l, ErrStreamClosed)
+}
+
+// Add - listens new events of addresses, recent events are not replayed, noop for closed listener
+func (l *Listener) Add(addrs ...domain.Address) {
+	l.hub.mu.Lock()
+	defer l.hub.mu.Unlock()
+
+	if l.closed() {
+		return
+	}
+	for _, addr := range addrs {
+		if slices.Contains(l.addrs, addr) {
+			continue
+		}
+		l.addrs = append(l.addrs, addr)
+		l.hub.listen(addr, l)
+	}
+}
+
+// Remove - stops listening events of addresses, events buffered before remove are still readable
+func (l *Listener) Remove(addrs ...domain.Address) {
+	l.hub.mu.Lock()
+	defer l.hub.mu.Unlock()
+
+	for _, addr := range addrs {
+		l.addrs = slices.DeleteFunc(l.addrs, func(listened domain.Address) bool {
+			return listened == addr
+		})
+		l.hub.unlisten(addr, l)
+	}
+}
+
+// Addresses - listened addresses
+func (l *Listener) Addresses() []domain.Address {
+	l.hub.mu.Lock()
+	defer l.hub.mu.Unlock()
+
+	return slices.Clone(l.addrs)
+}
+
+func (l *Listener) closed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Listen - registers listener of addresses which is closed on ctx done, events after cursor
+// are replayed from recent events, only new events are received without cursor.
+// Sequences of cursor of other epoch are started over, so all kept events of address are replayed
+func (h *Hub) Listen(
+	ctx context.Context,
+	addrs []domain.Address,
+	cursor *domain.StreamCursor,
+	options ...ListenOption,
+) *Listener {
+	var opts listenOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var replayed []domain.StreamEvent
+	l := &Listener{
+		hub:   h,
+		addrs: addrs,
+		cursor: domain.StreamCursor{
+			Epoch: h.epoch,
+			Seqs:  make(map[domain.Address]uint64, len(addrs)),
+		},
+		done: make(chan struct{}),
+	}
+	if opts.blocks {
+		h.blocks[l] = struct{}{}
+	}
+	for _, addr := range addrs {
+		events := h.listen(addr, l)
+		if cursor == nil {
+			l.cursor.Seqs[addr] = events.seq
+
+			continue
+		}
+		last := cursor.Seqs[addr]
+		// events received in previous epoch are followed by lost ones
+		lost := cursor.Epoch != h.epoch && last > 0
+		if cursor.Epoch != h.epoch || last > events.seq {
+			last = 0
+		}
+		oldest := events.seq - uint64(len(events.recent)) + 1
+		if lost || last < events.seq && last+1 < oldest {
+			l.gaps = append(l.gaps, addr)
+		}
+		l.cursor.Seqs[addr] = last
+		for _, event := range events.recent {
+			if event.Seq > last {
+				replayed = append(replayed, event)
+			}
+		}
+	}
+	l.events = make(chan domain.StreamEvent, h.buffer+len(replayed))
+	for _, event := range replayed {
+		l.events <- event
+	}
+	l.stop = context.AfterFunc(ctx, l.Close)
+
+	return l
+}
+
+// Publish - sends event of transaction matched with address to its listeners,
+// listeners with full buffer are closed with ErrSlowConsumer
+func (h *Hub) Publish(addr domain.Address, tx domain.Transaction) {
+	h.publish(domain.StreamEvent{
+		Address:     addr,
+		Transaction: &tx,
+	})
+}
+
+// PublishRemoved - sends event of transaction matched with address and removed from chain by reorganization,
+// it takes the next sequence of address, so resumed listeners receive it after event of transaction
+func (h *Hub) PublishRemoved(addr domain.Address, tx domain.Transaction) {
+	h.publish(domain.StreamEvent{
+		Address:     addr,
+		Transaction: &tx,
+		Removed:     true,
+	})
+}
+
+// publish - sends event of address with the next sequence to its listeners and keeps it to be replayed
+func (h *Hub) publish(event domain.StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.prune(now)
+	events := h.addrEvents(event.Address)
+	events.seq++
+	event.Seq = events.seq
+	if h.replay > 0 && h.retained(events, now) {
+		if len(events.recent) == h.replay {
+			events.recent = append(events.recent[:0], events.recent[1:]...)
+		}
+		events.recent = append(events.recent, event)
+	}
+	h.send(events.listeners, event)
+}
+
+// PublishBlock - sends event of processed block to listeners of blocks
+func (h *Hub) PublishBlock(number int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.send(h.blocks, domain.StreamEvent{
+		Block: number,
+	})
+}
+
+// PublishReorg - sends event of blocks rolled back to common ancestor to listeners of blocks
+func (h *Hub) PublishReorg(ancestor int, orphaned []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.send(h.blocks, domain.StreamEvent{
+		Block:    ancestor,
+		Orphaned: orphaned,
+	})
+}
+
+// send - sends event to listeners, listeners with full buffer are closed with ErrSlowConsumer
+func (h *Hub) send(listeners map[*Listener]struct{}, event domain.StreamEvent) {
+	for l := range listeners {
+		select {
+		case l.events <- event:
+		default:
+			h.remove(l, ErrSlowConsumer)
+		}
+	}
+}
+
+// addrEvents - events of address, created on the first use
+func (h *Hub) addrEvents(addr domain.Address) *addrEvents {
+	events, ok := h.addrs[addr]
+	if !ok {
+		events = &addrEvents{}
+		h.addrs[addr] = events
+	}
+
+	return events
+}
+
+// listen - registers listener of address and returns events of address
+func (h *Hub) listen(addr domain.Address, l *Listener) *addrEvents {
+	events := h.addrEvents(addr)
+	if events.listeners == nil {
+		events.listeners = make(map[*Listener]struct{})
+	}
+	events.listeners[l] = struct{}{}
+
+	return events
+}
+
+// unlisten - unregisters listener of address, retention of address recent events starts with its last listener gone
+func (h *Hub) unlisten(addr domain.Address, l *Listener) {
+	events, ok := h.addrs[addr]
+	if !ok || events.listeners == nil {
+		return
+	}
+	delete(events.listeners, l)
+	if len(events.listeners) == 0 {
+		events.listeners = nil
+		events.idle = time.Now()
+	}
+}
+
+// retained - reports whether recent events of address are kept at now
+func (h *Hub) retained(events *addrEvents, now time.Time) bool {
+	return events.listeners != nil || now.Sub(events.idle) < h.retain
+}
+
+// prune - drops recent events of addresses not listened for retention, at most once per retention
+func (h *Hub) prune(now time.Time) {
+	if now.Sub(h.pruned) < h.retain {
+		return
+	}
+	h.pruned = now
+	for _, events := range h.addrs {
+		if !h.retained(events, now) {
+			events.recent = nil
+		}
+	}
+}
+
+// Forget - drops recent events of address, sequence is kept to not reuse sequence numbers in epoch
+func (h *Hub) Forget(addr domain.Address) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if events, ok := h.addrs[addr]; ok {
+		events.recent = nil
+	}
+}
+
+// remove - unregisters listener and closes it with err, noop for closed listener
+func (h *Hub) remove(l *Listener, err error) {
+	l.once.Do(func() {
+		for _, addr := range l.addrs {
+			h.unlisten(addr, l)
+		}
+		delete(h.blocks, l)
+		l.err = err
+		close(l.done)
+		if l.stop != nil {
+			l.stop()
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/memory"
+	"github.com/dmitrorezn/tx-parser/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// receive - events buffered by listener
+func receive(l *service.Listener) []domain.StreamEvent {
+	var events []domain.StreamEvent
+	for {
+		select {
+		case event := <-l.Events():
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func seqs(events []domain.StreamEvent) []uint64 {
+	result := make([]uint64, 0, len(events))
+	for _, event := range events {
+		result = append(result, event.Seq)
+	}
+
+	return result
+}
+
+func TestHub(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		hub   = service.NewHub(4, 3)
+		addrA = genAddress()
+		addrB = genAddress()
+	)
+	live := hub.Listen(ctx, []domain.Address{addrA, addrB}, nil)
+	for i := range 5 {
+		hub.Publish(addrA, domain.Transaction{Hash: "0xa" + string(rune('0'+i))})
+	}
+	hub.Publish(addrB, domain.Transaction{Hash: "0xb"})
+
+	events := receive(live)
+	require.Len(t, events, 4)
+	require.Equal(t, []uint64{1, 2, 3, 4}, seqs(events))
+	select {
+	case <-live.Done():
+	default:
+		t.Fatal("slow listener is not closed")
+	}
+	require.ErrorIs(t, live.Err(), service.ErrSlowConsumer)
+
+	t.Run("resume", func(t *testing.T) {
+		cursor := live.Cursor()
+		cursor.Seqs[addrA] = 3
+		l := hub.Listen(ctx, []domain.Address{addrA, addrB}, &cursor)
+		defer l.Close()
+
+		require.Empty(t, l.Gaps())
+		events := receive(l)
+		require.Len(t, events, 3)
+		require.Equal(t, addrA, events[0].Address)
+		require.Equal(t, []uint64{4, 5, 1}, seqs(events))
+	})
+	t.Run("gap", func(t *testing.T) {
+		cursor := live.Cursor()
+		cursor.Seqs[addrA] = 1
+		l := hub.Listen(ctx, []domain.Address{addrA}, &cursor)
+		defer l.Close()
+
+		require.Equal(t, []domain.Address{addrA}, l.Gaps())
+		require.Equal(t, []uint64{3, 4, 5}, seqs(receive(l)))
+	})
+	t.Run("other epoch", func(t *testing.T) {
+		cursor := domain.StreamCursor{
+			Epoch: "previous",
+			Seqs:  map[domain.Address]uint64{addrB: 7},
+		}
+		l := hub.Listen(ctx, []domain.Address{addrA, addrB}, &cursor)
+		defer l.Close()
+
+		require.Equal(t, []domain.Address{addrA, addrB}, l.Gaps())
+		require.Equal(t, []uint64{3, 4, 5, 1}, seqs(receive(l)))
+	})
+	t.Run("closed on context done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		l := hub.Listen(ctx, []domain.Address{addrB}, nil)
+		require.Equal(t, uint64(1), l.Cursor().Seqs[addrB])
+		cancel()
+
+		require.ErrorIs(t, l.Err(), service.ErrStreamClosed)
+		hub.Publish(addrB, domain.Transaction{})
+		require.Empty(t, receive(l))
+	})
+	t.Run("cursor", func(t *testing.T) {
+		cursor := live.Cursor()
+		cursor.Seqs[addrA] = 5
+		parsed, err := domain.ParseStreamCursor(cursor.String())
+		require.NoError(t, err)
+		require.Equal(t, cursor, parsed)
+
+		_, err = domain.ParseStreamCursor(string(addrA) + ":1")
+		require.ErrorIs(t, err, domain.ErrInvalidStreamCursor)
+	})
+}
+
+func TestHubRetention(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		retain = 50 * time.Millisecond
+		hub    = service.NewHub(4, 3, service.WithReplayRetention(retain))
+		addrA  = genAddress()
+		addrB  = genAddress()
+	)
+	hub.Publish(addrA, domain.Transaction{})
+	l := hub.Listen(ctx, []domain.Address{addrA, addrB}, nil)
+	cursor := l.Cursor()
+	require.Equal(t, uint64(1), cursor.Seqs[addrA], "sequence of address is kept without listeners")
+
+	hub.Publish(addrB, domain.Transaction{})
+	l.Close()
+	hub.Publish(addrB, domain.Transaction{})
+
+	resumed := hub.Listen(ctx, []domain.Address{addrA, addrB}, &cursor)
+	require.Empty(t, resumed.Gaps())
+	require.Equal(t, []uint64{1, 2}, seqs(receive(resumed)), "events are kept within retention after listener is gone")
+	cursor = resumed.Cursor()
+	cursor.Seqs[addrB] = 2
+	resumed.Close()
+
+	time.Sleep(2 * retain)
+	hub.Publish(addrA, domain.Transaction{})
+	hub.Publish(addrB, domain.Transaction{})
+
+	resumed = hub.Listen(ctx, []domain.Address{addrA, addrB}, &cursor)
+	defer resumed.Close()
+	require.Equal(t, []domain.Address{addrA, addrB}, resumed.Gaps(), "events are dropped after retention")
+	require.Empty(t, receive(resumed))
+
+	hub.Publish(addrB, domain.Transaction{})
+	hub.Forget(addrB)
+	hub.Publish(addrB, domain.Transaction{})
+	events := receive(resumed)
+	require.Equal(t, []uint64{4, 5}, seqs(events), "sequence is kept by forget")
+}
+
+func TestHubWatch(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		hub   = service.NewHub(4, 3)
+		addrA = genAddress()
+		addrB = genAddress()
+	)
+	hub.Publish(addrA, domain.Transaction{})
+	l := hub.Listen(ctx, nil, nil, service.WithBlockEvents())
+	defer l.Close()
+	stream := hub.Listen(ctx, []domain.Address{addrA}, nil)
+	defer stream.Close()
+
+	l.Add(addrA, addrB, addrA)
+	require.ElementsMatch(t, []domain.Address{addrA, addrB}, l.Addresses())
+	require.Empty(t, receive(l), "recent events are not replayed to added address")
+
+	hub.Publish(addrA, domain.Transaction{})
+	hub.PublishBlock(10)
+	events := receive(l)
+	require.Len(t, events, 2)
+	require.Equal(t, uint64(2), events[0].Seq)
+	require.Equal(t, 10, events[1].Block)
+	require.Len(t, receive(stream), 1, "block events are sent to block listeners only")
+
+	l.Remove(addrA)
+	require.Equal(t, []domain.Address{addrB}, l.Addresses())
+	hub.Publish(addrA, domain.Transaction{})
+	hub.Publish(addrB, domain.Transaction{})
+	events = receive(l)
+	require.Len(t, events, 1)
+	require.Equal(t, addrB, events[0].Address)
+
+	for block := range 5 {
+		hub.PublishBlock(block)
+	}
+	require.ErrorIs(t, l.Err(), service.ErrSlowConsumer)
+	l.Add(addrA)
+	require.Equal(t, []domain.Address{addrB}, l.Addresses(), "closed listener is not extended")
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		chain = &ChainClient{}
+		addr  = genAddress()
+		cfg   = service.NewConfig(100*time.Millisecond, 10)
+		svc   = service.NewService(chain, memory.NewBlockNumberStorage(), memory.NewStorage(), logger.NewAttrLogger(logger.NewLogger()), cfg)
+	)
+	_, err := svc.Stream(ctx, []domain.Address{addr}, nil)
+	require.ErrorIs(t, err, domain.ErrAddressNotSubscribed)
+	_, err = svc.Stream(ctx, nil, nil)
+	require.ErrorIs(t, err, domain.ErrInvalidAddress)
+
+	require.NoError(t, svc.Subscribe(ctx, addr))
+	l, err := svc.Stream(ctx, []domain.Address{addr, addr}, nil)
+	require.NoError(t, err)
+	defer l.Close()
+	watch := svc.Watch(ctx)
+	defer watch.Close()
+
+	for number := range 2 {
+		chain.Extend(number, "a", 1, addr)
+		_, err = svc.ProcessTransactions(ctx)
+		require.NoError(t, err)
+	}
+
+	events := receive(l)
+	require.Equal(t, []uint64{1, 2}, seqs(events))
+	require.Equal(t, addr, events[0].Address)
+	require.Equal(t, addr, events[0].Transaction.From)
+	events = receive(watch)
+	require.Len(t, events, 2)
+	require.Equal(t, []int{1, 2}, []int{events[0].Block, events[1].Block})
+}
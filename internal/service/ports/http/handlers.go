@@ -1,10 +1,18 @@
 package httpport
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/dmitrorezn/tx-parser/internal/domain"
 	"github.com/dmitrorezn/tx-parser/internal/service"
@@ -12,22 +20,113 @@ import (
 
 type Handler struct {
 	service service.Servicer
+	// adminToken - bearer token of admin endpoints, admin endpoints are disabled if empty
+	adminToken string
+	// heartbeat - interval of comments sent to idle streams
+	heartbeat time.Duration
+	// wsOrigins - cross origins allowed to open websocket besides the same origin
+	wsOrigins []string
+	// closed - closed on server shutdown to end streams
+	closed    chan struct{}
+	closeOnce sync.Once
 	http.Handler
 }
 
+type HandlerOption func(*Handler)
+
+// WithAdminToken - enables admin endpoints authorized with bearer token
+func WithAdminToken(token string) HandlerOption {
+	return func(h *Handler) {
+		h.adminToken = token
+	}
+}
+
+// WithStreamHeartbeat - interval of heartbeat comments keeping idle streams open through proxies
+func WithStreamHeartbeat(interval time.Duration) HandlerOption {
+	return func(h *Handler) {
+		if interval > 0 {
+			h.heartbeat = interval
+		}
+	}
+}
+
+// WithWSAllowedOrigins - origins of pages allowed to open websocket besides the same origin, "*" allows any
+func WithWSAllowedOrigins(origins ...string) HandlerOption {
+	return func(h *Handler) {
+		h.wsOrigins = append(h.wsOrigins, origins...)
+	}
+}
+
 const (
+	defaultHeartbeat = 15 * time.Second
+	// streamWriteTimeout - max duration of stream write, consumer not reading stream is disconnected
+	streamWriteTimeout = 10 * time.Second
+
 	addressParam = "address"
+	hashParam    = "hash"
+	idParam      = "id"
+
+	afterQuery     = "after"
+	beforeQuery    = "before"
+	fromBlockQuery = "fromBlock"
+	limitQuery     = "limit"
+	toBlockQuery   = "toBlock"
+	directionQuery = "direction"
+	minValueQuery  = "minValue"
+	statusQuery    = "status"
+	orderQuery     = "order"
+	tokenQuery     = "token"
+	addressQuery   = "address"
+	// lastEventIDQuery - Last-Event-ID of clients which can not set headers
+	lastEventIDQuery = "lastEventId"
+
+	lastEventIDHeader = "Last-Event-ID"
+
+	// NextCursorHeader - cursor to continue transactions read with, returned as after query parameter
+	NextCursorHeader = "X-Next-Cursor"
+	// NextTokenHeader - continuation token of the next page of transactions, returned as token query parameter
+	// instead of all other parameters, empty if page is not full
+	NextTokenHeader = "X-Next-Token"
 )
 
-func NewHandler(svc service.Servicer) *Handler {
+var (
+	ErrInvalidQuery = errors.New("invalid query")
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+func NewHandler(svc service.Servicer, options ...HandlerOption) *Handler {
 	h := &Handler{
-		service: svc,
+		service:   svc,
+		heartbeat: defaultHeartbeat,
+		closed:    make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt(h)
 	}
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /current-block", h.GetCurrentBlock)
 	mux.HandleFunc("POST /subscribe", h.Subscribe)
+	mux.HandleFunc("GET /subscriptions", h.ListSubscriptions)
+	mux.HandleFunc(fmt.Sprintf("GET /subscriptions/{%s}", addressParam), h.GetSubscription)
+	mux.HandleFunc(fmt.Sprintf("DELETE /subscriptions/{%s}", addressParam), h.Unsubscribe)
+	mux.HandleFunc(fmt.Sprintf("PUT /subscriptions/{%s}/webhook", addressParam), h.SetWebhook)
+	mux.HandleFunc(fmt.Sprintf("GET /subscriptions/{%s}/webhook", addressParam), h.GetWebhook)
+	mux.HandleFunc(fmt.Sprintf("DELETE /subscriptions/{%s}/webhook", addressParam), h.DelWebhook)
 	mux.HandleFunc(fmt.Sprintf("GET /transactions/{%s}", addressParam), h.GetTransactions)
+	mux.HandleFunc(fmt.Sprintf("POST /transactions/{%s}/ack", addressParam), h.AckTransactions)
+	mux.HandleFunc("GET /transactions", h.GetTransactionsInRange)
+	mux.HandleFunc(fmt.Sprintf("GET /tx/{%s}", hashParam), h.GetTransactionByHash)
+	mux.HandleFunc("GET /stream/transactions", h.StreamTransactions)
+	mux.HandleFunc("GET /ws", h.WS)
+	if h.adminToken != "" {
+		mux.HandleFunc("GET /admin/export", h.admin(h.Export))
+		mux.HandleFunc("POST /admin/import", h.admin(h.Import))
+		mux.HandleFunc("GET /admin/deliveries/dead", h.admin(h.DeadDeliveries))
+		mux.HandleFunc("POST /admin/deliveries/dead/replay", h.admin(h.ReplayDeadDeliveries))
+		mux.HandleFunc(fmt.Sprintf("GET /admin/deliveries/{%s}", idParam), h.admin(h.GetDelivery))
+		mux.HandleFunc(fmt.Sprintf("POST /admin/deliveries/{%s}/replay", idParam), h.admin(h.ReplayDelivery))
+	}
 
 	h.Handler = mux
 
@@ -61,6 +160,91 @@ var errorsList = []errorStatus{
 		statusCode: http.StatusBadRequest,
 		msg:        "invalid address",
 	},
+	{
+		err:        domain.ErrInvalidRetention,
+		statusCode: http.StatusBadRequest,
+		msg:        "invalid retention",
+	},
+	{
+		err:        domain.ErrRetentionNotSupported,
+		statusCode: http.StatusNotImplemented,
+		msg:        "retention not supported",
+	},
+	{
+		err:        domain.ErrInvalidWebhook,
+		statusCode: http.StatusBadRequest,
+		msg:        "invalid webhook",
+	},
+	{
+		err:        domain.ErrWebhookNotSupported,
+		statusCode: http.StatusNotImplemented,
+		msg:        "webhooks not supported",
+	},
+	{
+		err:        domain.ErrWebhookNotFound,
+		statusCode: http.StatusNotFound,
+		msg:        "not found webhook",
+	},
+	{
+		err:        domain.ErrDeliveryNotFound,
+		statusCode: http.StatusNotFound,
+		msg:        "not found delivery",
+	},
+	{
+		err:        domain.ErrDeliveryNotDead,
+		statusCode: http.StatusConflict,
+		msg:        "delivery is not dead",
+	},
+	{
+		err:        domain.ErrTransactionNotFound,
+		statusCode: http.StatusNotFound,
+		msg:        "not found transaction",
+	},
+	{
+		err:        domain.ErrInvalidBlockRange,
+		statusCode: http.StatusBadRequest,
+		msg:        "invalid block range",
+	},
+	{
+		err:        domain.ErrInvalidSnapshot,
+		statusCode: http.StatusBadRequest,
+		msg:        "invalid snapshot",
+	},
+	{
+		err:        domain.ErrUnsupportedSnapshot,
+		statusCode: http.StatusBadRequest,
+		msg:        "unsupported snapshot version",
+	},
+	{
+		err:        ErrUnauthorized,
+		statusCode: http.StatusUnauthorized,
+		msg:        "unauthorized",
+	},
+	{
+		err:        domain.ErrInvalidTxQuery,
+		statusCode: http.StatusBadRequest,
+		msg:        "invalid transactions query",
+	},
+	{
+		err:        domain.ErrInvalidStreamCursor,
+		statusCode: http.StatusBadRequest,
+		msg:        "invalid stream cursor",
+	},
+	{
+		err:        ErrInvalidWSMessage,
+		statusCode: http.StatusBadRequest,
+		msg:        "invalid message",
+	},
+	{
+		err:        ErrTooManyAddresses,
+		statusCode: http.StatusBadRequest,
+		msg:        "too many watched addresses",
+	},
+	{
+		err:        ErrInvalidQuery,
+		statusCode: http.StatusBadRequest,
+		msg:        "invalid query",
+	},
 }
 
 type ErrorResponse struct {
@@ -115,6 +299,33 @@ func (h *Handler) GetCurrentBlock(w http.ResponseWriter, _ *http.Request) {
 
 type SubscribeRequest struct {
 	Address string `json:"address"`
+	// Retention - overrides global retention of address transactions
+	Retention *Retention `json:"retention,omitempty"`
+	// Webhook - endpoint notified with signed POST of each matched transaction
+	Webhook *domain.Webhook `json:"webhook,omitempty"`
+}
+
+type Retention struct {
+	MaxTxs    int `json:"maxTxs,omitempty"`
+	MaxBlocks int `json:"maxBlocks,omitempty"`
+	// MaxAge - duration string, e.g. "24h"
+	MaxAge string `json:"maxAge,omitempty"`
+}
+
+func (r Retention) toDomain() (domain.Retention, error) {
+	retention := domain.Retention{
+		MaxTxs:    r.MaxTxs,
+		MaxBlocks: r.MaxBlocks,
+	}
+	if r.MaxAge != "" {
+		maxAge, err := time.ParseDuration(r.MaxAge)
+		if err != nil {
+			return domain.Retention{}, errors.Join(domain.ErrInvalidRetention, err)
+		}
+		retention.MaxAge = maxAge
+	}
+
+	return retention, nil
 }
 
 func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
@@ -124,8 +335,21 @@ func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 
 		return
 	}
+	var options []service.SubscribeOption
+	if request.Retention != nil {
+		retention, err := request.Retention.toDomain()
+		if err != nil {
+			handleError(w, err)
+
+			return
+		}
+		options = append(options, service.WithRetention(retention))
+	}
+	if request.Webhook != nil {
+		options = append(options, service.WithWebhook(*request.Webhook))
+	}
 	addr := domain.Address(request.Address)
-	if err := h.service.Subscribe(r.Context(), addr); err != nil {
+	if err := h.service.Subscribe(r.Context(), addr, options...); err != nil {
 		handleError(w, err)
 
 		return
@@ -134,14 +358,369 @@ func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+type UnsubscribeResponse struct {
+	// Removed - count of removed transactions of address, 0 if transactions are kept
+	Removed int `json:"removed"`
+}
+
+func (h *Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	removed, err := h.service.Unsubscribe(r.Context(), domain.Address(r.PathValue(addressParam)))
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UnsubscribeResponse{
+		Removed: removed,
+	})
+}
+
+func (h *Handler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.service.GetSubscription(r.Context(), domain.Address(r.PathValue(addressParam)))
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sub)
+}
+
+// ListSubscriptions - subscriptions ordered by address, the next page is read with address
+// of NextCursorHeader as after query parameter, header is empty on the last page
+func (h *Handler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	var (
+		values = r.URL.Query()
+		query  = domain.SubscriptionQuery{
+			After: domain.Address(values.Get(afterQuery)),
+		}
+	)
+	if v := values.Get(limitQuery); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			handleError(w, errors.Join(ErrInvalidQuery, err))
+
+			return
+		}
+		query.Limit = limit
+	}
+	page, err := h.service.ListSubscriptions(r.Context(), query)
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+	if page.Subscriptions == nil {
+		page.Subscriptions = []domain.Subscription{}
+	}
+
+	w.Header().Set(NextCursorHeader, string(page.Next))
+	writeJSON(w, http.StatusOK, page.Subscriptions)
+}
+
 func (h *Handler) GetTransactions(w http.ResponseWriter, r *http.Request) {
 	addr := domain.Address(r.PathValue(addressParam))
-	txs, err := h.service.GetTransactions(r.Context(), addr)
+	query, err := parseTxQuery(r.URL.Query())
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+	page, err := h.service.GetTransactions(r.Context(), addr, query)
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	// page after cursor is empty when client reached the end of data
+	if page.Transactions == nil {
+		page.Transactions = []domain.Transaction{}
+	}
+	w.Header().Set(NextCursorHeader, strconv.FormatUint(page.Next, 10))
+	w.Header().Set(NextTokenHeader, page.NextToken)
+	writeJSON(w, http.StatusOK, page.Transactions)
+}
+
+// parseTxQuery - query of continuation token or of cursor and filters parameters
+func parseTxQuery(values url.Values) (domain.TxQuery, error) {
+	if token := values.Get(tokenQuery); token != "" {
+		return domain.ParseTxQueryToken(token)
+	}
+	query := domain.TxQuery{
+		Direction: domain.Direction(values.Get(directionQuery)),
+		Status:    domain.TxResult(values.Get(statusQuery)),
+		Order:     domain.TxOrder(values.Get(orderQuery)),
+	}
+	for name, cursor := range map[string]*uint64{afterQuery: &query.After, beforeQuery: &query.Before} {
+		if v := values.Get(name); v != "" {
+			seq, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return domain.TxQuery{}, errors.Join(ErrInvalidQuery, err)
+			}
+			*cursor = seq
+		}
+	}
+	for name, number := range map[string]*int{fromBlockQuery: &query.FromBlock, toBlockQuery: &query.ToBlock, limitQuery: &query.Limit} {
+		if v := values.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return domain.TxQuery{}, errors.Join(ErrInvalidQuery, err)
+			}
+			*number = n
+		}
+	}
+	// min value is decimal or 0x prefixed hex
+	if v := values.Get(minValueQuery); v != "" {
+		minValue, ok := new(big.Int).SetString(v, 0)
+		if !ok {
+			return domain.TxQuery{}, fmt.Errorf("%w: min value %s", ErrInvalidQuery, v)
+		}
+		query.MinValue = minValue
+	}
+
+	return query, query.Validate()
+}
+
+type AckRequest struct {
+	// UpTo - cursor of the last processed transaction
+	UpTo uint64 `json:"upTo"`
+}
+
+type AckResponse struct {
+	Removed int `json:"removed"`
+}
+
+func (h *Handler) AckTransactions(w http.ResponseWriter, r *http.Request) {
+	addr := domain.Address(r.PathValue(addressParam))
+	var request AckRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		handleError(w, err)
+
+		return
+	}
+	removed, err := h.service.AckTransactions(r.Context(), addr, request.UpTo)
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AckResponse{
+		Removed: removed,
+	})
+}
+
+func (h *Handler) GetTransactionByHash(w http.ResponseWriter, r *http.Request) {
+	matched, err := h.service.GetTransactionByHash(r.Context(), r.PathValue(hashParam))
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, matched)
+}
+
+func (h *Handler) GetTransactionsInRange(w http.ResponseWriter, r *http.Request) {
+	var (
+		values = r.URL.Query()
+		blocks [2]int
+	)
+	for i, name := range []string{fromBlockQuery, toBlockQuery} {
+		number, err := strconv.Atoi(values.Get(name))
+		if err != nil {
+			handleError(w, errors.Join(ErrInvalidQuery, err))
+
+			return
+		}
+		blocks[i] = number
+	}
+	matched, err := h.service.GetTransactionsInRange(r.Context(), blocks[0], blocks[1])
 	if err != nil {
 		handleError(w, err)
 
 		return
 	}
+	if matched == nil {
+		matched = []domain.MatchedTx{}
+	}
+
+	writeJSON(w, http.StatusOK, matched)
+}
+
+// admin - authorizes request with bearer admin token
+func (h *Handler) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			handleError(w, ErrUnauthorized)
 
-	writeJSON(w, http.StatusOK, txs)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Export - streams JSONL snapshot
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if _, err := h.service.Export(r.Context(), w); err != nil {
+		// status is already sent, aborted response marks snapshot as incomplete
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.Import(r.Context(), r.Body)
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// Close - ends open streams, called on server shutdown
+func (h *Handler) Close() {
+	h.closeOnce.Do(func() {
+		close(h.closed)
+	})
+}
+
+const (
+	transactionEvent = "transaction"
+	// removedEvent - transaction of previous transaction event removed from chain by reorganization
+	removedEvent = "removed"
+	gapEvent     = "gap"
+	errorEvent   = "error"
+)
+
+// GapEvent - transactions of address after resumed position are not kept by stream anymore,
+// they should be read from stored transactions
+type GapEvent struct {
+	Address domain.Address `json:"address"`
+}
+
+// StreamTransactions - Server-Sent Events stream of transactions matched with subscribed addresses of
+// address query parameters, each event id is cursor of stream resumed with Last-Event-ID header.
+// Transactions removed from chain by reorganization are sent as removed events to retract them.
+// Consumer which falls behind is sent error event and disconnected
+func (h *Handler) StreamTransactions(w http.ResponseWriter, r *http.Request) {
+	var (
+		values = r.URL.Query()
+		addrs  []domain.Address
+		cursor *domain.StreamCursor
+	)
+	for _, v := range values[addressQuery] {
+		for _, addr := range strings.Split(v, ",") {
+			addrs = append(addrs, domain.Address(strings.TrimSpace(addr)))
+		}
+	}
+	lastEventID := r.Header.Get(lastEventIDHeader)
+	if lastEventID == "" {
+		lastEventID = values.Get(lastEventIDQuery)
+	}
+	if lastEventID != "" {
+		parsed, err := domain.ParseStreamCursor(lastEventID)
+		if err != nil {
+			handleError(w, err)
+
+			return
+		}
+		cursor = &parsed
+	}
+	listener, err := h.service.Stream(r.Context(), addrs, cursor)
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+	defer listener.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	var (
+		rc       = http.NewResponseController(w)
+		position = listener.Cursor()
+		// send - writes stream chunk with deadline and flushes it
+		send = func(write func(w io.Writer) error) bool {
+			_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+
+			return write(w) == nil && rc.Flush() == nil
+		}
+	)
+	if !send(func(w io.Writer) error {
+		_, err := io.WriteString(w, ": connected\n\n")
+
+		return err
+	}) {
+		return
+	}
+	for _, addr := range listener.Gaps() {
+		if !send(writeEvent(gapEvent, position.String(), GapEvent{Address: addr})) {
+			return
+		}
+	}
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.closed:
+			return
+		case <-heartbeat.C:
+			if !send(func(w io.Writer) error {
+				_, err := io.WriteString(w, ": heartbeat\n\n")
+
+				return err
+			}) {
+				return
+			}
+		case event := <-listener.Events():
+			position.Seqs[event.Address] = event.Seq
+			name := transactionEvent
+			if event.Removed {
+				name = removedEvent
+			}
+			if !send(writeEvent(name, position.String(), event)) {
+				return
+			}
+		case <-listener.Done():
+			if err = listener.Err(); errors.Is(err, service.ErrSlowConsumer) {
+				send(writeEvent(errorEvent, "", ErrorResponse{
+					Err: err.Error(),
+					Msg: "stream is behind, resume with the last event id",
+				}))
+			}
+
+			return
+		}
+	}
+}
+
+// writeEvent - writer of SSE event with JSON data, id is not sent if empty
+func writeEvent(event, id string, data any) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		p, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			if _, err = fmt.Fprintf(w, "id: %s\n", id); err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, p)
+
+		return err
+	}
 }
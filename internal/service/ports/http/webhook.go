@@ -0,0 +1,127 @@
+package httpport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+// WebhookResponse - webhook of subscription, secret is not returned
+type WebhookResponse struct {
+	URL string `json:"url"`
+}
+
+// SetWebhook - sets or replaces webhook of subscribed address
+func (h *Handler) SetWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook domain.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		handleError(w, errors.Join(domain.ErrInvalidWebhook, err))
+
+		return
+	}
+	if err := h.service.SetWebhook(r.Context(), domain.Address(r.PathValue(addressParam)), webhook); err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, err := h.service.GetWebhook(r.Context(), domain.Address(r.PathValue(addressParam)))
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, WebhookResponse{
+		URL: webhook.URL,
+	})
+}
+
+func (h *Handler) DelWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DelWebhook(r.Context(), domain.Address(r.PathValue(addressParam))); err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeadDeliveries - deliveries which failed all attempts ordered by id, the next page is read with id
+// of NextCursorHeader as after query parameter, header is empty on the last page
+func (h *Handler) DeadDeliveries(w http.ResponseWriter, r *http.Request) {
+	var (
+		values = r.URL.Query()
+		query  = domain.DeliveryQuery{
+			After: values.Get(afterQuery),
+		}
+	)
+	if v := values.Get(limitQuery); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			handleError(w, errors.Join(ErrInvalidQuery, err))
+
+			return
+		}
+		query.Limit = limit
+	}
+	page, err := h.service.DeadDeliveries(r.Context(), query)
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+	if page.Deliveries == nil {
+		page.Deliveries = []domain.Delivery{}
+	}
+
+	w.Header().Set(NextCursorHeader, page.Next)
+	writeJSON(w, http.StatusOK, page.Deliveries)
+}
+
+func (h *Handler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.service.GetDelivery(r.Context(), r.PathValue(idParam))
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+// ReplayDelivery - moves dead delivery back to queue
+func (h *Handler) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.ReplayDelivery(r.Context(), r.PathValue(idParam)); err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type ReplayResponse struct {
+	Replayed int `json:"replayed"`
+}
+
+// ReplayDeadDeliveries - moves all dead deliveries back to queue
+func (h *Handler) ReplayDeadDeliveries(w http.ResponseWriter, r *http.Request) {
+	replayed, err := h.service.ReplayDeadDeliveries(r.Context())
+	if err != nil {
+		handleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ReplayResponse{
+		Replayed: replayed,
+	})
+}
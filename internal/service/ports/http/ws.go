@@ -0,0 +1,219 @@
+package httpport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/pkg/websocket"
+)
+
+const (
+	// maxWSAddresses - max count of addresses watched by websocket connection
+	maxWSAddresses = 1000
+	// maxWSMessageSize - max size of client message
+	maxWSMessageSize = 64 << 10
+)
+
+// WSMessageType - type of /ws protocol message
+type WSMessageType string
+
+const (
+	// WSSubscribe - client subscribes addresses and watches their transactions, acknowledged with the same message
+	WSSubscribe WSMessageType = "subscribe"
+	// WSUnsubscribe - client stops watching addresses, subscriptions are kept, acknowledged with the same message
+	WSUnsubscribe WSMessageType = "unsubscribe"
+	// WSPing - client ping answered with ping of the same id
+	WSPing WSMessageType = "ping"
+	// WSTx - transaction matched with watched address
+	WSTx WSMessageType = "tx"
+	// WSRemoved - transaction of tx message removed from chain by reorganization, alert of it should be retracted
+	WSRemoved WSMessageType = "removed"
+	// WSBlock - processed block, sent after transactions of block
+	WSBlock WSMessageType = "block"
+	// WSReorg - blocks rolled back to common ancestor, sent after removed messages of their transactions
+	WSReorg WSMessageType = "reorg"
+	// WSError - error of client message or of connection before it is closed
+	WSError WSMessageType = "error"
+)
+
+var (
+	ErrInvalidWSMessage = errors.New("invalid websocket message")
+	ErrTooManyAddresses = errors.New("too many watched addresses")
+)
+
+// WSMessage - message of /ws protocol, fields are set depending on message type
+type WSMessage struct {
+	Type WSMessageType `json:"type"`
+	// ID - optional id of client message returned in reply to it
+	ID string `json:"id,omitempty"`
+	// Addresses - addresses of subscribe and unsubscribe messages
+	Addresses []domain.Address `json:"addresses,omitempty"`
+	// Address, Seq, Transaction - matched transaction of tx and removed messages, Seq as in transactions stream
+	Address     domain.Address      `json:"address,omitempty"`
+	Seq         uint64              `json:"seq,omitempty"`
+	Transaction *domain.Transaction `json:"transaction,omitempty"`
+	// Block - number of block message, common ancestor of reorg message
+	Block int `json:"block,omitempty"`
+	// Orphaned - hashes of blocks rolled back by reorg message from the highest one
+	Orphaned []string `json:"orphaned,omitempty"`
+	// Error, Msg - error message details
+	Error string `json:"error,omitempty"`
+	Msg   string `json:"msg,omitempty"`
+}
+
+// WS - websocket of processed blocks and transactions of addresses watched by connection, client
+// messages subscribe and unsubscribe addresses. Connection falling behind is sent error and closed,
+// connection of page from not allowed origin is rejected with 403
+func (h *Handler) WS(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r, websocket.WithAllowedOrigins(h.wsOrigins...))
+	if err != nil {
+		// upgrade replies with error status itself
+		return
+	}
+	defer conn.Close()
+	conn.SetMaxMessageSize(maxWSMessageSize)
+
+	// request context is not canceled for hijacked connection
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := h.service.Watch(ctx)
+	send := func(msg WSMessage) error {
+		p, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+
+		return conn.WriteMessage(websocket.TextMessage, p)
+	}
+	go func() {
+		defer cancel()
+
+		for {
+			_, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = send(h.handleWSMessage(ctx, listener, p)); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.closed:
+			return
+		case <-heartbeat.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err = conn.Ping(nil); err != nil {
+				return
+			}
+		case event := <-listener.Events():
+			msg := WSMessage{
+				Type:  WSBlock,
+				Block: event.Block,
+			}
+			switch {
+			case event.Transaction != nil:
+				msg = WSMessage{
+					Type:        WSTx,
+					Address:     event.Address,
+					Seq:         event.Seq,
+					Transaction: event.Transaction,
+				}
+				if event.Removed {
+					msg.Type = WSRemoved
+				}
+			case event.Orphaned != nil:
+				msg.Type = WSReorg
+				msg.Orphaned = event.Orphaned
+			}
+			if err = send(msg); err != nil {
+				return
+			}
+		case <-listener.Done():
+			if err = listener.Err(); errors.Is(err, service.ErrSlowConsumer) {
+				_ = send(WSMessage{
+					Type:  WSError,
+					Error: err.Error(),
+					Msg:   "connection is behind, reconnect and read missed transactions",
+				})
+			}
+
+			return
+		}
+	}
+}
+
+// handleWSMessage - applies client message to listener and returns reply
+func (h *Handler) handleWSMessage(ctx context.Context, listener *service.Listener, p []byte) WSMessage {
+	var msg WSMessage
+	if err := json.Unmarshal(p, &msg); err != nil {
+		return wsError(msg, errors.Join(ErrInvalidWSMessage, err))
+	}
+	reply := WSMessage{
+		Type:      msg.Type,
+		ID:        msg.ID,
+		Addresses: msg.Addresses,
+	}
+	switch msg.Type {
+	case WSPing:
+		reply.Addresses = nil
+	case WSSubscribe:
+		if len(msg.Addresses) == 0 {
+			return wsError(msg, fmt.Errorf("%w: no addresses", ErrInvalidWSMessage))
+		}
+		added := make(map[domain.Address]struct{}, len(msg.Addresses))
+		for _, addr := range append(listener.Addresses(), msg.Addresses...) {
+			added[addr] = struct{}{}
+		}
+		if len(added) > maxWSAddresses {
+			return wsError(msg, ErrTooManyAddresses)
+		}
+		for _, addr := range msg.Addresses {
+			err := h.service.Subscribe(ctx, addr)
+			if err != nil && !errors.Is(err, domain.ErrAddressAlreadySubscribed) {
+				return wsError(msg, err)
+			}
+			listener.Add(addr)
+		}
+	case WSUnsubscribe:
+		listener.Remove(msg.Addresses...)
+	default:
+		return wsError(msg, fmt.Errorf("%w: unknown type %q", ErrInvalidWSMessage, msg.Type))
+	}
+
+	return reply
+}
+
+// wsError - error reply to client message with status message of HTTP API errors
+func wsError(msg WSMessage, err error) WSMessage {
+	reply := WSMessage{
+		Type:  WSError,
+		ID:    msg.ID,
+		Error: err.Error(),
+		Msg:   "UNKNOWN ERROR",
+	}
+	for _, e := range errorsList {
+		if errors.Is(err, e.err) {
+			reply.Msg = e.msg
+
+			break
+		}
+	}
+
+	return reply
+}
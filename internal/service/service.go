@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,9 +21,47 @@ type Servicer interface {
 	// GetCurrentBlock - last parsed block
 	GetCurrentBlock() int
 	// Subscribe - add address to observer
-	Subscribe(ctx context.Context, address domain.Address) error
-	// GetTransactions -  list of inbound or outbound transactions for an address
-	GetTransactions(ctx context.Context, address domain.Address) ([]domain.Transaction, error)
+	Subscribe(ctx context.Context, address domain.Address, options ...SubscribeOption) error
+	// Unsubscribe - removes address from observer, stored transactions of address are removed
+	// if service is configured to purge them, returns count of removed transactions
+	Unsubscribe(ctx context.Context, address domain.Address) (int, error)
+	// ListSubscriptions - subscriptions ordered by address read after query cursor
+	ListSubscriptions(ctx context.Context, query domain.SubscriptionQuery) (domain.SubscriptionPage, error)
+	// GetSubscription - subscription of address with counters of its matched transactions
+	GetSubscription(ctx context.Context, address domain.Address) (domain.Subscription, error)
+	// Stream - listener of transactions matched with subscribed addresses from now on or after cursor,
+	// listener is closed on ctx done or with ErrSlowConsumer when it falls behind
+	Stream(ctx context.Context, addresses []domain.Address, cursor *domain.StreamCursor) (*Listener, error)
+	// SetWebhook - sets webhook notified with signed POST of each transaction matched with subscribed address
+	SetWebhook(ctx context.Context, address domain.Address, webhook domain.Webhook) error
+	// GetWebhook - webhook of subscribed address or domain.ErrWebhookNotFound
+	GetWebhook(ctx context.Context, address domain.Address) (domain.Webhook, error)
+	// DelWebhook - removes webhook of subscribed address
+	DelWebhook(ctx context.Context, address domain.Address) error
+	// GetDelivery - queued or dead webhook delivery with its failed attempts
+	GetDelivery(ctx context.Context, id string) (domain.Delivery, error)
+	// DeadDeliveries - deliveries which failed all attempts ordered by id read after query cursor
+	DeadDeliveries(ctx context.Context, query domain.DeliveryQuery) (DeliveryPage, error)
+	// ReplayDelivery - moves dead delivery back to queue
+	ReplayDelivery(ctx context.Context, id string) error
+	// ReplayDeadDeliveries - moves all dead deliveries back to queue, returns count of replayed
+	ReplayDeadDeliveries(ctx context.Context) (int, error)
+	// Watch - listener of processed blocks which subscribed addresses are added to and removed from by caller,
+	// listener is closed on ctx done or with ErrSlowConsumer when it falls behind
+	Watch(ctx context.Context) *Listener
+	// GetTransactions -  list of inbound or outbound transactions for an address read from query cursor
+	// in query order and filtered by query, transactions are retained until acknowledged
+	GetTransactions(ctx context.Context, address domain.Address, query domain.TxQuery) (domain.TxPage, error)
+	// AckTransactions - removes address transactions read up to cursor and returns count of removed
+	AckTransactions(ctx context.Context, address domain.Address, upTo uint64) (int, error)
+	// GetTransactionByHash - stored records of transaction with subscribers they were matched with
+	GetTransactionByHash(ctx context.Context, hash string) ([]domain.MatchedTx, error)
+	// GetTransactionsInRange - stored transactions of all subscribers in blocks range [fromBlock, toBlock]
+	GetTransactionsInRange(ctx context.Context, fromBlock, toBlock int) ([]domain.MatchedTx, error)
+	// Export - writes checkpoint, subscribers and stored transactions as versioned JSONL snapshot
+	Export(ctx context.Context, w io.Writer) (ExportStats, error)
+	// Import - stores subscribers, transactions and checkpoint of JSONL snapshot written by Export
+	Import(ctx context.Context, r io.Reader) (ImportStats, error)
 	// ProcessTransactions - defines current blockchain height and starting processing transactions in range
 	// prevBlockNumber from last processed block and skips processing if all txs from block are already processed
 	ProcessTransactions(ctx context.Context) (bool, error)
@@ -28,7 +69,17 @@ type Servicer interface {
 
 type Client interface {
 	GetBlockNumber(ctx context.Context) (int, error)
-	GetBlockTxsByNumber(ctx context.Context, number int) ([]domain.Transaction, error)
+	GetBlockNumberByTag(ctx context.Context, tag domain.BlockTag) (int, error)
+	GetBlockByNumber(ctx context.Context, number int) (domain.Block, error)
+	GetBlockReceipts(ctx context.Context, number int, txHashes []string) ([]domain.Receipt, error)
+	// GetBlockInternalTxs - value bearing internal calls of block transactions from node tracer
+	GetBlockInternalTxs(ctx context.Context, number int) ([]domain.Transaction, error)
+}
+
+// RangeClient - client which fetches range of blocks with less round trips,
+// returns blocks in order till the first failed one
+type RangeClient interface {
+	GetBlocksByRange(ctx context.Context, from, to int) ([]domain.Block, error)
 }
 
 type BlocksStorage interface {
@@ -37,13 +88,76 @@ type BlocksStorage interface {
 	DelLastProcessedTxIndex(blockNumber int)
 	GetLastProcessedTxIndex(block int) (int, bool)
 	SetLastProcessedTxIndex(block int, idx int)
+	// GetBlockHash - hash of processed block, kept for the last reorg depth blocks
+	GetBlockHash(block int) (string, bool)
+	SetBlockHash(block int, hash string)
+	DelBlockHash(block int)
+}
+
+// FallibleBlocksStorage - blocks storage backed by durable or remote store, failures of its methods
+// are reported by Err, so processing stops instead of moving on with zero values
+type FallibleBlocksStorage interface {
+	BlocksStorage
+	// Err - the first failure since the previous call, cleared by the call
+	Err() error
 }
 
 type Storage interface {
 	AddSubscriber(ctx context.Context, addr domain.Address) error
+	// Unsubscribe - removes subscriber, transactions of address are removed if purge is set,
+	// returns count of removed transactions or domain.ErrAddressNotSubscribed
+	Unsubscribe(ctx context.Context, addr domain.Address, purge bool) (int, error)
+	// GetSubscription - subscription of address or domain.ErrAddressNotSubscribed
+	GetSubscription(ctx context.Context, addr domain.Address) (domain.Subscription, error)
+	// ListSubscriptions - subscriptions ordered by address read after query cursor
+	ListSubscriptions(ctx context.Context, query domain.SubscriptionQuery) (domain.SubscriptionPage, error)
 	ExistsSubscriber(ctx context.Context, addr domain.Address) (bool, error)
-	AddTx(ctx context.Context, addr domain.Address, tx domain.Transaction) error
-	GetTransactions(ctx context.Context, addr domain.Address) ([]domain.Transaction, error)
+	// Subscribers - all subscribed addresses in no particular order
+	Subscribers(ctx context.Context) ([]domain.Address, error)
+	// ExistsSubscribers - reports for every address whether it is subscribed in one call,
+	// used to match transactions of whole block without round trip per address
+	ExistsSubscribers(ctx context.Context, addrs []domain.Address) ([]bool, error)
+	// AddTx - stores transaction of address and reports whether it is added, transaction with already
+	// stored key is ignored, so reprocessed blocks do not produce duplicates
+	AddTx(ctx context.Context, addr domain.Address, tx domain.Transaction) (bool, error)
+	// DelBlockTxs - removes transactions of orphaned block and returns count of removed transactions
+	DelBlockTxs(ctx context.Context, blockHash string) (int, error)
+	// GetTransactions - transactions matching query in order of storing or reversed one for descending query,
+	// empty page if nothing matches. Backend applies all query filters, pushing down those it can
+	GetTransactions(ctx context.Context, addr domain.Address, query domain.TxQuery) (domain.TxPage, error)
+	// AckTransactions - removes transactions with sequence number up to upTo and returns count of removed
+	AckTransactions(ctx context.Context, addr domain.Address, upTo uint64) (int, error)
+	// GetTransactionsByHash - records of transaction hash of all addresses, token and internal transfers included
+	GetTransactionsByHash(ctx context.Context, hash string) ([]domain.MatchedTx, error)
+	// GetTransactionsInRange - transactions of all addresses in blocks range [fromBlock, toBlock] ordered by block
+	GetTransactionsInRange(ctx context.Context, fromBlock, toBlock int) ([]domain.MatchedTx, error)
+}
+
+// StorageWrapper - storage decorator, optional interfaces of wrapped storage are reached through Unwrap
+type StorageWrapper interface {
+	Storage
+	Unwrap() Storage
+}
+
+// StorageAs - storage or the first storage wrapped by it implementing optional interface T
+func StorageAs[T any](storage Storage) (T, bool) {
+	for {
+		if t, ok := storage.(T); ok {
+			return t, true
+		}
+		wrapper, ok := storage.(StorageWrapper)
+		if !ok {
+			var zero T
+
+			return zero, false
+		}
+		storage = wrapper.Unwrap()
+	}
+}
+
+// RetentionStorage - storage which evicts transactions beyond retention, global retention is overridden per address
+type RetentionStorage interface {
+	SetRetention(ctx context.Context, addr domain.Address, retention domain.Retention) error
 }
 
 type Service struct {
@@ -52,21 +166,218 @@ type Service struct {
 	blockStorage BlocksStorage
 	storage      Storage
 	logger       Logger
+	// hub - fan out of matched transactions to stream listeners
+	hub *Hub
+	// deliveries - signals webhook dispatcher about enqueued deliveries
+	deliveries    chan struct{}
+	webhookClient *http.Client
+
+	// lag - count of blocks between chain head and last processed block
+	lag atomic.Int64
 }
 
+const (
+	defaultReorgDepth    = 64
+	defaultMaxBlockRange = 1000
+	// defaultPushedHeadsPoll - interval of node polls while heads are pushed
+	defaultPushedHeadsPoll = time.Minute
+	// defaultSubscriptionsLimit, maxSubscriptionsLimit - page size of subscriptions list
+	defaultSubscriptionsLimit = 100
+	maxSubscriptionsLimit     = 1000
+	// noProcessedTxs - last processed tx index of block which was not processed yet
+	noProcessedTxs = -1
+)
+
 func NewConfig(
 	txFetchInterval time.Duration,
 	matcherWorkers int,
+	options ...ConfigOption,
 ) Config {
-	return Config{
-		txFetchInterval: txFetchInterval,
-		matcherWorkers:  matcherWorkers,
+	cfg := Config{
+		txFetchInterval:   txFetchInterval,
+		matcherWorkers:    matcherWorkers,
+		reorgDepth:        defaultReorgDepth,
+		maxBatch:          1,
+		headTag:           domain.BlockTagLatest,
+		maxBlockRange:     defaultMaxBlockRange,
+		streamBuffer:      defaultStreamBuffer,
+		streamReplay:      defaultStreamReplay,
+		streamRetention:   defaultStreamRetention,
+		webhookAttempts:   defaultWebhookAttempts,
+		webhookBackoff:    defaultWebhookBackoff,
+		webhookMaxBackoff: defaultWebhookMaxBackoff,
+		webhookTimeout:    defaultWebhookTimeout,
+		pushedHeadsPoll:   defaultPushedHeadsPoll,
+	}
+	for _, opt := range options {
+		opt(&cfg)
 	}
+
+	return cfg
 }
 
 type Config struct {
-	txFetchInterval time.Duration
-	matcherWorkers  int
+	txFetchInterval   time.Duration
+	matcherWorkers    int
+	reorgDepth        int
+	confirmations     int
+	maxBatch          int
+	receipts          bool
+	tokenTransfers    bool
+	internalTxs       bool
+	headTag           domain.BlockTag
+	maxBlockRange     int
+	purge             bool
+	streamBuffer      int
+	streamReplay      int
+	streamRetention   time.Duration
+	webhookAttempts   int
+	webhookBackoff    time.Duration
+	webhookMaxBackoff time.Duration
+	webhookTimeout    time.Duration
+	heads             HeadsNotifier
+	pushedHeadsPoll   time.Duration
+	onReorg           func(ctx context.Context, reorg Reorg)
+}
+
+// HeadsNotifier - push transport of new chain heads
+type HeadsNotifier interface {
+	// Heads - pushed head numbers
+	Heads() <-chan int
+	// Connected - false while push transport is disconnected, service falls back to polling
+	Connected() bool
+}
+
+type ConfigOption func(*Config)
+
+// WithReorgDepth - count of recent block hashes kept to find common ancestor on chain reorganization
+func WithReorgDepth(depth int) ConfigOption {
+	return func(c *Config) {
+		c.reorgDepth = max(depth, 1)
+	}
+}
+
+// WithConfirmations - count of blocks behind chain head to wait before processing block
+func WithConfirmations(confirmations int) ConfigOption {
+	return func(c *Config) {
+		c.confirmations = max(confirmations, 0)
+	}
+}
+
+// WithHeadTag - follow node "safe" or "finalized" block instead of the latest one,
+// confirmations are counted from the selected block
+func WithHeadTag(tag domain.BlockTag) ConfigOption {
+	return func(c *Config) {
+		c.headTag = tag
+	}
+}
+
+// WithMaxBatch - max count of blocks processed per tick while service catches up chain head,
+// blocks are fetched concurrently and committed in order
+func WithMaxBatch(maxBatch int) ConfigOption {
+	return func(c *Config) {
+		c.maxBatch = max(maxBatch, 1)
+	}
+}
+
+// WithReceipts - fetch block receipts to attach status, gas used, effective gas price,
+// created contract address and logs to matched transactions
+func WithReceipts(enabled bool) ConfigOption {
+	return func(c *Config) {
+		c.receipts = enabled
+	}
+}
+
+// WithTokenTransfers - decode ERC-20 Transfer events from receipts and match their from/to with subscribers,
+// requires receipts so they are fetched even if receipts are disabled
+func WithTokenTransfers(enabled bool) ConfigOption {
+	return func(c *Config) {
+		c.tokenTransfers = enabled
+	}
+}
+
+// WithInternalTransfers - match value bearing internal calls traced by node,
+// client should be configured with tracer supported by node
+func WithInternalTransfers(enabled bool) ConfigOption {
+	return func(c *Config) {
+		c.internalTxs = enabled
+	}
+}
+
+// WithMaxBlockRange - max count of blocks in range of transactions lookup
+func WithMaxBlockRange(blocks int) ConfigOption {
+	return func(c *Config) {
+		c.maxBlockRange = max(blocks, 1)
+	}
+}
+
+// WithPurgeOnUnsubscribe - remove stored transactions of address on unsubscribe,
+// otherwise they are kept for lookups and returned again if address is subscribed again
+func WithPurgeOnUnsubscribe(enabled bool) ConfigOption {
+	return func(c *Config) {
+		c.purge = enabled
+	}
+}
+
+// WithStreamBuffer - max count of undelivered events of stream listener, listener is closed when it is full
+func WithStreamBuffer(size int) ConfigOption {
+	return func(c *Config) {
+		c.streamBuffer = max(size, 1)
+	}
+}
+
+// WithStreamReplay - count of recent matched transactions kept per address to resume streams,
+// streams are not resumed if 0
+func WithStreamReplay(count int) ConfigOption {
+	return func(c *Config) {
+		c.streamReplay = max(count, 0)
+	}
+}
+
+// WithStreamRetention - time recent matched transactions of address are kept to resume streams
+// after its last stream is gone
+func WithStreamRetention(retain time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.streamRetention = max(retain, 0)
+	}
+}
+
+// WithHeadsNotifier - process transactions on each pushed head instead of polling node on interval
+func WithHeadsNotifier(heads HeadsNotifier) ConfigOption {
+	return func(c *Config) {
+		c.heads = heads
+	}
+}
+
+// WithPushedHeadsPoll - interval of node polls while heads are pushed, so heads missed by push transport
+// which looks connected are processed anyway
+func WithPushedHeadsPoll(interval time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.pushedHeadsPoll = interval
+	}
+}
+
+// WithReorgHandler - called after service rolled back orphaned blocks and published retractions
+// of their transactions
+func WithReorgHandler(handler func(ctx context.Context, reorg Reorg)) ConfigOption {
+	return func(c *Config) {
+		c.onReorg = handler
+	}
+}
+
+// Reorg - describes rolled back chain reorganization
+type Reorg struct {
+	// Depth - count of orphaned blocks
+	Depth int
+	// CommonAncestor - last block shared by old and new canonical chain
+	CommonAncestor int
+	// OrphanedBlocks - hashes of rolled back blocks from the highest one
+	OrphanedBlocks []string
+	// RemovedTxs - count of matched transactions removed from storage
+	RemovedTxs int
+	// Retracted - removed transactions with addresses they were matched with, events and webhook
+	// deliveries retracting them are published
+	Retracted []domain.MatchedTx
 }
 
 type Logger interface {
@@ -81,6 +392,14 @@ func NewService(client Client, blockStorage BlocksStorage, storage Storage, logg
 		blockStorage: blockStorage,
 		storage:      storage,
 		logger:       logger,
+		hub:          NewHub(cfg.streamBuffer, cfg.streamReplay, WithReplayRetention(cfg.streamRetention)),
+		deliveries:   make(chan struct{}, 1),
+		webhookClient: &http.Client{
+			// redirects of webhook are not followed, delivery is acknowledged by 2xx only
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
 	}
 }
 
@@ -88,62 +407,383 @@ func (s *Service) Run(ctx context.Context) {
 	timer := time.NewTimer(0)
 	defer timer.Stop()
 
+	var heads <-chan int
+	if s.cfg.heads != nil {
+		heads = s.cfg.heads.Heads()
+	}
+
 	ctx = logger.NewAttrContext(ctx) // to handle attributes from upstream calls in logs
-	for {
+	var lastRun time.Time
+	for initial := true; ; initial = false {
+		var pushed, progressed bool
 		select {
 		case <-ctx.Done():
 			return
+		case <-heads:
+			pushed = true
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
 		case <-timer.C:
 		}
 
-		start := time.Now()
-		if processed, err := s.ProcessTransactions(ctx); err != nil {
-			s.logger.Error(ctx, "processTransactions",
-				slog.Any("error", err),
-				slog.String("process_time", time.Since(start).String()),
-			)
-		} else if processed {
-			s.logger.Info(ctx, "processTransactions processed",
-				slog.String("process_time", time.Since(start).String()),
-			)
+		// while heads are pushed timer is used to catch up chain head and to poll node on pushed heads poll
+		// interval in case push transport stopped delivering heads without disconnect
+		if initial || pushed || s.polling() || s.lag.Load() > 0 || time.Since(lastRun) >= s.cfg.pushedHeadsPoll {
+			start := time.Now()
+			lastRun = start
+			if processed, err := s.ProcessTransactions(ctx); err != nil {
+				s.logger.Error(ctx, "processTransactions",
+					slog.Any("error", err),
+					slog.String("process_time", time.Since(start).String()),
+				)
+			} else if processed {
+				progressed = true
+				s.logger.Info(ctx, "processTransactions processed",
+					slog.String("process_time", time.Since(start).String()),
+				)
+			}
+		}
+		// continue immediately while catching up chain head in batches,
+		// failed or idle run waits for interval to not hammer node
+		if progressed && s.cfg.maxBatch > 1 && s.lag.Load() > 0 {
+			timer.Reset(0)
+
+			continue
 		}
 		timer.Reset(s.cfg.txFetchInterval)
 	}
 }
 
+// polling - service polls node on interval if heads are not pushed or push transport is disconnected
+func (s *Service) polling() bool {
+	return s.cfg.heads == nil || !s.cfg.heads.Connected()
+}
+
+// headBlock - defines block which is ready for processing according to head tag and confirmations
+func (s *Service) headBlock(ctx context.Context) (int, error) {
+	var (
+		head int
+		err  error
+	)
+	if s.cfg.headTag == domain.BlockTagLatest {
+		head, err = s.client.GetBlockNumber(ctx)
+	} else {
+		head, err = s.client.GetBlockNumberByTag(ctx, s.cfg.headTag)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return head - s.cfg.confirmations, nil
+}
+
 func (s *Service) ProcessTransactions(ctx context.Context) (bool, error) {
-	currentBlockNumber, err := s.client.GetBlockNumber(ctx)
+	headBlockNumber, err := s.headBlock(ctx)
 	if err != nil {
 		return false, err
 	}
 	var (
-		prevBlockNumber = s.blockStorage.GetCurrentBlock()
-		nextBlockNumber = prevBlockNumber + 1
+		prevBlockNumber    = s.blockStorage.GetCurrentBlock()
+		currentBlockNumber = headBlockNumber
+		fromBlockNumber    = prevBlockNumber + 1
 	)
 	if prevBlockNumber != 0 {
-		currentBlockNumber = min(currentBlockNumber, nextBlockNumber)
+		currentBlockNumber = min(headBlockNumber, prevBlockNumber+s.cfg.maxBatch)
+	}
+	// confirmed head is behind already processed block
+	if currentBlockNumber < prevBlockNumber || currentBlockNumber <= 0 {
+		return false, nil
+	}
+	if prevBlockNumber == 0 || prevBlockNumber == currentBlockNumber {
+		fromBlockNumber = currentBlockNumber
 	}
 
 	// define if we already started processing current block
 	// and define last processed transaction to avoid duplicated transactions
-	var prevLastProcessedIndex int
+	var prevLastProcessedIndex = noProcessedTxs
 	if prevBlockNumber == currentBlockNumber {
-		prevLastProcessedIndex, _ = s.blockStorage.GetLastProcessedTxIndex(currentBlockNumber)
+		if idx, ok := s.blockStorage.GetLastProcessedTxIndex(currentBlockNumber); ok {
+			prevLastProcessedIndex = idx
+		}
+	}
+	// failed checkpoint read looks like empty storage which starts from head and skips backlog
+	if err = s.blocksErr(); err != nil {
+		return false, err
 	}
 	logger.AttrsFromCtx(ctx).PutAttrs(
 		slog.Int("prevBlockNumber", prevBlockNumber),
 		slog.Int("currentBlockNumber", currentBlockNumber),
 		slog.Int("prevLastProcessedIndex", prevLastProcessedIndex),
 	)
-	txs, err := s.client.GetBlockTxsByNumber(ctx, currentBlockNumber)
+	blocks, fetchErr := s.fetchBlocks(ctx, fromBlockNumber, currentBlockNumber)
+	if len(blocks) == 0 {
+		return false, fetchErr
+	}
+
+	var (
+		stat      = new(Stat)
+		txLen     int
+		joinedErr = fetchErr
+	)
+	for i, block := range blocks {
+		number := fromBlockNumber + i
+		canonical := s.isCanonical(number, block)
+		if err = s.blocksErr(); err != nil {
+			return true, errors.Join(joinedErr, err)
+		}
+		if !canonical {
+			return true, errors.Join(joinedErr, s.rollback(ctx, s.blockStorage.GetCurrentBlock()))
+		}
+		lastProcessedIndex := noProcessedTxs
+		if number == prevBlockNumber {
+			// checkpointed head block is fetched again only to detect its reorganization
+			if processedTxs(block.Transactions, prevLastProcessedIndex) {
+				continue
+			}
+			lastProcessedIndex = prevLastProcessedIndex
+		}
+		if err = s.attachReceipts(ctx, number, block.Transactions); err != nil {
+			return true, errors.Join(joinedErr, err)
+		}
+		internalTxs, err := s.getInternalTxs(ctx, number, block)
+		if err != nil {
+			return true, errors.Join(joinedErr, err)
+		}
+		err = s.handleTransactionsMatching(ctx, stat, number, lastProcessedIndex, block.Transactions, internalTxs)
+		if err != nil {
+			return true, errors.Join(joinedErr, err)
+		}
+		txLen += len(block.Transactions)
+		// block event is published once, when checkpoint advances to block
+		if number != prevBlockNumber {
+			s.hub.PublishBlock(number)
+		}
+
+		s.blockStorage.SetBlockHash(number, block.Hash)
+		// blocks beyond reorg depth are neither checked nor reprocessed
+		s.blockStorage.DelBlockHash(number - s.cfg.reorgDepth)
+		s.blockStorage.DelLastProcessedTxIndex(number - s.cfg.reorgDepth)
+		// next blocks are not processed after checkpoint of block is not stored
+		if err = s.blocksErr(); err != nil {
+			return true, errors.Join(joinedErr, err)
+		}
+	}
+	lag := headBlockNumber - s.blockStorage.GetCurrentBlock()
+	if err = s.blocksErr(); err != nil {
+		return true, errors.Join(joinedErr, err)
+	}
+	s.lag.Store(int64(lag))
+
+	logger.AttrsFromCtx(ctx).PutAttrs(
+		slog.Int("blocks", len(blocks)),
+		slog.Int("tx_len", txLen),
+		slog.Any("stat", stat.String()),
+		slog.Int("lag", lag),
+	)
+
+	return true, joinedErr
+}
+
+// processedTxs - reports whether all transactions of block are processed up to lastProcessedIndex
+func processedTxs(txs []domain.Transaction, lastProcessedIndex int) bool {
+	if len(txs) == 0 {
+		return true
+	}
+	idx, err := converter.ParseHexInt(txs[len(txs)-1].TransactionIndex)
+
+	return err == nil && idx <= lastProcessedIndex
+}
+
+// fetchBlocks - concurrently fetches blocks in range [from, to], returns blocks in order
+// till the first failed one and joined fetch errors
+func (s *Service) fetchBlocks(ctx context.Context, from, to int) ([]domain.Block, error) {
+	if rangeClient, ok := s.client.(RangeClient); ok && to > from {
+		return rangeClient.GetBlocksByRange(ctx, from, to)
+	}
+	var (
+		blocks = make([]domain.Block, to-from+1)
+		errs   = make([]error, len(blocks))
+		wg     = sync.WaitGroup{}
+	)
+	for i := range blocks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blocks[i], errs[i] = s.client.GetBlockByNumber(ctx, from+i)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return blocks[:i], errors.Join(errs[i:]...)
+		}
+	}
+
+	return blocks, nil
+}
+
+// attachReceipts - sets receipt fields of block transactions in place if receipts are enabled
+func (s *Service) attachReceipts(ctx context.Context, number int, txs []domain.Transaction) error {
+	if !s.cfg.receipts && !s.cfg.tokenTransfers || len(txs) == 0 {
+		return nil
+	}
+	hashes := make([]string, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash
+	}
+	receipts, err := s.client.GetBlockReceipts(ctx, number, hashes)
 	if err != nil {
-		return false, err
+		return err
+	}
+	byHash := make(map[string]domain.Receipt, len(receipts))
+	for _, receipt := range receipts {
+		byHash[receipt.TransactionHash] = receipt
+	}
+	for i, tx := range txs {
+		if receipt, ok := byHash[tx.Hash]; ok {
+			txs[i] = tx.WithReceipt(receipt)
+		}
+	}
+
+	return nil
+}
+
+// getInternalTxs - traces internal transfers of block if enabled and links them with parent transactions
+func (s *Service) getInternalTxs(ctx context.Context, number int, block domain.Block) ([]domain.Transaction, error) {
+	if !s.cfg.internalTxs || len(block.Transactions) == 0 {
+		return nil, nil
+	}
+	internalTxs, err := s.client.GetBlockInternalTxs(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	for i, internal := range internalTxs {
+		txIdx, err := converter.ParseHexInt(internal.TransactionIndex)
+		if err != nil {
+			return nil, err
+		}
+		if txIdx < 0 || txIdx >= len(block.Transactions) {
+			continue
+		}
+		internalTxs[i] = block.Transactions[txIdx].AsInternalTransfer(internal)
+	}
+
+	return internalTxs, nil
+}
+
+// blocksErr - failure of blocks storage methods since the previous check
+func (s *Service) blocksErr() error {
+	storage, ok := s.blockStorage.(FallibleBlocksStorage)
+	if !ok {
+		return nil
+	}
+	if err := storage.Err(); err != nil {
+		return fmt.Errorf("blocks storage: %w", err)
 	}
-	if err = s.handleTransactionsMatching(ctx, currentBlockNumber, prevLastProcessedIndex, txs); err != nil {
-		return true, err
+
+	return nil
+}
+
+// isCanonical - checks that block extends processed chain: block hash is the same as already processed one
+// and parent hash points to the previously processed block
+func (s *Service) isCanonical(number int, block domain.Block) bool {
+	if hash, ok := s.blockStorage.GetBlockHash(number); ok && hash != block.Hash {
+		return false
+	}
+	if hash, ok := s.blockStorage.GetBlockHash(number - 1); ok && hash != block.ParentHash {
+		return false
 	}
 
-	return true, nil
+	return true
+}
+
+// rollback - walks back from tip block to the common ancestor with canonical chain,
+// removes matched transactions of orphaned blocks and moves cursor to the ancestor,
+// so next processing re-ingests new canonical branch. Removed transactions are published
+// as removed to streams and webhooks, so alerts sent for them can be retracted
+func (s *Service) rollback(ctx context.Context, tip int) error {
+	ancestor := tip
+	var orphaned []string
+	for ; ancestor > 0 && tip-ancestor < s.cfg.reorgDepth; ancestor-- {
+		hash, ok := s.blockStorage.GetBlockHash(ancestor)
+		if !ok {
+			break
+		}
+		canonical, err := s.client.GetBlockByNumber(ctx, ancestor)
+		if err != nil {
+			return err
+		}
+		if canonical.Hash == hash {
+			break
+		}
+		orphaned = append(orphaned, hash)
+	}
+	if err := s.blocksErr(); err != nil {
+		return err
+	}
+	if len(orphaned) == 0 {
+		return nil
+	}
+
+	var (
+		removedTxs int
+		deleted    = make(map[string]bool, len(orphaned))
+		joinedErr  error
+	)
+	// transactions of orphaned blocks are read before removal to retract events published for them
+	matched, err := s.storage.GetTransactionsInRange(ctx, ancestor+1, tip)
+	if err != nil {
+		joinedErr = err
+	}
+	for i, hash := range orphaned {
+		removed, err := s.storage.DelBlockTxs(ctx, hash)
+		if err != nil {
+			joinedErr = errors.Join(joinedErr, err)
+		} else {
+			deleted[hash] = true
+		}
+		removedTxs += removed
+		s.blockStorage.DelBlockHash(tip - i)
+		s.blockStorage.DelLastProcessedTxIndex(tip - i)
+	}
+	s.blockStorage.SetCurrentBlock(ancestor)
+	joinedErr = errors.Join(joinedErr, s.blocksErr())
+
+	var retracted []domain.MatchedTx
+	for _, tx := range matched {
+		if !deleted[tx.Transaction.BlockHash] {
+			continue
+		}
+		retracted = append(retracted, tx)
+		s.hub.PublishRemoved(tx.Address, tx.Transaction)
+		if err = s.enqueueDelivery(ctx, domain.NewRemovedDelivery(tx.Address, tx.Transaction, time.Now())); err != nil {
+			joinedErr = errors.Join(joinedErr, err)
+		}
+	}
+	s.hub.PublishReorg(ancestor, orphaned)
+
+	reorg := Reorg{
+		Depth:          len(orphaned),
+		CommonAncestor: ancestor,
+		OrphanedBlocks: orphaned,
+		RemovedTxs:     removedTxs,
+		Retracted:      retracted,
+	}
+	s.logger.Info(ctx, "reorg",
+		slog.Int("depth", reorg.Depth),
+		slog.Int("common_ancestor", reorg.CommonAncestor),
+		slog.Int("removed_txs", reorg.RemovedTxs),
+	)
+	if s.cfg.onReorg != nil {
+		s.cfg.onReorg(ctx, reorg)
+	}
+
+	return joinedErr
 }
 
 type Stat struct {
@@ -160,14 +800,67 @@ func (s *Stat) String() string {
 	)
 }
 
+// subscribedSet - subscribed addresses of block, read by matchers without storage calls
+type subscribedSet map[domain.Address]struct{}
+
+func (s subscribedSet) has(addr domain.Address) bool {
+	_, ok := s[addr]
+
+	return ok
+}
+
+// subscribedOf - checks all addresses of block transactions with single storage call
+func (s *Service) subscribedOf(ctx context.Context, txs, internalTxs []domain.Transaction) (subscribedSet, error) {
+	var (
+		seen  = make(map[domain.Address]struct{})
+		addrs []domain.Address
+	)
+	collect := func(candidates ...domain.Address) {
+		for _, addr := range candidates {
+			if _, ok := seen[addr]; ok || addr == "" {
+				continue
+			}
+			seen[addr] = struct{}{}
+			addrs = append(addrs, addr)
+		}
+	}
+	for _, tx := range txs {
+		collect(tx.From, tx.To)
+		if !s.cfg.tokenTransfers {
+			continue
+		}
+		for _, transfer := range tx.TokenTransfers() {
+			collect(transfer.From, transfer.To)
+		}
+	}
+	for _, tx := range internalTxs {
+		collect(tx.From, tx.To)
+	}
+	if len(addrs) == 0 {
+		return subscribedSet{}, nil
+	}
+	exists, err := s.storage.ExistsSubscribers(ctx, addrs)
+	if err != nil {
+		return nil, err
+	}
+	subscribed := make(subscribedSet)
+	for i, addr := range addrs {
+		if exists[i] {
+			subscribed[addr] = struct{}{}
+		}
+	}
+
+	return subscribed, nil
+}
+
 func (s *Service) handleTransactions(
 	ctx context.Context,
 	stat *Stat,
+	subscribed subscribedSet,
 	lastProcessedIndex int,
 	txStream chan domain.Transaction,
 	errsStream chan error,
 ) {
-	var exist bool
 	for tx := range txStream {
 		txIdx, err := converter.ParseHexInt(tx.TransactionIndex)
 		if err != nil {
@@ -175,7 +868,7 @@ func (s *Service) handleTransactions(
 
 			continue
 		}
-		if lastProcessedIndex != 0 && txIdx <= lastProcessedIndex {
+		if txIdx <= lastProcessedIndex {
 			stat.Skipped.Add(1)
 
 			continue
@@ -183,16 +876,59 @@ func (s *Service) handleTransactions(
 		stat.Processed.Add(1)
 
 		for _, addr := range []domain.Address{tx.From, tx.To} {
-			if exist, err = s.storage.ExistsSubscriber(ctx, addr); err != nil {
+			if !subscribed.has(addr) {
+				continue
+			}
+			stat.Matched.Add(1)
+			added, err := s.storage.AddTx(ctx, addr, tx)
+			if err != nil {
 				errsStream <- err
 
 				continue
 			}
-			if !exist {
+			// reprocessed record is already published, its delivery is enqueued again as it could be lost
+			// after the record was stored, delivery of the same record has the same id and is ignored if queued
+			if added {
+				s.hub.Publish(addr, tx)
+			}
+			if err = s.enqueueDelivery(ctx, domain.NewDelivery(addr, tx, time.Now())); err != nil {
+				errsStream <- err
+			}
+		}
+		if s.cfg.tokenTransfers {
+			s.handleTokenTransfers(ctx, stat, subscribed, tx, errsStream)
+		}
+	}
+}
+
+func (s *Service) handleTokenTransfers(
+	ctx context.Context,
+	stat *Stat,
+	subscribed subscribedSet,
+	tx domain.Transaction,
+	errsStream chan error,
+) {
+	for _, transfer := range tx.TokenTransfers() {
+		addrs := []domain.Address{transfer.From, transfer.To}
+		if transfer.From == transfer.To {
+			addrs = addrs[:1]
+		}
+		for _, addr := range addrs {
+			if !subscribed.has(addr) {
 				continue
 			}
 			stat.Matched.Add(1)
-			if err = s.storage.AddTx(ctx, addr, tx); err != nil {
+			transferTx := tx.AsTokenTransfer(transfer)
+			added, err := s.storage.AddTx(ctx, addr, transferTx)
+			if err != nil {
+				errsStream <- err
+
+				continue
+			}
+			if added {
+				s.hub.Publish(addr, transferTx)
+			}
+			if err := s.enqueueDelivery(ctx, domain.NewDelivery(addr, transferTx, time.Now())); err != nil {
 				errsStream <- err
 			}
 		}
@@ -201,12 +937,17 @@ func (s *Service) handleTransactions(
 
 func (s *Service) handleTransactionsMatching(
 	ctx context.Context,
+	stat *Stat,
 	blockNumber int,
 	lastProcessedIndex int,
 	txs []domain.Transaction,
+	internalTxs []domain.Transaction,
 ) (joinedErr error) {
+	subscribed, err := s.subscribedOf(ctx, txs, internalTxs)
+	if err != nil {
+		return err
+	}
 	var (
-		stat      = new(Stat)
 		txStream  = make(chan domain.Transaction)
 		errStream = make(chan error)
 	)
@@ -214,7 +955,7 @@ func (s *Service) handleTransactionsMatching(
 	for i := 0; i < s.cfg.matcherWorkers; i++ {
 		wg.Add(1)
 		go func() {
-			s.handleTransactions(ctx, stat, lastProcessedIndex, txStream, errStream)
+			s.handleTransactions(ctx, stat, subscribed, lastProcessedIndex, txStream, errStream)
 			wg.Done()
 		}()
 	}
@@ -222,6 +963,9 @@ func (s *Service) handleTransactionsMatching(
 		for _, tx := range txs {
 			txStream <- tx
 		}
+		for _, tx := range internalTxs {
+			txStream <- tx
+		}
 		close(txStream)
 	}()
 	go func() {
@@ -231,7 +975,14 @@ func (s *Service) handleTransactionsMatching(
 	for err := range errStream {
 		joinedErr = errors.Join(joinedErr, err)
 	}
+	// block is reprocessed after failure, so stored transactions which were not delivered are enqueued again
+	if joinedErr != nil {
+		return joinedErr
+	}
 	s.blockStorage.SetCurrentBlock(blockNumber)
+	if len(txs) == 0 {
+		return joinedErr
+	}
 
 	lastProcessedTxIndex, err := converter.ParseHexInt(txs[len(txs)-1].TransactionIndex)
 	if err != nil {
@@ -239,38 +990,195 @@ func (s *Service) handleTransactionsMatching(
 	}
 	s.blockStorage.SetLastProcessedTxIndex(blockNumber, lastProcessedTxIndex)
 
-	logger.AttrsFromCtx(ctx).PutAttrs(
-		slog.Int("tx_len", len(txs)),
-		slog.Int("last_tx_idx", lastProcessedTxIndex),
-		slog.Any("stat", stat.String()),
-	)
-
 	return joinedErr
 }
 
+// Lag - count of blocks between chain head and last processed block
+func (s *Service) Lag() int {
+	return int(s.lag.Load())
+}
+
 func (s *Service) GetCurrentBlock() int {
 	return s.blockStorage.GetCurrentBlock()
 }
 
-func (s *Service) Subscribe(ctx context.Context, address domain.Address) error {
+type subscription struct {
+	retention *domain.Retention
+	webhook   *domain.Webhook
+}
+
+type SubscribeOption func(*subscription)
+
+// WithRetention - overrides storage global retention for subscribed address
+func WithRetention(retention domain.Retention) SubscribeOption {
+	return func(s *subscription) {
+		s.retention = &retention
+	}
+}
+
+func (s *Service) Subscribe(ctx context.Context, address domain.Address, options ...SubscribeOption) error {
 	if !address.Valid() {
 		return domain.ErrInvalidAddress
 	}
+	var sub subscription
+	for _, opt := range options {
+		opt(&sub)
+	}
+	retentionStorage, ok := StorageAs[RetentionStorage](s.storage)
+	if sub.retention != nil {
+		if !ok {
+			return domain.ErrRetentionNotSupported
+		}
+		if !sub.retention.Valid() {
+			return domain.ErrInvalidRetention
+		}
+	}
+	webhookStorage, ok := StorageAs[WebhookStorage](s.storage)
+	if sub.webhook != nil {
+		if !ok {
+			return domain.ErrWebhookNotSupported
+		}
+		if !sub.webhook.Valid() {
+			return domain.ErrInvalidWebhook
+		}
+	}
+	if err := s.storage.AddSubscriber(ctx, address); err != nil {
+		return err
+	}
+	if sub.retention != nil {
+		if err := retentionStorage.SetRetention(ctx, address, *sub.retention); err != nil {
+			return err
+		}
+	}
+	if sub.webhook != nil {
+		return webhookStorage.SetWebhook(ctx, address, *sub.webhook)
+	}
+
+	return nil
+}
+
+func (s *Service) Unsubscribe(ctx context.Context, address domain.Address) (int, error) {
+	if !address.Valid() {
+		return 0, domain.ErrInvalidAddress
+	}
+
+	removed, err := s.storage.Unsubscribe(ctx, address, s.cfg.purge)
+	if err != nil {
+		return 0, err
+	}
+	s.hub.Forget(address)
+	if webhookStorage, ok := StorageAs[WebhookStorage](s.storage); ok {
+		if err = webhookStorage.DelWebhook(ctx, address); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// ListSubscriptions - subscriptions page, limit is defaulted and capped to keep responses bounded
+func (s *Service) ListSubscriptions(ctx context.Context, query domain.SubscriptionQuery) (domain.SubscriptionPage, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultSubscriptionsLimit
+	}
+	query.Limit = min(query.Limit, maxSubscriptionsLimit)
 
-	return s.storage.AddSubscriber(ctx, address)
+	return s.storage.ListSubscriptions(ctx, query)
 }
 
-func (s *Service) GetTransactions(ctx context.Context, address domain.Address) ([]domain.Transaction, error) {
+func (s *Service) GetSubscription(ctx context.Context, address domain.Address) (domain.Subscription, error) {
 	if !address.Valid() {
+		return domain.Subscription{}, domain.ErrInvalidAddress
+	}
+
+	return s.storage.GetSubscription(ctx, address)
+}
+
+// Stream - listener of transactions matched with addresses, each of them must be subscribed,
+// repeated addresses are listened once
+func (s *Service) Stream(ctx context.Context, addresses []domain.Address, cursor *domain.StreamCursor) (*Listener, error) {
+	if len(addresses) == 0 {
 		return nil, domain.ErrInvalidAddress
 	}
-	exist, err := s.storage.ExistsSubscriber(ctx, address)
+	addresses = slices.Clone(addresses)
+	slices.Sort(addresses)
+	addresses = slices.Compact(addresses)
+	for _, addr := range addresses {
+		if err := s.checkSubscriber(ctx, addr); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.hub.Listen(ctx, addresses, cursor), nil
+}
+
+func (s *Service) Watch(ctx context.Context) *Listener {
+	return s.hub.Listen(ctx, nil, nil, WithBlockEvents())
+}
+
+// GetTransactions - filters of query are passed to storage, so backend can apply them where data is stored,
+// full page gets continuation token of the next page. Empty page of query with cursor is not an error,
+// so client following cursor to the end of data keeps it to poll new transactions
+func (s *Service) GetTransactions(ctx context.Context, address domain.Address, query domain.TxQuery) (domain.TxPage, error) {
+	if err := query.Validate(); err != nil {
+		return domain.TxPage{}, err
+	}
+	if err := s.checkSubscriber(ctx, address); err != nil {
+		return domain.TxPage{}, err
+	}
+	page, err := s.storage.GetTransactions(ctx, address, query)
+	if err != nil {
+		return domain.TxPage{}, err
+	}
+	if len(page.Transactions) == 0 && !query.HasCursor() {
+		return domain.TxPage{}, domain.ErrNoTransactions
+	}
+	if query.Limit > 0 && len(page.Transactions) == query.Limit {
+		page.NextToken = query.Continue(page.Next).Token()
+	}
+
+	return page, nil
+}
+
+func (s *Service) AckTransactions(ctx context.Context, address domain.Address, upTo uint64) (int, error) {
+	if err := s.checkSubscriber(ctx, address); err != nil {
+		return 0, err
+	}
+
+	return s.storage.AckTransactions(ctx, address, upTo)
+}
+
+func (s *Service) GetTransactionByHash(ctx context.Context, hash string) ([]domain.MatchedTx, error) {
+	matched, err := s.storage.GetTransactionsByHash(ctx, hash)
 	if err != nil {
 		return nil, err
 	}
+	if len(matched) == 0 {
+		return nil, domain.ErrTransactionNotFound
+	}
+
+	return matched, nil
+}
+
+func (s *Service) GetTransactionsInRange(ctx context.Context, fromBlock, toBlock int) ([]domain.MatchedTx, error) {
+	if fromBlock < 0 || toBlock < fromBlock || toBlock-fromBlock >= s.cfg.maxBlockRange {
+		return nil, domain.ErrInvalidBlockRange
+	}
+
+	return s.storage.GetTransactionsInRange(ctx, fromBlock, toBlock)
+}
+
+func (s *Service) checkSubscriber(ctx context.Context, address domain.Address) error {
+	if !address.Valid() {
+		return domain.ErrInvalidAddress
+	}
+	exist, err := s.storage.ExistsSubscriber(ctx, address)
+	if err != nil {
+		return err
+	}
 	if !exist {
-		return nil, domain.ErrAddressNotSubscribed
+		return domain.ErrAddressNotSubscribed
 	}
 
-	return s.storage.GetTransactions(ctx, address)
+	return nil
 }
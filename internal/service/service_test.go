@@ -4,7 +4,12 @@ import (
 	"context"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"math/big"
 	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -30,6 +35,15 @@ func (e *EthRpcClient) GetBlockNumber(_ context.Context) (int, error) {
 	return 0, errors.New("not found mock GetBlockNumber")
 }
 
+func (e *EthRpcClient) GetBlockNumberByTag(_ context.Context, tag domain.BlockTag) (int, error) {
+	for _, call := range e.ExpectedCalls {
+		if call.Method == "GetBlockNumberByTag" && call.Arguments.Get(0) == tag {
+			return call.ReturnArguments.Get(0).(int), call.ReturnArguments.Error(1)
+		}
+	}
+	return 0, errors.New("not found mock GetBlockNumberByTag")
+}
+
 func (e *EthRpcClient) GetBlockTxsByNumber(_ context.Context, _ int) ([]domain.Transaction, error) {
 	for _, call := range e.ExpectedCalls {
 		if call.Method == "GetBlockTxsByNumber" {
@@ -40,8 +54,120 @@ func (e *EthRpcClient) GetBlockTxsByNumber(_ context.Context, _ int) ([]domain.T
 	return nil, errors.New("not found mock GetBlockTxsByNumber")
 }
 
+func (e *EthRpcClient) GetBlockByNumber(ctx context.Context, number int) (domain.Block, error) {
+	txs, err := e.GetBlockTxsByNumber(ctx, number)
+	if err != nil {
+		return domain.Block{}, err
+	}
+
+	return domain.Block{Number: converter.FormatHexInt(number), Transactions: txs}, nil
+}
+
+func (e *EthRpcClient) GetBlockReceipts(_ context.Context, _ int, _ []string) ([]domain.Receipt, error) {
+	for _, call := range e.ExpectedCalls {
+		if call.Method == "GetBlockReceipts" {
+			return call.ReturnArguments.Get(0).([]domain.Receipt), call.ReturnArguments.Error(1)
+		}
+	}
+
+	return nil, errors.New("not found mock GetBlockReceipts")
+}
+
+func (e *EthRpcClient) GetBlockInternalTxs(_ context.Context, _ int) ([]domain.Transaction, error) {
+	for _, call := range e.ExpectedCalls {
+		if call.Method == "GetBlockInternalTxs" {
+			return call.ReturnArguments.Get(0).([]domain.Transaction), call.ReturnArguments.Error(1)
+		}
+	}
+
+	return nil, errors.New("not found mock GetBlockInternalTxs")
+}
+
 var _ service.Client = (*EthRpcClient)(nil)
 
+// ChainClient - serves blocks from in memory chain which can be replaced to simulate reorganization
+type ChainClient struct {
+	mu     sync.Mutex
+	blocks map[int]domain.Block
+	logs   map[string][]domain.Log
+	calls  map[int][]domain.Transaction
+	head   int
+}
+
+func (c *ChainClient) GetBlockNumber(_ context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.head, nil
+}
+
+func (c *ChainClient) GetBlockNumberByTag(_ context.Context, _ domain.BlockTag) (int, error) {
+	return 0, errors.New("tags are not supported")
+}
+
+func (c *ChainClient) GetBlockByNumber(_ context.Context, number int) (domain.Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	block, ok := c.blocks[number]
+	if !ok {
+		return domain.Block{}, errors.New("block not found")
+	}
+
+	return block, nil
+}
+
+func (c *ChainClient) GetBlockReceipts(_ context.Context, _ int, txHashes []string) ([]domain.Receipt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	receipts := make([]domain.Receipt, len(txHashes))
+	for i, hash := range txHashes {
+		receipts[i] = domain.Receipt{
+			TransactionHash: hash,
+			Status:          domain.TxStatusSuccess,
+			GasUsed:         converter.FormatHexInt(21000),
+			Logs:            c.logs[hash],
+		}
+	}
+
+	return receipts, nil
+}
+
+func (c *ChainClient) GetBlockInternalTxs(_ context.Context, number int) ([]domain.Transaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Clone(c.calls[number]), nil
+}
+
+// Extend - adds blocks on top of parent block, each block has one transaction from given address
+func (c *ChainClient) Extend(parent int, fork string, count int, from domain.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.blocks == nil {
+		c.blocks = make(map[int]domain.Block)
+	}
+	for number := parent + 1; number <= parent+count; number++ {
+		hash := fmt.Sprintf("0x%s%d", fork, number)
+		c.blocks[number] = domain.Block{
+			Number:     converter.FormatHexInt(number),
+			Hash:       hash,
+			ParentHash: c.blocks[number-1].Hash,
+			Transactions: []domain.Transaction{
+				{
+					Hash:             hash + "tx",
+					BlockHash:        hash,
+					BlockNumber:      converter.FormatHexInt(number),
+					From:             from,
+					TransactionIndex: converter.FormatHexInt(0),
+				},
+			},
+		}
+	}
+	c.head = parent + count
+}
+
+var _ service.Client = (*ChainClient)(nil)
+
 func setup(t *testing.T, currentBlock int) (*service.Service, service.BlocksStorage, *EthRpcClient) {
 	ethClient := &EthRpcClient{}
 
@@ -127,6 +253,7 @@ func TestSubscribe(t *testing.T) {
 	)
 	tests := map[string]struct {
 		address       domain.Address
+		options       []service.SubscribeOption
 		expectedErr   error
 		preconditions func()
 	}{
@@ -144,13 +271,23 @@ func TestSubscribe(t *testing.T) {
 			address:     genAddress(),
 			expectedErr: nil,
 		},
+		"3. Err invalid retention": {
+			address:     genAddress(),
+			options:     []service.SubscribeOption{service.WithRetention(domain.Retention{MaxTxs: -1})},
+			expectedErr: domain.ErrInvalidRetention,
+		},
+		"4. Success Subscribed with retention": {
+			address:     genAddress(),
+			options:     []service.SubscribeOption{service.WithRetention(domain.Retention{MaxTxs: 10})},
+			expectedErr: nil,
+		},
 	}
 	for name, testCase := range tests {
 		t.Run(name, func(t *testing.T) {
 			if testCase.preconditions != nil {
 				testCase.preconditions()
 			}
-			err := svc.Subscribe(ctx, testCase.address)
+			err := svc.Subscribe(ctx, testCase.address, testCase.options...)
 			require.ErrorIs(t, err, testCase.expectedErr)
 		})
 	}
@@ -219,9 +356,819 @@ func TestGetTransactions(t *testing.T) {
 			if testCase.preconditions != nil {
 				testCase.preconditions(testCase.address)
 			}
-			tsx, err := svc.GetTransactions(ctx, testCase.address)
+			page, err := svc.GetTransactions(ctx, testCase.address, domain.TxQuery{})
 			require.ErrorIs(t, err, testCase.expectedErr)
-			require.Equal(t, testCase.txs, tsx)
+			require.Equal(t, testCase.txs, page.Transactions)
+		})
+	}
+}
+
+func TestProcessTransactionsReorg(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		ancestor = 100
+	)
+	var (
+		chain            = &ChainClient{}
+		addr             = genAddress()
+		reorgs           []service.Reorg
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		storage          = memory.NewStorage()
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(100*time.Millisecond, 10, service.WithReorgHandler(
+			func(_ context.Context, reorg service.Reorg) {
+				reorgs = append(reorgs, reorg)
+			},
+		))
+		svc = service.NewService(chain, blockNumberStore, storage, loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr))
+
+	chain.Extend(0, "a", ancestor+2, addr)
+	blockNumberStore.SetCurrentBlock(ancestor)
+
+	// process two blocks of old chain on top of ancestor
+	for range 2 {
+		processed, err := svc.ProcessTransactions(ctx)
+		require.NoError(t, err)
+		require.True(t, processed)
+	}
+	require.Equal(t, ancestor+2, svc.GetCurrentBlock())
+	stored, err := svc.GetTransactionsInRange(ctx, ancestor+1, ancestor+2)
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+
+	stream, err := svc.Stream(ctx, []domain.Address{addr}, nil)
+	require.NoError(t, err)
+	watch := svc.Watch(ctx)
+
+	// replace two processed blocks by longer fork
+	chain.Extend(ancestor, "b", 3, addr)
+
+	processed, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	require.True(t, processed)
+	require.Equal(t, ancestor, svc.GetCurrentBlock())
+	require.Equal(t, []service.Reorg{
+		{
+			Depth:          2,
+			CommonAncestor: ancestor,
+			OrphanedBlocks: []string{"0xa102", "0xa101"},
+			RemovedTxs:     2,
+			Retracted:      stored,
+		},
+	}, reorgs)
+
+	for _, matched := range stored {
+		event := <-stream.Events()
+		require.True(t, event.Removed)
+		require.Equal(t, matched.Address, event.Address)
+		require.Equal(t, matched.Transaction, *event.Transaction)
+	}
+	require.Equal(t, domain.StreamEvent{
+		Block:    ancestor,
+		Orphaned: []string{"0xa102", "0xa101"},
+	}, <-watch.Events())
+
+	_, err = svc.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.ErrorIs(t, err, domain.ErrNoTransactions)
+
+	// re-ingest canonical branch
+	for range 3 {
+		processed, err = svc.ProcessTransactions(ctx)
+		require.NoError(t, err)
+		require.True(t, processed)
+	}
+	require.Equal(t, ancestor+3, svc.GetCurrentBlock())
+
+	page, err := svc.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	txs := page.Transactions
+	require.Len(t, txs, 3)
+	for _, tx := range txs {
+		require.Contains(t, tx.BlockHash, "0xb")
+	}
+}
+
+func TestProcessTransactionsHead(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		latest    = 100
+		finalized = 90
+	)
+	tests := map[string]struct {
+		options       []service.ConfigOption
+		currentBlock  int
+		expectedBlock int
+		processed     bool
+	}{
+		"1. Success: latest head": {
+			currentBlock:  latest - 1,
+			expectedBlock: latest,
+			processed:     true,
+		},
+		"2. Success: latest head minus confirmations": {
+			options:       []service.ConfigOption{service.WithConfirmations(5)},
+			expectedBlock: latest - 5,
+			processed:     true,
+		},
+		"3. Success: finalized head": {
+			options:       []service.ConfigOption{service.WithHeadTag(domain.BlockTagFinalized)},
+			currentBlock:  finalized - 1,
+			expectedBlock: finalized,
+			processed:     true,
+		},
+		"4. Skip: confirmed head behind processed block": {
+			options:       []service.ConfigOption{service.WithConfirmations(10)},
+			currentBlock:  latest - 5,
+			expectedBlock: latest - 5,
+			processed:     false,
+		},
+	}
+	for name, testCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				ethClient        = &EthRpcClient{}
+				loggr            = logger.NewAttrLogger(logger.NewLogger())
+				blockNumberStore = memory.NewBlockNumberStorage()
+				cfg              = service.NewConfig(100*time.Millisecond, 10, testCase.options...)
+				svc              = service.NewService(ethClient, blockNumberStore, memory.NewStorage(), loggr, cfg)
+			)
+			blockNumberStore.SetCurrentBlock(testCase.currentBlock)
+
+			ethClient.On("GetBlockNumber", mock.Anything).Return(latest, error(nil))
+			ethClient.On("GetBlockNumberByTag", domain.BlockTagFinalized).Return(finalized, error(nil))
+			ethClient.On("GetBlockTxsByNumber", mock.Anything, mock.Anything).Return([]domain.Transaction{
+				{From: genAddress(), TransactionIndex: converter.FormatHexInt(1)},
+			}, error(nil))
+
+			processed, err := svc.ProcessTransactions(ctx)
+			require.NoError(t, err)
+			require.Equal(t, testCase.processed, processed)
+			require.Equal(t, testCase.expectedBlock, svc.GetCurrentBlock())
+		})
+	}
+}
+
+func TestProcessTransactionsCatchUp(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		start      = 100
+		head       = 110
+		maxBatch   = 4
+		reorgDepth = 3
+	)
+	var (
+		chain            = &ChainClient{}
+		addr             = genAddress()
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(100*time.Millisecond, 10,
+			service.WithMaxBatch(maxBatch),
+			service.WithReorgDepth(reorgDepth),
+		)
+		svc = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr))
+
+	chain.Extend(0, "a", head, addr)
+	blockNumberStore.SetCurrentBlock(start)
+
+	for _, expected := range []struct {
+		block int
+		lag   int
+	}{
+		{block: 104, lag: 6},
+		{block: 108, lag: 2},
+		{block: 110, lag: 0},
+		// reached head, block is processed again without new transactions
+		{block: 110, lag: 0},
+	} {
+		processed, err := svc.ProcessTransactions(ctx)
+		require.NoError(t, err)
+		require.True(t, processed)
+		require.Equal(t, expected.block, svc.GetCurrentBlock())
+		require.Equal(t, expected.lag, svc.Lag())
+	}
+
+	// processed indexes are kept only for blocks within reorg depth
+	for number := start + 1; number <= head; number++ {
+		_, ok := blockNumberStore.GetLastProcessedTxIndex(number)
+		require.Equal(t, number > head-reorgDepth, ok, "block %d", number)
+	}
+
+	page, err := svc.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	txs := page.Transactions
+	require.Len(t, txs, head-start)
+	for i, tx := range txs {
+		require.Equal(t, converter.FormatHexInt(start+i+1), tx.BlockNumber)
+	}
+}
+
+// FailingBlocksStorage - blocks storage which fails checkpoint reads and writes while failing is set
+type FailingBlocksStorage struct {
+	service.BlocksStorage
+	failing atomic.Bool
+	mu      sync.Mutex
+	err     error
+}
+
+var errBlocksStorage = errors.New("blocks storage is down")
+
+func (f *FailingBlocksStorage) fail() bool {
+	if !f.failing.Load() {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = errBlocksStorage
+
+	return true
+}
+
+func (f *FailingBlocksStorage) GetCurrentBlock() int {
+	if f.fail() {
+		return 0
+	}
+
+	return f.BlocksStorage.GetCurrentBlock()
+}
+
+func (f *FailingBlocksStorage) SetCurrentBlock(block int) {
+	if !f.fail() {
+		f.BlocksStorage.SetCurrentBlock(block)
+	}
+}
+
+func (f *FailingBlocksStorage) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.err
+	f.err = nil
+
+	return err
+}
+
+var _ service.FallibleBlocksStorage = (*FailingBlocksStorage)(nil)
+
+func TestProcessTransactionsBlocksStorageFailure(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		start = 100
+		head  = 110
+	)
+	var (
+		chain  = &ChainClient{}
+		addr   = genAddress()
+		loggr  = logger.NewAttrLogger(logger.NewLogger())
+		blocks = &FailingBlocksStorage{BlocksStorage: memory.NewBlockNumberStorage()}
+		cfg    = service.NewConfig(100*time.Millisecond, 10)
+		svc    = service.NewService(chain, blocks, memory.NewStorage(), loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr))
+	chain.Extend(0, "a", head, addr)
+	blocks.SetCurrentBlock(start)
+
+	// failed checkpoint read is not taken for empty storage starting from head
+	blocks.failing.Store(true)
+	_, err := svc.ProcessTransactions(ctx)
+	require.ErrorIs(t, err, errBlocksStorage)
+	blocks.failing.Store(false)
+	require.Equal(t, start, svc.GetCurrentBlock())
+
+	processed, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	require.True(t, processed)
+	require.Equal(t, start+1, svc.GetCurrentBlock())
+
+	page, err := svc.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+	require.Equal(t, converter.FormatHexInt(start+1), page.Transactions[0].BlockNumber)
+}
+
+func TestProcessTransactionsReplay(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		start = 100
+		head  = 103
+	)
+	var (
+		chain            = &ChainClient{}
+		addr             = genAddress()
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(100*time.Millisecond, 10, service.WithMaxBatch(head-start))
+		svc              = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr))
+	listener, err := svc.Stream(ctx, []domain.Address{addr}, nil)
+	require.NoError(t, err)
+
+	chain.Extend(0, "a", head, addr)
+	// the second run replays blocks as after restore of stale checkpoint
+	for range 2 {
+		blockNumberStore.SetCurrentBlock(start)
+		for number := start + 1; number <= head; number++ {
+			blockNumberStore.DelLastProcessedTxIndex(number)
+		}
+		processed, err := svc.ProcessTransactions(ctx)
+		require.NoError(t, err)
+		require.True(t, processed)
+		require.Equal(t, head, svc.GetCurrentBlock())
+	}
+	// replayed transactions are stored and published once
+	require.Len(t, receive(listener), head-start)
+
+	page, err := svc.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, head-start)
+}
+
+func TestLookupTransactions(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		start = 100
+		head  = 103
+	)
+	var (
+		chain            = &ChainClient{}
+		addr             = genAddress()
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(100*time.Millisecond, 10, service.WithMaxBatch(head-start), service.WithMaxBlockRange(2))
+		svc              = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr))
+	blockNumberStore.SetCurrentBlock(start)
+	chain.Extend(0, "a", head, addr)
+	_, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+
+	matched, err := svc.GetTransactionsInRange(ctx, start+2, start+3)
+	require.NoError(t, err)
+	require.Len(t, matched, 2)
+	require.Equal(t, addr, matched[0].Address)
+	require.Equal(t, converter.FormatHexInt(start+2), matched[0].Transaction.BlockNumber)
+
+	found, err := svc.GetTransactionByHash(ctx, matched[1].Transaction.Hash)
+	require.NoError(t, err)
+	require.Equal(t, matched[1:], found)
+
+	_, err = svc.GetTransactionByHash(ctx, "0x0")
+	require.ErrorIs(t, err, domain.ErrTransactionNotFound)
+
+	for _, blocks := range [][2]int{{start + 2, start + 1}, {-1, 0}, {start, start + 2}} {
+		_, err = svc.GetTransactionsInRange(ctx, blocks[0], blocks[1])
+		require.ErrorIs(t, err, domain.ErrInvalidBlockRange)
+	}
+}
+
+func TestGetTransactionsPages(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		start = 100
+		head  = 105
+	)
+	var (
+		chain            = &ChainClient{}
+		addr             = genAddress()
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(100*time.Millisecond, 10, service.WithMaxBatch(head-start))
+		svc              = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr))
+	blockNumberStore.SetCurrentBlock(start)
+	chain.Extend(0, "a", head, addr)
+	_, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+
+	query := domain.TxQuery{
+		FromBlock: start + 2,
+		Direction: domain.DirectionOut,
+		Order:     domain.TxOrderDesc,
+		Limit:     2,
+	}
+	for _, blocks := range [][]int{{start + 5, start + 4}, {start + 3, start + 2}} {
+		page, err := svc.GetTransactions(ctx, addr, query)
+		require.NoError(t, err)
+		require.Len(t, page.Transactions, len(blocks))
+		for i, number := range blocks {
+			require.Equal(t, converter.FormatHexInt(number), page.Transactions[i].BlockNumber)
+		}
+		require.NotEmpty(t, page.NextToken)
+		query, err = domain.ParseTxQueryToken(page.NextToken)
+		require.NoError(t, err)
+	}
+	// the last full page is followed by empty one which keeps cursor
+	page, err := svc.GetTransactions(ctx, addr, query)
+	require.NoError(t, err)
+	require.Empty(t, page.Transactions)
+	require.Empty(t, page.NextToken)
+	require.Equal(t, query.Cursor(), page.Next)
+
+	_, err = svc.GetTransactions(ctx, addr, domain.TxQuery{FromBlock: head + 1})
+	require.ErrorIs(t, err, domain.ErrNoTransactions, "query without cursor")
+
+	for _, invalid := range []domain.TxQuery{
+		{Direction: "sideways"},
+		{FromBlock: 3, ToBlock: 2},
+		{Order: "random"},
+		{MinValue: big.NewInt(-1)},
+	} {
+		_, err = svc.GetTransactions(ctx, addr, invalid)
+		require.ErrorIs(t, err, domain.ErrInvalidTxQuery)
+	}
+	_, err = domain.ParseTxQueryToken("not a token")
+	require.ErrorIs(t, err, domain.ErrInvalidTxQuery)
+}
+
+func TestSubscriptions(t *testing.T) {
+	ctx := context.Background()
+
+	for _, purge := range []bool{false, true} {
+		t.Run(fmt.Sprintf("purge %t", purge), func(t *testing.T) {
+			var (
+				chain   = &ChainClient{}
+				addr    = genAddress()
+				storage = memory.NewStorage()
+				cfg     = service.NewConfig(100*time.Millisecond, 10, service.WithPurgeOnUnsubscribe(purge))
+				svc     = service.NewService(chain, memory.NewBlockNumberStorage(), storage, logger.NewAttrLogger(logger.NewLogger()), cfg)
+			)
+			require.NoError(t, svc.Subscribe(ctx, addr))
+			chain.Extend(0, "a", 1, addr)
+			_, err := svc.ProcessTransactions(ctx)
+			require.NoError(t, err)
+
+			sub, err := svc.GetSubscription(ctx, addr)
+			require.NoError(t, err)
+			require.Equal(t, 1, sub.Matched)
+			page, err := svc.ListSubscriptions(ctx, domain.SubscriptionQuery{})
+			require.NoError(t, err)
+			require.Equal(t, []domain.Subscription{sub}, page.Subscriptions)
+
+			_, err = svc.Unsubscribe(ctx, "0xinvalid")
+			require.ErrorIs(t, err, domain.ErrInvalidAddress)
+			removed, err := svc.Unsubscribe(ctx, addr)
+			require.NoError(t, err)
+			_, err = svc.GetSubscription(ctx, addr)
+			require.ErrorIs(t, err, domain.ErrAddressNotSubscribed)
+			_, err = svc.GetTransactions(ctx, addr, domain.TxQuery{})
+			require.ErrorIs(t, err, domain.ErrAddressNotSubscribed)
+
+			stored, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+			require.NoError(t, err)
+			if purge {
+				require.Equal(t, 1, removed)
+				require.Empty(t, stored.Transactions)
+			} else {
+				require.Zero(t, removed)
+				require.Len(t, stored.Transactions, 1)
+			}
 		})
 	}
 }
+
+func TestProcessTransactionsReceipts(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		head = 100
+	)
+	var (
+		chain            = &ChainClient{}
+		addr             = genAddress()
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(100*time.Millisecond, 10, service.WithReceipts(true))
+		svc              = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr))
+
+	chain.Extend(0, "a", head, addr)
+	blockNumberStore.SetCurrentBlock(head - 1)
+
+	processed, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	require.True(t, processed)
+
+	page, err := svc.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	txs := page.Transactions
+	require.Len(t, txs, 1)
+	require.Equal(t, domain.TxStatusSuccess, txs[0].Status)
+	require.Equal(t, converter.FormatHexInt(21000), txs[0].GasUsed)
+}
+
+// ReceiptsCountingClient - counts fetches of block receipts
+type ReceiptsCountingClient struct {
+	*ChainClient
+	fetches atomic.Int64
+}
+
+func (c *ReceiptsCountingClient) GetBlockReceipts(ctx context.Context, number int, txHashes []string) ([]domain.Receipt, error) {
+	c.fetches.Add(1)
+
+	return c.ChainClient.GetBlockReceipts(ctx, number, txHashes)
+}
+
+func TestProcessTransactionsHeadReprocess(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		head = 100
+	)
+	var (
+		chain            = &ReceiptsCountingClient{ChainClient: &ChainClient{}}
+		addr             = genAddress()
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(100*time.Millisecond, 10, service.WithReceipts(true))
+		svc              = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr))
+	watch := svc.Watch(ctx)
+	defer watch.Close()
+
+	chain.Extend(0, "a", head, addr)
+	blockNumberStore.SetCurrentBlock(head - 1)
+
+	for range 3 {
+		processed, err := svc.ProcessTransactions(ctx)
+		require.NoError(t, err)
+		require.True(t, processed)
+	}
+	events := receive(watch)
+	require.Len(t, events, 1, "head block is published once")
+	require.Equal(t, head, events[0].Block)
+	require.EqualValues(t, 1, chain.fetches.Load(), "receipts of checkpointed head block are not fetched again")
+
+	chain.Extend(head, "a", 1, addr)
+	processed, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	require.True(t, processed)
+	events = receive(watch)
+	require.Len(t, events, 1)
+	require.Equal(t, head+1, events[0].Block)
+	require.EqualValues(t, 2, chain.fetches.Load())
+
+	page, err := svc.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 2)
+}
+
+func TestProcessTransactionsTokenTransfers(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		head = 100
+	)
+	var (
+		sender           = genAddress()
+		receiver         = genAddress()
+		token            = genAddress()
+		chain            = &ChainClient{}
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(100*time.Millisecond, 10, service.WithTokenTransfers(true))
+		svc              = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, receiver))
+
+	// sender calls token contract to transfer 1000000 (0xf4240) token units to subscribed receiver
+	chain.Extend(0, "a", head, sender)
+	txHash := chain.blocks[head].Transactions[0].Hash
+	chain.logs = map[string][]domain.Log{
+		txHash: {
+			{
+				Address: token,
+				Topics: []string{
+					domain.TransferEventTopic,
+					"0x000000000000000000000000" + string(sender[2:]),
+					"0x000000000000000000000000" + string(receiver[2:]),
+				},
+				Data:            "0x00000000000000000000000000000000000000000000000000000000000f4240",
+				LogIndex:        "0x3",
+				TransactionHash: txHash,
+			},
+		},
+	}
+	blockNumberStore.SetCurrentBlock(head - 1)
+
+	processed, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	require.True(t, processed)
+
+	page, err := svc.GetTransactions(ctx, receiver, domain.TxQuery{})
+	require.NoError(t, err)
+	txs := page.Transactions
+	require.Len(t, txs, 1)
+	require.Equal(t, txHash, txs[0].Hash)
+	require.Equal(t, domain.TxKindToken, txs[0].Kind)
+	require.Equal(t, &domain.TokenTransfer{
+		Token:    token,
+		From:     sender,
+		To:       receiver,
+		Amount:   "1000000",
+		LogIndex: "0x3",
+	}, txs[0].TokenTransfer)
+}
+
+func TestProcessTransactionsInternalTransfers(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		head = 100
+	)
+	var (
+		sender           = genAddress()
+		multisig         = genAddress()
+		payee            = genAddress()
+		chain            = &ChainClient{}
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(100*time.Millisecond, 10, service.WithInternalTransfers(true))
+		svc              = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	require.NoError(t, svc.Subscribe(ctx, payee))
+
+	// sender executes multisig which pays out to subscribed payee
+	chain.Extend(0, "a", head, sender)
+	chain.calls = map[int][]domain.Transaction{
+		head: {
+			{
+				TransactionIndex: converter.FormatHexInt(0),
+				From:             multisig,
+				To:               payee,
+				Value:            "0xde0b6b3a7640000",
+				TraceAddress:     "0",
+			},
+		},
+	}
+	blockNumberStore.SetCurrentBlock(head - 1)
+
+	processed, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	require.True(t, processed)
+
+	page, err := svc.GetTransactions(ctx, payee, domain.TxQuery{})
+	require.NoError(t, err)
+	txs := page.Transactions
+	require.Len(t, txs, 1)
+	require.Equal(t, domain.TxKindInternal, txs[0].Kind)
+	require.Equal(t, chain.blocks[head].Transactions[0].Hash, txs[0].Hash)
+	require.Equal(t, chain.blocks[head].Hash, txs[0].BlockHash)
+	require.Equal(t, multisig, txs[0].From)
+	require.Equal(t, "0xde0b6b3a7640000", txs[0].Value)
+}
+
+type HeadsNotifier struct {
+	heads     chan int
+	connected atomic.Bool
+}
+
+func (n *HeadsNotifier) Heads() <-chan int {
+	return n.heads
+}
+
+func (n *HeadsNotifier) Connected() bool {
+	return n.connected.Load()
+}
+
+var _ service.HeadsNotifier = (*HeadsNotifier)(nil)
+
+func TestRunPushedHeads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	const (
+		head = 100
+	)
+	var (
+		chain            = &ChainClient{}
+		notifier         = &HeadsNotifier{heads: make(chan int)}
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		// interval is too long to poll new heads during the test
+		cfg = service.NewConfig(time.Hour, 10, service.WithHeadsNotifier(notifier))
+		svc = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	chain.Extend(0, "a", head, genAddress())
+	blockNumberStore.SetCurrentBlock(head - 1)
+	notifier.connected.Store(true)
+
+	go svc.Run(ctx)
+
+	// initial tick is processed on start
+	require.Eventually(t, func() bool {
+		return svc.GetCurrentBlock() == head
+	}, time.Second, time.Millisecond)
+
+	for number := head + 1; number <= head+3; number++ {
+		chain.Extend(number-1, "a", 1, genAddress())
+		notifier.heads <- number
+
+		require.Eventually(t, func() bool {
+			return svc.GetCurrentBlock() == number
+		}, time.Second, time.Millisecond)
+	}
+}
+
+func TestRunPushedHeadsPoll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	const (
+		head = 100
+	)
+	var (
+		chain            = &ChainClient{}
+		notifier         = &HeadsNotifier{heads: make(chan int)}
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		cfg              = service.NewConfig(time.Millisecond, 10,
+			service.WithHeadsNotifier(notifier),
+			service.WithPushedHeadsPoll(10*time.Millisecond),
+		)
+		svc = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	chain.Extend(0, "a", head, genAddress())
+	blockNumberStore.SetCurrentBlock(head - 1)
+	notifier.connected.Store(true)
+
+	go svc.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		return svc.GetCurrentBlock() == head
+	}, time.Second, time.Millisecond)
+
+	// push transport looks connected but does not deliver heads
+	chain.Extend(head, "a", 1, genAddress())
+	require.Eventually(t, func() bool {
+		return svc.GetCurrentBlock() == head+1
+	}, time.Second, time.Millisecond)
+}
+
+// CountingClient - counts polls of chain head
+type CountingClient struct {
+	*ChainClient
+	polls atomic.Int64
+}
+
+func (c *CountingClient) GetBlockNumber(ctx context.Context) (int, error) {
+	c.polls.Add(1)
+
+	return c.ChainClient.GetBlockNumber(ctx)
+}
+
+func TestRunCatchUpFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	const (
+		start = 100
+		head  = 110
+	)
+	var (
+		chain            = &CountingClient{ChainClient: &ChainClient{}}
+		loggr            = logger.NewAttrLogger(logger.NewLogger())
+		blockNumberStore = memory.NewBlockNumberStorage()
+		// interval is too long to poll again during the test
+		cfg = service.NewConfig(time.Hour, 10, service.WithMaxBatch(2))
+		svc = service.NewService(chain, blockNumberStore, memory.NewStorage(), loggr, cfg)
+	)
+	chain.Extend(0, "a", head, genAddress())
+	blockNumberStore.SetCurrentBlock(start)
+
+	processed, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	require.True(t, processed)
+	require.Positive(t, svc.Lag())
+
+	// node fails to serve blocks of the rest of backlog
+	chain.mu.Lock()
+	for number := start + 3; number <= head; number++ {
+		delete(chain.blocks, number)
+	}
+	chain.mu.Unlock()
+	chain.polls.Store(0)
+
+	go svc.Run(ctx)
+
+	// the initial run fails and is not retried immediately
+	require.Eventually(t, func() bool {
+		return chain.polls.Load() > 0
+	}, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 1, chain.polls.Load())
+	require.Equal(t, start+2, svc.GetCurrentBlock())
+}
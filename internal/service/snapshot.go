@@ -0,0 +1,270 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+// SnapshotVersion - version of snapshot written by Export, Import reads versions up to it
+const SnapshotVersion = 1
+
+const (
+	recordHeader      = "header"
+	recordCheckpoint  = "checkpoint"
+	recordSubscriber  = "subscriber"
+	recordTransaction = "transaction"
+	recordWebhook     = "webhook"
+
+	// exportPageSize - count of address transactions read per storage call while exporting
+	exportPageSize = 1000
+	// maxRecordSize - max size of snapshot line
+	maxRecordSize = 16 << 20
+)
+
+// snapshotRecord - line of JSONL snapshot, the first line is header with version
+type snapshotRecord struct {
+	Type         string              `json:"type"`
+	Version      int                 `json:"version,omitempty"`
+	CreatedAt    *time.Time          `json:"createdAt,omitempty"`
+	CurrentBlock int                 `json:"currentBlock,omitempty"`
+	Address      domain.Address      `json:"address,omitempty"`
+	Transaction  *domain.Transaction `json:"transaction,omitempty"`
+	Webhook      *domain.Webhook     `json:"webhook,omitempty"`
+}
+
+type ExportStats struct {
+	Subscribers  int `json:"subscribers"`
+	Webhooks     int `json:"webhooks"`
+	Transactions int `json:"transactions"`
+}
+
+type ImportStats struct {
+	Subscribers  int `json:"subscribers"`
+	Webhooks     int `json:"webhooks"`
+	Transactions int `json:"transactions"`
+	// Duplicates - records repeated in snapshot, subscribers, webhooks and transactions already stored
+	Duplicates int `json:"duplicates"`
+	// Invalid - skipped records with invalid address or webhook, or webhook of not subscribed address
+	Invalid int `json:"invalid"`
+	// CurrentBlock - restored checkpoint, 0 if storage already had one
+	CurrentBlock int `json:"currentBlock"`
+}
+
+// Export - writes checkpoint, subscribers with their webhooks and stored transactions as JSONL snapshot,
+// transactions of address are written in order of storing. Webhook secrets are written as is, pending
+// and dead deliveries are not exported
+func (s *Service) Export(ctx context.Context, w io.Writer) (ExportStats, error) {
+	var (
+		stats   ExportStats
+		buf     = bufio.NewWriter(w)
+		encoder = json.NewEncoder(buf)
+		now     = time.Now().UTC()
+	)
+	subscribers, err := s.storage.Subscribers(ctx)
+	if err != nil {
+		return stats, err
+	}
+	slices.Sort(subscribers)
+
+	currentBlock := s.blockStorage.GetCurrentBlock()
+	if err = s.blocksErr(); err != nil {
+		return stats, err
+	}
+
+	records := []snapshotRecord{
+		{Type: recordHeader, Version: SnapshotVersion, CreatedAt: &now},
+		{Type: recordCheckpoint, CurrentBlock: currentBlock},
+	}
+	for _, addr := range subscribers {
+		records = append(records, snapshotRecord{Type: recordSubscriber, Address: addr})
+	}
+	if webhooks, ok := StorageAs[WebhookStorage](s.storage); ok {
+		for _, addr := range subscribers {
+			webhook, err := webhooks.GetWebhook(ctx, addr)
+			if errors.Is(err, domain.ErrWebhookNotFound) {
+				continue
+			}
+			if err != nil {
+				return stats, err
+			}
+			records = append(records, snapshotRecord{Type: recordWebhook, Address: addr, Webhook: &webhook})
+			stats.Webhooks++
+		}
+	}
+	for _, record := range records {
+		if err = encoder.Encode(record); err != nil {
+			return stats, err
+		}
+	}
+	stats.Subscribers = len(subscribers)
+
+	for _, addr := range subscribers {
+		query := domain.TxQuery{Limit: exportPageSize}
+		for {
+			page, err := s.storage.GetTransactions(ctx, addr, query)
+			if err != nil {
+				return stats, err
+			}
+			for _, tx := range page.Transactions {
+				if err = encoder.Encode(snapshotRecord{Type: recordTransaction, Address: addr, Transaction: &tx}); err != nil {
+					return stats, err
+				}
+			}
+			stats.Transactions += len(page.Transactions)
+			if len(page.Transactions) < exportPageSize {
+				break
+			}
+			query.After = page.Next
+		}
+	}
+
+	return stats, buf.Flush()
+}
+
+// Import - stores subscribers, webhooks and transactions of JSONL snapshot, records with invalid address are
+// skipped and repeated records are stored once, webhook already set is kept. Checkpoint is restored only if storage has none, so import
+// does not move processing of running instance back
+func (s *Service) Import(ctx context.Context, r io.Reader) (ImportStats, error) {
+	var (
+		stats        ImportStats
+		scanner      = bufio.NewScanner(r)
+		line         int
+		header       bool
+		currentBlock int
+		subscribers  = make(map[domain.Address]struct{})
+		txKeys       = make(map[domain.Address]map[string]struct{})
+	)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxRecordSize)
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record snapshotRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return stats, fmt.Errorf("line %d: %w", line, errors.Join(domain.ErrInvalidSnapshot, err))
+		}
+		if !header {
+			if record.Type != recordHeader {
+				return stats, fmt.Errorf("line %d: %w: missing header", line, domain.ErrInvalidSnapshot)
+			}
+			if record.Version < 1 || record.Version > SnapshotVersion {
+				return stats, fmt.Errorf("%w: %d", domain.ErrUnsupportedSnapshot, record.Version)
+			}
+			header = true
+
+			continue
+		}
+		switch record.Type {
+		case recordCheckpoint:
+			currentBlock = record.CurrentBlock
+		case recordSubscriber:
+			if !record.Address.Valid() {
+				stats.Invalid++
+
+				continue
+			}
+			if _, ok := subscribers[record.Address]; ok {
+				stats.Duplicates++
+
+				continue
+			}
+			subscribers[record.Address] = struct{}{}
+			err := s.storage.AddSubscriber(ctx, record.Address)
+			if errors.Is(err, domain.ErrAddressAlreadySubscribed) {
+				stats.Duplicates++
+
+				continue
+			}
+			if err != nil {
+				return stats, fmt.Errorf("line %d: %w", line, err)
+			}
+			stats.Subscribers++
+		case recordWebhook:
+			if !record.Address.Valid() || record.Webhook == nil {
+				stats.Invalid++
+
+				continue
+			}
+			_, err := s.GetWebhook(ctx, record.Address)
+			switch {
+			case err == nil:
+				stats.Duplicates++
+
+				continue
+			case errors.Is(err, domain.ErrAddressNotSubscribed):
+				stats.Invalid++
+
+				continue
+			case !errors.Is(err, domain.ErrWebhookNotFound):
+				return stats, fmt.Errorf("line %d: %w", line, err)
+			}
+			err = s.SetWebhook(ctx, record.Address, *record.Webhook)
+			if errors.Is(err, domain.ErrInvalidWebhook) {
+				stats.Invalid++
+
+				continue
+			}
+			if err != nil {
+				return stats, fmt.Errorf("line %d: %w", line, err)
+			}
+			stats.Webhooks++
+		case recordTransaction:
+			if !record.Address.Valid() || record.Transaction == nil {
+				stats.Invalid++
+
+				continue
+			}
+			keys, ok := txKeys[record.Address]
+			if !ok {
+				keys = make(map[string]struct{})
+				txKeys[record.Address] = keys
+			}
+			key := record.Transaction.Key()
+			if _, ok = keys[key]; ok {
+				stats.Duplicates++
+
+				continue
+			}
+			keys[key] = struct{}{}
+			added, err := s.storage.AddTx(ctx, record.Address, *record.Transaction)
+			if err != nil {
+				return stats, fmt.Errorf("line %d: %w", line, err)
+			}
+			if !added {
+				stats.Duplicates++
+
+				continue
+			}
+			stats.Transactions++
+		default:
+			return stats, fmt.Errorf("line %d: %w: unknown record type %q", line, domain.ErrInvalidSnapshot, record.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, errors.Join(domain.ErrInvalidSnapshot, err)
+	}
+	if !header {
+		return stats, fmt.Errorf("%w: empty", domain.ErrInvalidSnapshot)
+	}
+	if currentBlock == 0 {
+		return stats, nil
+	}
+	stored := s.blockStorage.GetCurrentBlock()
+	// failed read must not be taken for storage without checkpoint
+	if err := s.blocksErr(); err != nil || stored != 0 {
+		return stats, err
+	}
+	s.blockStorage.SetCurrentBlock(currentBlock)
+	stats.CurrentBlock = currentBlock
+
+	return stats, s.blocksErr()
+}
@@ -0,0 +1,132 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/memory"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/storagetest"
+	"github.com/dmitrorezn/tx-parser/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		addr      = genAddress()
+		other     = genAddress()
+		storage   = memory.NewStorage()
+		srcBlocks = memory.NewBlockNumberStorage()
+		loggr     = logger.NewAttrLogger(logger.NewLogger())
+		src       = service.NewService(&EthRpcClient{}, srcBlocks, storage, loggr, service.NewConfig(time.Second, 1))
+	)
+	srcBlocks.SetCurrentBlock(42)
+	require.NoError(t, src.Subscribe(ctx, addr))
+	require.NoError(t, src.Subscribe(ctx, other))
+	webhook := domain.Webhook{URL: "https://example.com/hook", Secret: "secret"}
+	require.NoError(t, src.SetWebhook(ctx, other, webhook))
+	for _, hash := range []string{"0x1", "0x2", "0x3"} {
+		storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: hash, BlockHash: "0xa", BlockNumber: "0x1"})
+	}
+
+	var snapshot bytes.Buffer
+	exported, err := src.Export(ctx, &snapshot)
+	require.NoError(t, err)
+	require.Equal(t, service.ExportStats{Subscribers: 2, Webhooks: 1, Transactions: 3}, exported)
+
+	dst, dstBlocks, _ := setup(t, 0)
+	imported, err := dst.Import(ctx, bytes.NewReader(snapshot.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, service.ImportStats{Subscribers: 2, Webhooks: 1, Transactions: 3, CurrentBlock: 42}, imported)
+	require.Equal(t, srcBlocks.GetCurrentBlock(), dstBlocks.GetCurrentBlock())
+	importedWebhook, err := dst.GetWebhook(ctx, other)
+	require.NoError(t, err)
+	require.Equal(t, webhook, importedWebhook)
+
+	page, err := dst.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 3)
+	require.Equal(t, "0x1", page.Transactions[0].Hash)
+
+	// import of the same snapshot again stores nothing new
+	imported, err = dst.Import(ctx, bytes.NewReader(snapshot.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, 6, imported.Duplicates)
+	require.Zero(t, imported.Subscribers)
+	require.Zero(t, imported.Webhooks)
+	require.Zero(t, imported.Transactions)
+	require.Zero(t, imported.CurrentBlock)
+	page, err = dst.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 3)
+}
+
+func TestImportValidation(t *testing.T) {
+	ctx := context.Background()
+	addr := genAddress()
+
+	tests := []struct {
+		name     string
+		snapshot string
+		stats    service.ImportStats
+		err      error
+	}{
+		{
+			name: "invalid and repeated records",
+			snapshot: `{"type":"header","version":1}
+{"type":"subscriber","address":"0xinvalid"}
+{"type":"subscriber","address":"` + string(addr) + `"}
+{"type":"subscriber","address":"` + string(addr) + `"}
+{"type":"transaction","address":"` + string(addr) + `","transaction":{"hash":"0x1"}}
+{"type":"transaction","address":"` + string(addr) + `","transaction":{"hash":"0x1"}}
+{"type":"transaction","address":"0xinvalid","transaction":{"hash":"0x2"}}
+`,
+			stats: service.ImportStats{Subscribers: 1, Transactions: 1, Duplicates: 2, Invalid: 2},
+		},
+		{
+			name: "invalid and repeated webhooks",
+			snapshot: `{"type":"header","version":1}
+{"type":"subscriber","address":"` + string(addr) + `"}
+{"type":"webhook","address":"` + string(addr) + `","webhook":{"url":"ftp://example.com","secret":"secret"}}
+{"type":"webhook","address":"` + string(genAddress()) + `","webhook":{"url":"https://example.com","secret":"secret"}}
+{"type":"webhook","address":"` + string(addr) + `","webhook":{"url":"https://example.com","secret":"secret"}}
+{"type":"webhook","address":"` + string(addr) + `","webhook":{"url":"https://example.com/other","secret":"secret"}}
+`,
+			stats: service.ImportStats{Subscribers: 1, Webhooks: 1, Duplicates: 1, Invalid: 2},
+		},
+		{
+			name:     "unsupported version",
+			snapshot: `{"type":"header","version":2}`,
+			err:      domain.ErrUnsupportedSnapshot,
+		},
+		{
+			name:     "missing header",
+			snapshot: `{"type":"subscriber","address":"` + string(addr) + `"}`,
+			err:      domain.ErrInvalidSnapshot,
+		},
+		{
+			name:     "malformed line",
+			snapshot: "{\"type\":\"header\",\"version\":1}\n{",
+			err:      domain.ErrInvalidSnapshot,
+		},
+		{
+			name: "empty",
+			err:  domain.ErrInvalidSnapshot,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _, _ := setup(t, 0)
+			stats, err := svc.Import(ctx, strings.NewReader(tt.snapshot))
+			require.ErrorIs(t, err, tt.err)
+			if tt.err == nil {
+				require.Equal(t, tt.stats, stats)
+			}
+		})
+	}
+}
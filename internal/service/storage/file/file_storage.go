@@ -0,0 +1,306 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/memory"
+)
+
+// Storage - durable storage of subscribers, matched transactions and processing checkpoint.
+// Every change is appended to write-ahead log before it is applied to in-memory state,
+// log is compacted into snapshot after configured count of records.
+type Storage struct {
+	dir           string
+	sync          bool
+	snapshotEvery int
+
+	txs    *memory.Storage
+	blocks *memory.BlockNumberStorage
+
+	// mu - serializes log appends with applying them to in-memory state
+	mu      sync.Mutex
+	wal     *wal
+	seq     uint64
+	records int
+	// err - first failed write of block storage methods which can not return it
+	err error
+}
+
+const (
+	walFile      = "wal.log"
+	snapshotFile = "snapshot.json"
+
+	defaultSnapshotEvery = 10_000
+)
+
+var (
+	ErrClosed = errors.New("storage closed")
+)
+
+type Option func(*Storage)
+
+// WithSnapshotEvery - count of log records after which state is written to snapshot and log is truncated
+func WithSnapshotEvery(records int) Option {
+	return func(s *Storage) {
+		s.snapshotEvery = max(records, 1)
+	}
+}
+
+// WithSync - fsync log after each record, enabled by default.
+// Disabled sync keeps data on process crash but may lose the latest records on power loss
+func WithSync(sync bool) Option {
+	return func(s *Storage) {
+		s.sync = sync
+	}
+}
+
+// Open - opens storage in dir, restores state from snapshot and replays log written after it
+func Open(dir string, options ...Option) (*Storage, error) {
+	s := &Storage{
+		dir:           dir,
+		sync:          true,
+		snapshotEvery: defaultSnapshotEvery,
+		txs:           memory.NewStorage(),
+		blocks:        memory.NewBlockNumberStorage(),
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, fmt.Errorf("load snapshot: %w", err)
+	}
+	snapshotSeq := s.seq
+	w, err := openWAL(filepath.Join(dir, walFile), s.sync, func(payload []byte) error {
+		var rec record
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return err
+		}
+		// records written before crash between snapshot and log truncation are already in snapshot
+		if rec.Seq <= snapshotSeq {
+			return nil
+		}
+		s.apply(rec)
+		s.seq = rec.Seq
+		s.records++
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("replay wal: %w", err)
+	}
+	s.wal = w
+
+	return s, nil
+}
+
+// Err - first write error of block storage methods since the previous call, cleared by the call
+func (s *Storage) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.err
+	s.err = nil
+
+	return err
+}
+
+// Close - writes snapshot and closes log
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wal == nil {
+		return ErrClosed
+	}
+	err := s.snapshot()
+	err = errors.Join(err, s.wal.close())
+	s.wal = nil
+
+	return err
+}
+
+// Snapshot - writes state to snapshot and truncates log
+func (s *Storage) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wal == nil {
+		return ErrClosed
+	}
+
+	return s.snapshot()
+}
+
+// write - appends record to log and applies it, returns count of removed or added transactions, caller must hold mu
+func (s *Storage) write(rec record) (int, error) {
+	if err := s.append(rec); err != nil {
+		return 0, err
+	}
+	removed := s.apply(rec)
+
+	return removed, s.compact()
+}
+
+// append - appends record to log, caller must hold mu
+func (s *Storage) append(rec record) error {
+	if s.wal == nil {
+		return ErrClosed
+	}
+	rec.Seq = s.seq + 1
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err = s.wal.append(payload); err != nil {
+		return err
+	}
+	s.seq = rec.Seq
+
+	return nil
+}
+
+// compact - writes snapshot when log has enough records, caller must hold mu
+func (s *Storage) compact() error {
+	if s.records++; s.records < s.snapshotEvery {
+		return nil
+	}
+
+	return s.snapshot()
+}
+
+// writeBlocks - writes record of block storage method, failure is kept to be reported by Err
+func (s *Storage) writeBlocks(rec record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.write(rec); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *Storage) AddSubscriber(ctx context.Context, addr domain.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if exists, _ := s.txs.ExistsSubscriber(ctx, addr); exists {
+		return domain.ErrAddressAlreadySubscribed
+	}
+
+	_, err := s.write(record{Op: opSubscribe, Addr: addr, At: time.Now()})
+
+	return err
+}
+
+func (s *Storage) Unsubscribe(ctx context.Context, addr domain.Address, purge bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if exists, _ := s.txs.ExistsSubscriber(ctx, addr); !exists {
+		return 0, domain.ErrAddressNotSubscribed
+	}
+
+	return s.write(record{Op: opUnsubscribe, Addr: addr, Purge: purge})
+}
+
+func (s *Storage) GetSubscription(ctx context.Context, addr domain.Address) (domain.Subscription, error) {
+	return s.txs.GetSubscription(ctx, addr)
+}
+
+func (s *Storage) ListSubscriptions(ctx context.Context, query domain.SubscriptionQuery) (domain.SubscriptionPage, error) {
+	return s.txs.ListSubscriptions(ctx, query)
+}
+
+func (s *Storage) ExistsSubscriber(ctx context.Context, addr domain.Address) (bool, error) {
+	return s.txs.ExistsSubscriber(ctx, addr)
+}
+
+func (s *Storage) Subscribers(ctx context.Context) ([]domain.Address, error) {
+	return s.txs.Subscribers(ctx)
+}
+
+func (s *Storage) ExistsSubscribers(ctx context.Context, addrs []domain.Address) ([]bool, error) {
+	return s.txs.ExistsSubscribers(ctx, addrs)
+}
+
+// AddTx - logs only transactions which are not stored yet, so repeated writes do not grow the log
+func (s *Storage) AddTx(_ context.Context, addr domain.Address, tx domain.Transaction) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.txs.HasTx(addr, tx.Key()) {
+		return false, nil
+	}
+	added, err := s.write(record{Op: opAddTx, Addr: addr, Tx: &tx})
+
+	return added > 0, err
+}
+
+func (s *Storage) DelBlockTxs(_ context.Context, blockHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(record{Op: opDelBlockTxs, Hash: blockHash})
+}
+
+func (s *Storage) GetTransactions(ctx context.Context, addr domain.Address, query domain.TxQuery) (domain.TxPage, error) {
+	return s.txs.GetTransactions(ctx, addr, query)
+}
+
+func (s *Storage) GetTransactionsByHash(ctx context.Context, hash string) ([]domain.MatchedTx, error) {
+	return s.txs.GetTransactionsByHash(ctx, hash)
+}
+
+func (s *Storage) GetTransactionsInRange(ctx context.Context, fromBlock, toBlock int) ([]domain.MatchedTx, error) {
+	return s.txs.GetTransactionsInRange(ctx, fromBlock, toBlock)
+}
+
+func (s *Storage) AckTransactions(_ context.Context, addr domain.Address, upTo uint64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(record{Op: opAck, Addr: addr, UpTo: upTo})
+}
+
+func (s *Storage) GetCurrentBlock() int {
+	return s.blocks.GetCurrentBlock()
+}
+
+func (s *Storage) SetCurrentBlock(currBlock int) {
+	s.writeBlocks(record{Op: opSetCurrentBlock, Block: currBlock})
+}
+
+func (s *Storage) DelLastProcessedTxIndex(blockNumber int) {
+	if _, ok := s.blocks.GetLastProcessedTxIndex(blockNumber); !ok {
+		return
+	}
+	s.writeBlocks(record{Op: opDelTxIndex, Block: blockNumber})
+}
+
+func (s *Storage) GetLastProcessedTxIndex(block int) (int, bool) {
+	return s.blocks.GetLastProcessedTxIndex(block)
+}
+
+func (s *Storage) SetLastProcessedTxIndex(block int, idx int) {
+	s.writeBlocks(record{Op: opSetTxIndex, Block: block, Idx: idx})
+}
+
+func (s *Storage) GetBlockHash(block int) (string, bool) {
+	return s.blocks.GetBlockHash(block)
+}
+
+func (s *Storage) SetBlockHash(block int, hash string) {
+	s.writeBlocks(record{Op: opSetBlockHash, Block: block, Hash: hash})
+}
+
+func (s *Storage) DelBlockHash(block int) {
+	if _, ok := s.blocks.GetBlockHash(block); !ok {
+		return
+	}
+	s.writeBlocks(record{Op: opDelBlockHash, Block: block})
+}
@@ -0,0 +1,264 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		storage, err := Open(t.TempDir())
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, storage.Close())
+		})
+
+		return storage
+	})
+}
+
+func TestReopen(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		dir  = t.TempDir()
+		addr = domain.Address("0xaddr")
+	)
+	storage, err := Open(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.AddSubscriber(ctx, addr))
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x1", BlockHash: "0xa"})
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x2", BlockHash: "0xb"})
+	removed, err := storage.DelBlockTxs(ctx, "0xb")
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	storage.SetCurrentBlock(10)
+	storage.SetLastProcessedTxIndex(10, 3)
+	storage.SetBlockHash(10, "0xa")
+	require.NoError(t, storage.Err())
+	// reopen without close as after crash
+	require.NoError(t, storage.wal.file.Close())
+
+	storage, err = Open(dir)
+	require.NoError(t, err)
+
+	exists, err := storage.ExistsSubscriber(ctx, addr)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.ErrorIs(t, storage.AddSubscriber(ctx, addr), domain.ErrAddressAlreadySubscribed)
+	require.Equal(t, 10, storage.GetCurrentBlock())
+	idx, ok := storage.GetLastProcessedTxIndex(10)
+	require.True(t, ok)
+	require.Equal(t, 3, idx)
+	hash, ok := storage.GetBlockHash(10)
+	require.True(t, ok)
+	require.Equal(t, "0xa", hash)
+
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+	require.Equal(t, "0x1", page.Transactions[0].Hash)
+	removed, err = storage.AckTransactions(ctx, addr, page.Next)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.NoError(t, storage.Close())
+
+	storage, err = Open(dir)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	page, err = storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Empty(t, page.Transactions)
+	// sequence is restored, so acknowledged cursor is not reused
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x3"})
+	page, err = storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), page.Next)
+}
+
+func TestReopenSubscriptions(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		dir     = t.TempDir()
+		addr    = domain.Address("0xaddr")
+		removed = domain.Address("0xremoved")
+	)
+	storage, err := Open(dir)
+	require.NoError(t, err)
+	for _, a := range []domain.Address{addr, removed} {
+		require.NoError(t, storage.AddSubscriber(ctx, a))
+		storagetest.AddTx(t, storage, a, domain.Transaction{Hash: "0x1", BlockHash: "0xa"})
+	}
+	purged, err := storage.Unsubscribe(ctx, removed, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	sub, err := storage.GetSubscription(ctx, addr)
+	require.NoError(t, err)
+	// the first reopen without close replays log, the second one restores snapshot written by close
+	require.NoError(t, storage.wal.file.Close())
+
+	for range 2 {
+		storage, err = Open(dir)
+		require.NoError(t, err)
+
+		restored, err := storage.GetSubscription(ctx, addr)
+		require.NoError(t, err)
+		require.True(t, sub.CreatedAt.Equal(restored.CreatedAt))
+		require.Equal(t, sub.Matched, restored.Matched)
+		require.Equal(t, sub.Stored, restored.Stored)
+		_, err = storage.GetSubscription(ctx, removed)
+		require.ErrorIs(t, err, domain.ErrAddressNotSubscribed)
+		page, err := storage.GetTransactions(ctx, removed, domain.TxQuery{})
+		require.NoError(t, err)
+		require.Empty(t, page.Transactions)
+		require.NoError(t, storage.Close())
+	}
+}
+
+func TestReopenWebhooks(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		dir     = t.TempDir()
+		addr    = domain.Address("0xaddr")
+		webhook = domain.Webhook{URL: "https://example.com/hook", Secret: "secret"}
+		now     = time.Now()
+	)
+	storage, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, storage.SetWebhook(ctx, addr, webhook))
+	pending := domain.NewDelivery(addr, domain.Transaction{Hash: "0x1", BlockHash: "0xa"}, now)
+	dead := domain.NewDelivery(addr, domain.Transaction{Hash: "0x2", BlockHash: "0xa"}, now)
+	delivered := domain.NewDelivery(addr, domain.Transaction{Hash: "0x3", BlockHash: "0xa"}, now)
+	for _, delivery := range []domain.Delivery{pending, dead, delivered} {
+		require.NoError(t, storage.AddDelivery(ctx, delivery))
+	}
+	dead.Status = domain.DeliveryDead
+	dead.Attempts = []domain.DeliveryAttempt{{At: now, Error: "connection refused"}}
+	require.NoError(t, storage.UpdateDelivery(ctx, dead))
+	require.NoError(t, storage.DelDelivery(ctx, delivered.ID))
+	// the first reopen without close replays log, the second one restores snapshot written by close
+	require.NoError(t, storage.wal.file.Close())
+
+	for range 2 {
+		storage, err = Open(dir)
+		require.NoError(t, err)
+
+		restored, err := storage.GetWebhook(ctx, addr)
+		require.NoError(t, err)
+		require.Equal(t, webhook, restored)
+		due, err := storage.DueDeliveries(ctx, now, 0)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		require.Equal(t, pending.ID, due[0].ID)
+		deadPage, err := storage.DeadDeliveries(ctx, domain.DeliveryQuery{})
+		require.NoError(t, err)
+		require.Len(t, deadPage, 1)
+		require.Equal(t, dead.ID, deadPage[0].ID)
+		require.Equal(t, dead.Attempts[0].Error, deadPage[0].Attempts[0].Error)
+		_, err = storage.GetDelivery(ctx, delivered.ID)
+		require.ErrorIs(t, err, domain.ErrDeliveryNotFound)
+		require.NoError(t, storage.Close())
+	}
+}
+
+func TestTornWrite(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		dir  = t.TempDir()
+		addr = domain.Address("0xaddr")
+	)
+	storage, err := Open(dir)
+	require.NoError(t, err)
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x1"})
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x2"})
+	require.NoError(t, storage.wal.file.Close())
+
+	path := filepath.Join(dir, walFile)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	// lose tail of the last record
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	storage, err = Open(dir)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+	require.Equal(t, "0x1", page.Transactions[0].Hash)
+	// log is appended after the last valid record
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x3"})
+	require.NoError(t, storage.wal.file.Close())
+
+	storage, err = Open(dir)
+	require.NoError(t, err)
+
+	page, err = storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 2)
+	require.Equal(t, "0x3", page.Transactions[1].Hash)
+}
+
+func TestDuplicateTx(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		addr = domain.Address("0xaddr")
+		tx   = domain.Transaction{Hash: "0x1", BlockHash: "0xa"}
+	)
+	storage, err := Open(t.TempDir())
+	require.NoError(t, err)
+	defer storage.Close()
+
+	storagetest.AddTx(t, storage, addr, tx)
+	size, records := storage.wal.size, storage.records
+
+	added, err := storage.AddTx(ctx, addr, tx)
+	require.NoError(t, err)
+	require.False(t, added)
+	require.Equal(t, size, storage.wal.size, "stored transaction is not logged again")
+	require.Equal(t, records, storage.records)
+}
+
+func TestSnapshot(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		dir  = t.TempDir()
+		addr = domain.Address("0xaddr")
+	)
+	storage, err := Open(dir, WithSnapshotEvery(2))
+	require.NoError(t, err)
+	for _, hash := range []string{"0x1", "0x2", "0x3"} {
+		storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: hash})
+	}
+	// the first two records are compacted into snapshot
+	_, err = os.Stat(filepath.Join(dir, snapshotFile))
+	require.NoError(t, err)
+	require.Equal(t, 1, storage.records)
+
+	walData, err := os.ReadFile(filepath.Join(dir, walFile))
+	require.NoError(t, err)
+
+	// crash between snapshot and log truncation leaves records already included into snapshot
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x4"})
+	require.Equal(t, 0, storage.records)
+	require.NoError(t, storage.wal.file.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, walFile), walData, 0o644))
+
+	storage, err = Open(dir)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 4)
+}
@@ -0,0 +1,102 @@
+package file
+
+import (
+	"context"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+type op string
+
+const (
+	opSubscribe       op = "subscribe"
+	opUnsubscribe     op = "unsubscribe"
+	opAddTx           op = "addTx"
+	opDelBlockTxs     op = "delBlockTxs"
+	opAck             op = "ack"
+	opSetCurrentBlock op = "setCurrentBlock"
+	opSetTxIndex      op = "setTxIndex"
+	opDelTxIndex      op = "delTxIndex"
+	opSetBlockHash    op = "setBlockHash"
+	opDelBlockHash    op = "delBlockHash"
+	opSetWebhook      op = "setWebhook"
+	opDelWebhook      op = "delWebhook"
+	opAddDelivery     op = "addDelivery"
+	opUpdateDelivery  op = "updateDelivery"
+	opDelDelivery     op = "delDelivery"
+)
+
+// record - single change of storage state written to log
+type record struct {
+	Seq   uint64              `json:"seq"`
+	Op    op                  `json:"op"`
+	Addr  domain.Address      `json:"addr,omitempty"`
+	Tx    *domain.Transaction `json:"tx,omitempty"`
+	Hash  string              `json:"hash,omitempty"`
+	Block int                 `json:"block,omitempty"`
+	Idx   int                 `json:"idx,omitempty"`
+	UpTo  uint64              `json:"upTo,omitempty"`
+	// At - time of subscription
+	At       time.Time        `json:"at,omitzero"`
+	Purge    bool             `json:"purge,omitempty"`
+	Webhook  *domain.Webhook  `json:"webhook,omitempty"`
+	Delivery *domain.Delivery `json:"delivery,omitempty"`
+	ID       string           `json:"id,omitempty"`
+}
+
+// apply - applies record to in-memory state, returns count of removed or added transactions
+func (s *Storage) apply(rec record) int {
+	ctx := context.Background()
+	switch rec.Op {
+	case opSubscribe:
+		_ = s.txs.AddSubscriberAt(ctx, rec.Addr, rec.At)
+	case opUnsubscribe:
+		removed, _ := s.txs.Unsubscribe(ctx, rec.Addr, rec.Purge)
+
+		return removed
+	case opAddTx:
+		if rec.Tx == nil {
+			return 0
+		}
+		if added, _ := s.txs.AddTx(ctx, rec.Addr, *rec.Tx); added {
+			return 1
+		}
+	case opDelBlockTxs:
+		removed, _ := s.txs.DelBlockTxs(ctx, rec.Hash)
+
+		return removed
+	case opAck:
+		removed, _ := s.txs.AckTransactions(ctx, rec.Addr, rec.UpTo)
+
+		return removed
+	case opSetCurrentBlock:
+		s.blocks.SetCurrentBlock(rec.Block)
+	case opSetTxIndex:
+		s.blocks.SetLastProcessedTxIndex(rec.Block, rec.Idx)
+	case opDelTxIndex:
+		s.blocks.DelLastProcessedTxIndex(rec.Block)
+	case opSetBlockHash:
+		s.blocks.SetBlockHash(rec.Block, rec.Hash)
+	case opDelBlockHash:
+		s.blocks.DelBlockHash(rec.Block)
+	case opSetWebhook:
+		if rec.Webhook != nil {
+			_ = s.txs.SetWebhook(ctx, rec.Addr, *rec.Webhook)
+		}
+	case opDelWebhook:
+		_ = s.txs.DelWebhook(ctx, rec.Addr)
+	case opAddDelivery:
+		if rec.Delivery != nil {
+			_ = s.txs.AddDelivery(ctx, *rec.Delivery)
+		}
+	case opUpdateDelivery:
+		if rec.Delivery != nil {
+			_ = s.txs.UpdateDelivery(ctx, *rec.Delivery)
+		}
+	case opDelDelivery:
+		_ = s.txs.DelDelivery(ctx, rec.ID)
+	}
+
+	return 0
+}
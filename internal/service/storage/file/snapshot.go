@@ -0,0 +1,85 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/memory"
+)
+
+// snapshotState - state of storage including all log records till Seq
+type snapshotState struct {
+	Seq     uint64             `json:"seq"`
+	Storage memory.State       `json:"storage"`
+	Blocks  memory.BlocksState `json:"blocks"`
+}
+
+func (s *Storage) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state snapshotState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	s.txs.Restore(state.Storage)
+	s.blocks.Restore(state.Blocks)
+	s.seq = state.Seq
+
+	return nil
+}
+
+// snapshot - atomically replaces snapshot file with current state and truncates log, caller must hold mu
+func (s *Storage) snapshot() error {
+	data, err := json.Marshal(snapshotState{
+		Seq:     s.seq,
+		Storage: s.txs.State(),
+		Blocks:  s.blocks.State(),
+	})
+	if err != nil {
+		return err
+	}
+	if err = writeFileSync(filepath.Join(s.dir, snapshotFile), data); err != nil {
+		return err
+	}
+	// crash before truncation is safe, replay skips records included into snapshot
+	if err = s.wal.reset(); err != nil {
+		return err
+	}
+	s.records = 0
+
+	return nil
+}
+
+// writeFileSync - writes data to temporary file and renames it, so file is either old or new after crash
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	if err = file.Sync(); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(dir.Sync(), dir.Close())
+}
@@ -0,0 +1,151 @@
+package file
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// wal - append only log of length and checksum prefixed records:
+// | uint32 payload length | uint32 crc32c of payload | payload |
+type wal struct {
+	file *os.File
+	sync bool
+	// size - offset of the end of the last valid record
+	size int64
+}
+
+const (
+	recordHeaderSize = 8
+	// maxRecordSize - bigger length means corrupted header
+	maxRecordSize = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	errTornRecord = errors.New("torn wal record")
+)
+
+// openWAL - opens log, calls apply for each valid record and truncates torn or corrupted tail
+func openWAL(path string, sync bool, apply func(payload []byte) error) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := &wal{
+		file: file,
+		sync: sync,
+	}
+	reader := bufio.NewReader(file)
+	for {
+		payload, err := readRecord(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, errTornRecord) {
+			// record was not completely written before crash, log is valid till its start
+			if err = w.truncate(); err != nil {
+				return nil, errors.Join(err, file.Close())
+			}
+
+			break
+		}
+		if err != nil {
+			return nil, errors.Join(err, file.Close())
+		}
+		if err = apply(payload); err != nil {
+			return nil, errors.Join(err, file.Close())
+		}
+		w.size += int64(recordHeaderSize + len(payload))
+	}
+	if _, err = file.Seek(w.size, io.SeekStart); err != nil {
+		return nil, errors.Join(err, file.Close())
+	}
+
+	return w, nil
+}
+
+func readRecord(reader io.Reader) ([]byte, error) {
+	var header [recordHeaderSize]byte
+	n, err := io.ReadFull(reader, header[:])
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil, io.EOF
+	case errors.Is(err, io.ErrUnexpectedEOF) && n > 0:
+		return nil, errTornRecord
+	case err != nil:
+		return nil, err
+	}
+	var (
+		length   = binary.LittleEndian.Uint32(header[:4])
+		checksum = binary.LittleEndian.Uint32(header[4:])
+	)
+	if length > maxRecordSize {
+		return nil, errTornRecord
+	}
+	payload := make([]byte, length)
+	if _, err = io.ReadFull(reader, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errTornRecord
+		}
+
+		return nil, err
+	}
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return nil, errTornRecord
+	}
+
+	return payload, nil
+}
+
+func (w *wal) truncate() error {
+	if err := w.file.Truncate(w.size); err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+// append - writes record and syncs it to disk, partially written record is truncated
+func (w *wal) append(payload []byte) error {
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.Checksum(payload, crcTable))
+	record = append(record, payload...)
+
+	if _, err := w.file.Write(record); err != nil {
+		return errors.Join(err, w.rollback())
+	}
+	if w.sync {
+		if err := w.file.Sync(); err != nil {
+			return errors.Join(err, w.rollback())
+		}
+	}
+	w.size += int64(len(record))
+
+	return nil
+}
+
+func (w *wal) rollback() error {
+	if err := w.truncate(); err != nil {
+		return err
+	}
+	_, err := w.file.Seek(w.size, io.SeekStart)
+
+	return err
+}
+
+// reset - empties log after its records were included into snapshot
+func (w *wal) reset() error {
+	w.size = 0
+
+	return w.rollback()
+}
+
+func (w *wal) close() error {
+	return errors.Join(w.file.Sync(), w.file.Close())
+}
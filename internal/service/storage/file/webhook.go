@@ -0,0 +1,82 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+func (s *Storage) SetWebhook(_ context.Context, addr domain.Address, webhook domain.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.write(record{Op: opSetWebhook, Addr: addr, Webhook: &webhook})
+
+	return err
+}
+
+func (s *Storage) GetWebhook(ctx context.Context, addr domain.Address) (domain.Webhook, error) {
+	return s.txs.GetWebhook(ctx, addr)
+}
+
+func (s *Storage) DelWebhook(ctx context.Context, addr domain.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.txs.GetWebhook(ctx, addr); errors.Is(err, domain.ErrWebhookNotFound) {
+		return nil
+	}
+
+	_, err := s.write(record{Op: opDelWebhook, Addr: addr})
+
+	return err
+}
+
+func (s *Storage) AddDelivery(ctx context.Context, delivery domain.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.txs.GetDelivery(ctx, delivery.ID); err == nil {
+		return nil
+	}
+
+	_, err := s.write(record{Op: opAddDelivery, Delivery: &delivery})
+
+	return err
+}
+
+func (s *Storage) UpdateDelivery(ctx context.Context, delivery domain.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.txs.GetDelivery(ctx, delivery.ID); err != nil {
+		return err
+	}
+
+	_, err := s.write(record{Op: opUpdateDelivery, Delivery: &delivery})
+
+	return err
+}
+
+func (s *Storage) DelDelivery(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.txs.GetDelivery(ctx, id); errors.Is(err, domain.ErrDeliveryNotFound) {
+		return nil
+	}
+
+	_, err := s.write(record{Op: opDelDelivery, ID: id})
+
+	return err
+}
+
+func (s *Storage) GetDelivery(ctx context.Context, id string) (domain.Delivery, error) {
+	return s.txs.GetDelivery(ctx, id)
+}
+
+func (s *Storage) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.Delivery, error) {
+	return s.txs.DueDeliveries(ctx, now, limit)
+}
+
+func (s *Storage) DeadDeliveries(ctx context.Context, query domain.DeliveryQuery) ([]domain.Delivery, error) {
+	return s.txs.DeadDeliveries(ctx, query)
+}
@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"maps"
 	"sync"
 	"sync/atomic"
 )
@@ -10,11 +11,13 @@ type BlockNumberStorage struct {
 
 	mu                    sync.RWMutex
 	processedTransactions map[int]int
+	hashes                map[int]string
 }
 
 func NewBlockNumberStorage() *BlockNumberStorage {
 	return &BlockNumberStorage{
 		processedTransactions: make(map[int]int),
+		hashes:                make(map[int]string),
 	}
 }
 
@@ -45,3 +48,59 @@ func (bs *BlockNumberStorage) SetLastProcessedTxIndex(block int, idx int) {
 	bs.processedTransactions[block] = idx
 	bs.mu.Unlock()
 }
+
+func (bs *BlockNumberStorage) GetBlockHash(block int) (string, bool) {
+	bs.mu.RLock()
+	hash, ok := bs.hashes[block]
+	bs.mu.RUnlock()
+
+	return hash, ok
+}
+
+func (bs *BlockNumberStorage) SetBlockHash(block int, hash string) {
+	bs.mu.Lock()
+	bs.hashes[block] = hash
+	bs.mu.Unlock()
+}
+
+func (bs *BlockNumberStorage) DelBlockHash(block int) {
+	bs.mu.Lock()
+	delete(bs.hashes, block)
+	bs.mu.Unlock()
+}
+
+// BlocksState - copy of block storage data used by durable storages for snapshots
+type BlocksState struct {
+	CurrentBlock          int            `json:"currentBlock"`
+	ProcessedTransactions map[int]int    `json:"processedTransactions"`
+	Hashes                map[int]string `json:"hashes"`
+}
+
+// State - returns copy of block storage data
+func (bs *BlockNumberStorage) State() BlocksState {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	return BlocksState{
+		CurrentBlock:          bs.GetCurrentBlock(),
+		ProcessedTransactions: maps.Clone(bs.processedTransactions),
+		Hashes:                maps.Clone(bs.hashes),
+	}
+}
+
+// Restore - replaces block storage data with state
+func (bs *BlockNumberStorage) Restore(state BlocksState) {
+	processed, hashes := maps.Clone(state.ProcessedTransactions), maps.Clone(state.Hashes)
+	if processed == nil {
+		processed = make(map[int]int)
+	}
+	if hashes == nil {
+		hashes = make(map[int]string)
+	}
+
+	bs.mu.Lock()
+	bs.SetCurrentBlock(state.CurrentBlock)
+	bs.processedTransactions = processed
+	bs.hashes = hashes
+	bs.mu.Unlock()
+}
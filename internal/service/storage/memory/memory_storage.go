@@ -1,68 +1,544 @@
 package memory
 
 import (
+	"cmp"
 	"context"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
 )
 
 type Storage struct {
-	subsMu sync.RWMutex
-	subs   map[domain.Address]struct{}
+	// subsMu - serializes writers of subs, readers load subs without locking
+	subsMu sync.Mutex
+	subs   atomic.Pointer[subscribers]
 
 	txMu sync.RWMutex
-	txs  map[domain.Address][]domain.Transaction
+	txs  map[domain.Address][]Entry
+	// keys - keys of stored transactions of address, repeated writes of transaction are ignored
+	keys map[domain.Address]map[string]struct{}
+	// byHash, byBlock - secondary indexes of stored transactions
+	byHash  map[string][]ref
+	byBlock map[int][]ref
+	// seq - sequence number of the last stored transaction
+	seq uint64
+	// size - estimated memory used by stored transactions
+	size int64
+	// head - the newest block of stored transactions
+	head int
+	// retentions - retention overrides of addresses
+	retentions map[domain.Address]domain.Retention
+	// matched - count of transactions stored for address since it was subscribed
+	matched map[domain.Address]int
+
+	hooksMu    sync.Mutex
+	webhooks   map[domain.Address]domain.Webhook
+	deliveries map[string]domain.Delivery
+
+	retention    domain.Retention
+	memoryBudget int64
+	onCompact    func(Eviction)
+	now          func() time.Time
+	stats        evictionStats
+}
+
+// ref - reference to stored entry of address
+type ref struct {
+	addr domain.Address
+	seq  uint64
+}
+
+// Entry - stored transaction with its sequence number
+type Entry struct {
+	Seq      uint64             `json:"seq"`
+	Tx       domain.Transaction `json:"tx"`
+	StoredAt time.Time          `json:"storedAt"`
+}
+
+type Option func(*Storage)
+
+// WithRetention - global retention of address transactions enforced by compaction
+func WithRetention(retention domain.Retention) Option {
+	return func(s *Storage) {
+		s.retention = retention
+	}
 }
 
-func NewStorage() *Storage {
-	return &Storage{
-		subs: make(map[domain.Address]struct{}),
-		txs:  make(map[domain.Address][]domain.Transaction),
+// WithMemoryBudget - max estimated bytes of stored transactions, the oldest transactions
+// of all addresses are evicted by compaction when budget is exceeded, unlimited if 0
+func WithMemoryBudget(bytes int64) Option {
+	return func(s *Storage) {
+		s.memoryBudget = max(bytes, 0)
 	}
 }
 
-func (s *Storage) AddSubscriber(_ context.Context, addr domain.Address) error {
+// WithCompactHandler - called after compaction evicted transactions
+func WithCompactHandler(handler func(Eviction)) Option {
+	return func(s *Storage) {
+		s.onCompact = handler
+	}
+}
+
+func NewStorage(options ...Option) *Storage {
+	s := &Storage{
+		txs:        make(map[domain.Address][]Entry),
+		keys:       make(map[domain.Address]map[string]struct{}),
+		byHash:     make(map[string][]ref),
+		byBlock:    make(map[int][]ref),
+		retentions: make(map[domain.Address]domain.Retention),
+		matched:    make(map[domain.Address]int),
+		webhooks:   make(map[domain.Address]domain.Webhook),
+		deliveries: make(map[string]domain.Delivery),
+		now:        time.Now,
+	}
+	s.subs.Store(newSubscribers(nil))
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *Storage) AddSubscriber(ctx context.Context, addr domain.Address) error {
+	return s.AddSubscriberAt(ctx, addr, s.now())
+}
+
+// AddSubscriberAt - subscribes address at time of subscription, used by durable storages to replay subscriptions
+func (s *Storage) AddSubscriberAt(_ context.Context, addr domain.Address, at time.Time) error {
 	s.subsMu.Lock()
 	defer s.subsMu.Unlock()
-	if _, ok := s.subs[addr]; ok {
+	subs := s.subs.Load()
+	if _, ok := subs.get(addr); ok {
 		return domain.ErrAddressAlreadySubscribed
 	}
-	s.subs[addr] = struct{}{}
+	s.subs.Store(subs.with(addr, at))
+
+	s.txMu.Lock()
+	delete(s.matched, addr)
+	s.txMu.Unlock()
 
 	return nil
 }
 
+// Unsubscribe - removes subscriber with its retention override, stored transactions of address
+// are removed if purge is set and their count is returned
+func (s *Storage) Unsubscribe(_ context.Context, addr domain.Address, purge bool) (int, error) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	subs := s.subs.Load()
+	if _, ok := subs.get(addr); !ok {
+		return 0, domain.ErrAddressNotSubscribed
+	}
+	s.subs.Store(subs.without(addr))
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	delete(s.matched, addr)
+	delete(s.retentions, addr)
+	if !purge {
+		return 0, nil
+	}
+	removed := s.txs[addr]
+	s.forget(addr, removed)
+	delete(s.txs, addr)
+
+	return len(removed), nil
+}
+
+func (s *Storage) GetSubscription(_ context.Context, addr domain.Address) (domain.Subscription, error) {
+	createdAt, ok := s.subs.Load().get(addr)
+	if !ok {
+		return domain.Subscription{}, domain.ErrAddressNotSubscribed
+	}
+
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	return s.subscription(addr, createdAt), nil
+}
+
+// ListSubscriptions - subscriptions of query page ordered by address
+func (s *Storage) ListSubscriptions(_ context.Context, query domain.SubscriptionQuery) (domain.SubscriptionPage, error) {
+	subs := s.subs.Load()
+	addrs := make([]domain.Address, 0, subs.len())
+	for addr := range subs.all() {
+		addrs = append(addrs, addr)
+	}
+	slices.Sort(addrs)
+	addrs, next := query.Page(addrs)
+
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	page := domain.SubscriptionPage{
+		Subscriptions: make([]domain.Subscription, len(addrs)),
+		Next:          next,
+	}
+	for i, addr := range addrs {
+		createdAt, _ := subs.get(addr)
+		page.Subscriptions[i] = s.subscription(addr, createdAt)
+	}
+
+	return page, nil
+}
+
+// subscription - subscription of address with its counters, caller must hold txMu
+func (s *Storage) subscription(addr domain.Address, createdAt time.Time) domain.Subscription {
+	return domain.Subscription{
+		Address:   addr,
+		CreatedAt: createdAt,
+		Matched:   s.matched[addr],
+		Stored:    len(s.txs[addr]),
+	}
+}
+
 func (s *Storage) ExistsSubscriber(_ context.Context, addr domain.Address) (bool, error) {
-	s.subsMu.RLock()
-	_, ok := s.subs[addr]
-	s.subsMu.RUnlock()
+	_, ok := s.subs.Load().get(addr)
 
 	return ok, nil
 }
 
-func (s *Storage) AddTx(_ context.Context, addr domain.Address, tx domain.Transaction) error {
+// Subscribers - all subscribed addresses in no particular order
+func (s *Storage) Subscribers(_ context.Context) ([]domain.Address, error) {
+	subs := s.subs.Load()
+	addrs := make([]domain.Address, 0, subs.len())
+	for addr := range subs.all() {
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
+
+// ExistsSubscribers - reports for every address whether it is subscribed, addresses are checked
+// against the same snapshot of subscribers
+func (s *Storage) ExistsSubscribers(_ context.Context, addrs []domain.Address) ([]bool, error) {
+	var (
+		subs   = s.subs.Load()
+		exists = make([]bool, len(addrs))
+	)
+	for i, addr := range addrs {
+		_, exists[i] = subs.get(addr)
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) AddTx(_ context.Context, addr domain.Address, tx domain.Transaction) (bool, error) {
 	s.txMu.Lock()
 	defer s.txMu.Unlock()
 
-	s.txs[addr] = append(s.txs[addr], tx)
+	return s.add(addr, tx), nil
+}
 
-	return nil
+// HasTx - reports whether transaction with key is stored for address
+func (s *Storage) HasTx(addr domain.Address, key string) bool {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	_, ok := s.keys[addr][key]
+
+	return ok
 }
 
-func (s *Storage) GetTransactions(_ context.Context, addr domain.Address) ([]domain.Transaction, error) {
-	s.txMu.Lock()
-	txs, ok := s.txs[addr]
+// add - stores transaction if it is not stored yet and reports whether it is added, caller must hold txMu
+func (s *Storage) add(addr domain.Address, tx domain.Transaction) bool {
+	keys, ok := s.keys[addr]
 	if !ok {
-		s.txMu.Unlock()
+		keys = make(map[string]struct{})
+		s.keys[addr] = keys
+	}
+	key := tx.Key()
+	if _, ok = keys[key]; ok {
+		return false
+	}
+	keys[key] = struct{}{}
+	s.matched[addr]++
+	s.seq++
+	s.insert(addr, Entry{Seq: s.seq, Tx: tx, StoredAt: s.now()})
+
+	return true
+}
+
+// insert - appends entry and indexes it, caller must hold txMu
+func (s *Storage) insert(addr domain.Address, entry Entry) {
+	s.txs[addr] = append(s.txs[addr], entry)
+	s.size += txSize(entry.Tx)
 
-		return nil, domain.ErrNoTransactions
+	r := ref{addr: addr, seq: entry.Seq}
+	s.byHash[entry.Tx.Hash] = append(s.byHash[entry.Tx.Hash], r)
+	if number, err := converter.ParseHexInt(entry.Tx.BlockNumber); err == nil {
+		s.byBlock[number] = append(s.byBlock[number], r)
+		s.head = max(s.head, number)
 	}
-	delete(s.txs, addr)
-	s.txMu.Unlock()
+}
+
+// unindex - removes reference from index, caller must hold txMu
+func unindex[K comparable](index map[K][]ref, key K, r ref) {
+	refs := slices.DeleteFunc(index[key], func(indexed ref) bool {
+		return indexed == r
+	})
+	if len(refs) == 0 {
+		delete(index, key)
 
-	transactions := make([]domain.Transaction, len(txs))
-	copy(transactions, txs)
+		return
+	}
+	index[key] = refs
+}
+
+// lookup - entry referenced by index, caller must hold txMu
+func (s *Storage) lookup(r ref) (Entry, bool) {
+	entries := s.txs[r.addr]
+	idx, ok := slices.BinarySearchFunc(entries, r.seq, func(entry Entry, seq uint64) int {
+		return cmp.Compare(entry.Seq, seq)
+	})
+	if !ok {
+		return Entry{}, false
+	}
+
+	return entries[idx], true
+}
+
+// forget - forgets keys and size of removed transactions, caller must hold txMu
+func (s *Storage) forget(addr domain.Address, removed []Entry) {
+	keys := s.keys[addr]
+	for _, entry := range removed {
+		delete(keys, entry.Tx.Key())
+		s.size -= txSize(entry.Tx)
+
+		r := ref{addr: addr, seq: entry.Seq}
+		unindex(s.byHash, entry.Tx.Hash, r)
+		if number, err := converter.ParseHexInt(entry.Tx.BlockNumber); err == nil {
+			unindex(s.byBlock, number, r)
+		}
+	}
+	if len(keys) == 0 {
+		delete(s.keys, addr)
+	}
+}
+
+func (s *Storage) DelBlockTxs(_ context.Context, blockHash string) (int, error) {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	var removed int
+	for addr, entries := range s.txs {
+		var orphaned []Entry
+		kept := slices.DeleteFunc(entries, func(entry Entry) bool {
+			if entry.Tx.BlockHash != blockHash {
+				return false
+			}
+			orphaned = append(orphaned, entry)
+
+			return true
+		})
+		removed += len(orphaned)
+		s.forget(addr, orphaned)
+		if len(kept) == 0 {
+			delete(s.txs, addr)
+
+			continue
+		}
+		s.txs[addr] = kept
+	}
+
+	return removed, nil
+}
+
+func (s *Storage) GetTransactions(_ context.Context, addr domain.Address, query domain.TxQuery) (domain.TxPage, error) {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	page := domain.TxPage{
+		Next: query.Cursor(),
+	}
+	// entries are ordered by sequence number, cursor bounds are searched for the first entry after them
+	entries := s.txs[addr]
+	start, _ := slices.BinarySearchFunc(entries, query.After, func(entry Entry, after uint64) int {
+		if entry.Seq <= after {
+			return -1
+		}
+
+		return 1
+	})
+	end := len(entries)
+	if query.Before != 0 {
+		end, _ = slices.BinarySearchFunc(entries, query.Before, func(entry Entry, before uint64) int {
+			return cmp.Compare(entry.Seq, before)
+		})
+	}
+	entries = entries[start:max(start, end)]
+	for i := range entries {
+		if query.Limit > 0 && len(page.Transactions) == query.Limit {
+			break
+		}
+		entry := entries[i]
+		if query.Desc() {
+			entry = entries[len(entries)-1-i]
+		}
+		if !query.Matches(addr, entry.Seq, entry.Tx) {
+			continue
+		}
+		page.Transactions = append(page.Transactions, entry.Tx)
+		page.Next = entry.Seq
+	}
+
+	return page, nil
+}
+
+// GetTransactionsByHash - stored records of transaction hash of all addresses in order of storing
+func (s *Storage) GetTransactionsByHash(_ context.Context, hash string) ([]domain.MatchedTx, error) {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	return s.resolve(s.byHash[hash]), nil
+}
+
+// GetTransactionsInRange - stored transactions of all addresses of blocks in range [fromBlock, toBlock]
+// ordered by block and then in order of storing
+func (s *Storage) GetTransactionsInRange(_ context.Context, fromBlock, toBlock int) ([]domain.MatchedTx, error) {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	var matched []domain.MatchedTx
+	for number := fromBlock; number <= toBlock; number++ {
+		matched = append(matched, s.resolve(s.byBlock[number])...)
+	}
+
+	return matched, nil
+}
 
-	return txs, nil
+// resolve - entries of index references sorted by sequence number, caller must hold txMu
+func (s *Storage) resolve(refs []ref) []domain.MatchedTx {
+	refs = slices.Clone(refs)
+	slices.SortFunc(refs, func(a, b ref) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	matched := make([]domain.MatchedTx, 0, len(refs))
+	for _, r := range refs {
+		if entry, ok := s.lookup(r); ok {
+			matched = append(matched, domain.MatchedTx{Address: r.addr, Transaction: entry.Tx})
+		}
+	}
+
+	return matched
+}
+
+// AckTransactions - removes address transactions with sequence number up to upTo and returns count of removed
+func (s *Storage) AckTransactions(_ context.Context, addr domain.Address, upTo uint64) (int, error) {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	entries := s.txs[addr]
+	// upTo+1 would overflow for max cursor, so entries are searched for the first one after upTo
+	acked, _ := slices.BinarySearchFunc(entries, upTo, func(entry Entry, upTo uint64) int {
+		if entry.Seq <= upTo {
+			return -1
+		}
+
+		return 1
+	})
+	s.forget(addr, entries[:acked])
+	if acked == len(entries) {
+		delete(s.txs, addr)
+
+		return acked, nil
+	}
+	s.txs[addr] = slices.Delete(entries, 0, acked)
+
+	return acked, nil
+}
+
+// State - copy of storage data used by durable storages for snapshots
+type State struct {
+	Subscribers []domain.Address `json:"subscribers"`
+	// SubscribedAt, Matched - subscription time and count of matched transactions of subscribers
+	SubscribedAt map[domain.Address]time.Time `json:"subscribedAt,omitempty"`
+	Matched      map[domain.Address]int       `json:"matched,omitempty"`
+	Transactions map[domain.Address][]Entry   `json:"transactions"`
+	Seq          uint64                       `json:"seq"`
+	// Webhooks, Deliveries - webhooks of subscribers and their queued and dead deliveries
+	Webhooks   map[domain.Address]domain.Webhook `json:"webhooks,omitempty"`
+	Deliveries []domain.Delivery                 `json:"deliveries,omitempty"`
+}
+
+// State - returns copy of storage data
+func (s *Storage) State() State {
+	state := State{
+		SubscribedAt: make(map[domain.Address]time.Time),
+		Matched:      make(map[domain.Address]int),
+		Transactions: make(map[domain.Address][]Entry),
+	}
+	for addr, at := range s.subs.Load().all() {
+		state.Subscribers = append(state.Subscribers, addr)
+		state.SubscribedAt[addr] = at
+	}
+
+	s.txMu.RLock()
+	for addr, entries := range s.txs {
+		state.Transactions[addr] = slices.Clone(entries)
+	}
+	for addr, matched := range s.matched {
+		state.Matched[addr] = matched
+	}
+	state.Seq = s.seq
+	s.txMu.RUnlock()
+
+	s.hooksMu.Lock()
+	state.Webhooks = maps.Clone(s.webhooks)
+	for _, delivery := range s.deliveries {
+		state.Deliveries = append(state.Deliveries, delivery)
+	}
+	s.hooksMu.Unlock()
+
+	return state
+}
+
+// Restore - replaces storage data with state
+func (s *Storage) Restore(state State) {
+	subs := make(map[domain.Address]time.Time, len(state.Subscribers))
+	for _, addr := range state.Subscribers {
+		subs[addr] = state.SubscribedAt[addr]
+	}
+
+	s.subsMu.Lock()
+	s.subs.Store(newSubscribers(subs))
+	s.subsMu.Unlock()
+
+	s.hooksMu.Lock()
+	s.webhooks = maps.Clone(state.Webhooks)
+	if s.webhooks == nil {
+		s.webhooks = make(map[domain.Address]domain.Webhook)
+	}
+	s.deliveries = make(map[string]domain.Delivery, len(state.Deliveries))
+	for _, delivery := range state.Deliveries {
+		s.deliveries[delivery.ID] = delivery
+	}
+	s.hooksMu.Unlock()
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.txs = make(map[domain.Address][]Entry, len(state.Transactions))
+	s.keys = make(map[domain.Address]map[string]struct{}, len(state.Transactions))
+	s.byHash = make(map[string][]ref)
+	s.byBlock = make(map[int][]ref)
+	s.matched = maps.Clone(state.Matched)
+	if s.matched == nil {
+		s.matched = make(map[domain.Address]int)
+	}
+	s.seq, s.size, s.head = state.Seq, 0, 0
+	for addr, entries := range state.Transactions {
+		keys := make(map[string]struct{}, len(entries))
+		for _, entry := range entries {
+			keys[entry.Tx.Key()] = struct{}{}
+			s.insert(addr, entry)
+		}
+		s.keys[addr] = keys
+	}
 }
@@ -4,10 +4,15 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"maps"
 	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/storagetest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -18,6 +23,12 @@ func genAddress() string {
 	return hex.EncodeToString(addr[:])
 }
 
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		return NewStorage()
+	})
+}
+
 func TestExistsSubscriber(t *testing.T) {
 	storage := NewStorage()
 
@@ -36,25 +47,184 @@ func TestExistsSubscriber(t *testing.T) {
 	require.True(t, ex)
 }
 
+func TestSubscribers(t *testing.T) {
+	var (
+		subs     = newSubscribers(nil)
+		expected = make(map[domain.Address]time.Time)
+		addrs    = make([]domain.Address, 300)
+		at       = time.Unix(1700000000, 0)
+	)
+	for i := range addrs {
+		addrs[i] = domain.Address(genAddress())
+	}
+	requireEqual := func(t *testing.T, expected map[domain.Address]time.Time, subs *subscribers) {
+		all := make(map[domain.Address]time.Time)
+		for addr, at := range subs.all() {
+			all[addr] = at
+		}
+		require.Equal(t, expected, all)
+		require.Equal(t, len(expected), subs.len())
+		for _, addr := range addrs {
+			at, ok := subs.get(addr)
+			_, subscribed := expected[addr]
+			require.Equal(t, subscribed, ok)
+			require.Equal(t, expected[addr], at)
+		}
+	}
+	// each set derived from previous one leaves it unchanged
+	for i := range 2000 {
+		var (
+			prev     = subs
+			prevSubs = maps.Clone(expected)
+			addr     = addrs[i*7%len(addrs)]
+		)
+		if _, ok := expected[addr]; ok && i%3 != 0 {
+			subs = subs.without(addr)
+			delete(expected, addr)
+		} else {
+			subs = subs.with(addr, at.Add(time.Duration(i)))
+			expected[addr] = at.Add(time.Duration(i))
+		}
+		requireEqual(t, expected, subs)
+		if i%100 == 0 {
+			requireEqual(t, prevSubs, prev)
+		}
+	}
+	for addr := range expected {
+		subs = subs.without(addr)
+	}
+	requireEqual(t, map[domain.Address]time.Time{}, subs)
+	require.Empty(t, subs.root.children)
+
+	t.Run("hash collision", func(t *testing.T) {
+		var (
+			a, b = subscriber{addr: addrs[0], at: at}, subscriber{addr: addrs[1], at: at}
+			root = &trieNode{}
+		)
+		// addresses of the same hash share leaf
+		for _, change := range []struct {
+			sub   subscriber
+			added bool
+		}{{sub: a, added: true}, {sub: b, added: true}, {sub: a, added: false}} {
+			var added bool
+			root, added = root.with(0, 42, change.sub)
+			require.Equal(t, change.added, added)
+		}
+		require.Len(t, root.children, 1)
+		require.Len(t, root.children[0].leaf.subs, 2)
+
+		root, removed := root.without(0, 42, a.addr)
+		require.True(t, removed)
+		require.Equal(t, []subscriber{b}, root.children[0].leaf.subs)
+	})
+}
+
 func TestGetTransactions(t *testing.T) {
 	storage := NewStorage()
 
 	ctx := context.Background()
 
 	addr := domain.Address(genAddress())
-	err := storage.AddTx(ctx, addr, domain.Transaction{
+	added, err := storage.AddTx(ctx, addr, domain.Transaction{
 		From: addr,
 	})
 	require.NoError(t, err)
+	require.True(t, added)
 
-	txs, err := storage.GetTransactions(ctx, addr)
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
 	require.NoError(t, err)
 
-	require.Len(t, txs, 1)
-	require.True(t, slices.ContainsFunc(txs, func(transaction domain.Transaction) bool {
+	require.Len(t, page.Transactions, 1)
+	require.True(t, slices.ContainsFunc(page.Transactions, func(transaction domain.Transaction) bool {
 		return transaction.From == addr
 	}))
 
-	txs, err = storage.GetTransactions(ctx, addr)
-	require.Error(t, domain.ErrNoTransactions)
+	// transactions are retained after read
+	retained, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Equal(t, page, retained)
+}
+
+// lockedSubscribers - subscribers set guarded by read write mutex as matched before snapshots
+type lockedSubscribers struct {
+	mu   sync.RWMutex
+	subs map[domain.Address]struct{}
+}
+
+func (l *lockedSubscribers) ExistsSubscriber(_ context.Context, addr domain.Address) (bool, error) {
+	l.mu.RLock()
+	_, ok := l.subs[addr]
+	l.mu.RUnlock()
+
+	return ok, nil
+}
+
+// BenchmarkExistsSubscriber - parallel matching of block addresses against large subscribers set
+func BenchmarkExistsSubscriber(b *testing.B) {
+	const (
+		subscribers = 200_000
+		blockAddrs  = 400
+	)
+	var (
+		ctx     = context.Background()
+		storage = NewStorage()
+		locked  = &lockedSubscribers{subs: make(map[domain.Address]struct{}, subscribers)}
+		addrs   = make([]domain.Address, 0, blockAddrs)
+	)
+	for i := range subscribers {
+		addr := domain.Address(genAddress())
+		require.NoError(b, storage.AddSubscriber(ctx, addr))
+		locked.subs[addr] = struct{}{}
+		if i%(subscribers/blockAddrs*2) == 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+	for len(addrs) < blockAddrs {
+		addrs = append(addrs, domain.Address(genAddress()))
+	}
+
+	b.Run("RWMutex", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for _, addr := range addrs {
+					_, _ = locked.ExistsSubscriber(ctx, addr)
+				}
+			}
+		})
+	})
+	b.Run("Snapshot", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for _, addr := range addrs {
+					_, _ = storage.ExistsSubscriber(ctx, addr)
+				}
+			}
+		})
+	})
+	b.Run("Batch", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, _ = storage.ExistsSubscribers(ctx, addrs)
+			}
+		})
+	})
+}
+
+// BenchmarkAddSubscriber - subscriptions to large subscribers set interleaved with matching
+func BenchmarkAddSubscriber(b *testing.B) {
+	const subscribers = 200_000
+	var (
+		ctx     = context.Background()
+		storage = NewStorage()
+		addr    = domain.Address(genAddress())
+	)
+	for range subscribers {
+		require.NoError(b, storage.AddSubscriber(ctx, domain.Address(genAddress())))
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		require.NoError(b, storage.AddSubscriber(ctx, domain.Address(genAddress())))
+		_, _ = storage.ExistsSubscriber(ctx, addr)
+	}
 }
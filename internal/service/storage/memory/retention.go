@@ -0,0 +1,244 @@
+package memory
+
+import (
+	"container/heap"
+	"context"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
+)
+
+// Eviction - counts of transactions evicted by single compaction per reason
+type Eviction struct {
+	ByCount  int
+	ByBlocks int
+	ByAge    int
+	ByMemory int
+}
+
+func (e Eviction) Total() int {
+	return e.ByCount + e.ByBlocks + e.ByAge + e.ByMemory
+}
+
+// RetentionStats - counters of evicted transactions since storage creation and current usage
+type RetentionStats struct {
+	Evicted      Eviction
+	Transactions int
+	// Size - estimated bytes of stored transactions
+	Size int64
+}
+
+type evictionStats struct {
+	byCount  atomic.Int64
+	byBlocks atomic.Int64
+	byAge    atomic.Int64
+	byMemory atomic.Int64
+}
+
+func (s *Storage) Stats() RetentionStats {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	stats := RetentionStats{
+		Evicted: Eviction{
+			ByCount:  int(s.stats.byCount.Load()),
+			ByBlocks: int(s.stats.byBlocks.Load()),
+			ByAge:    int(s.stats.byAge.Load()),
+			ByMemory: int(s.stats.byMemory.Load()),
+		},
+		Size: s.size,
+	}
+	for _, entries := range s.txs {
+		stats.Transactions += len(entries)
+	}
+
+	return stats
+}
+
+// SetRetention - overrides global retention of address
+func (s *Storage) SetRetention(_ context.Context, addr domain.Address, retention domain.Retention) error {
+	if !retention.Valid() {
+		return domain.ErrInvalidRetention
+	}
+	s.txMu.Lock()
+	s.retentions[addr] = retention
+	s.txMu.Unlock()
+
+	return nil
+}
+
+// Run - compacts storage on interval until ctx is done
+func (s *Storage) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Compact()
+		}
+	}
+}
+
+// Compact - evicts transactions beyond retention of their address and then the oldest transactions
+// of all addresses while memory budget is exceeded
+func (s *Storage) Compact() Eviction {
+	s.txMu.Lock()
+	var (
+		eviction Eviction
+		now      = s.now()
+	)
+	for addr, entries := range s.txs {
+		retention, ok := s.retentions[addr]
+		if !ok {
+			retention = s.retention
+		}
+		evicted := s.evictExpired(entries, retention, now, &eviction)
+		s.evict(addr, evicted)
+	}
+	if s.memoryBudget > 0 && s.size > s.memoryBudget {
+		eviction.ByMemory = s.evictOldest()
+	}
+	s.txMu.Unlock()
+
+	s.stats.byCount.Add(int64(eviction.ByCount))
+	s.stats.byBlocks.Add(int64(eviction.ByBlocks))
+	s.stats.byAge.Add(int64(eviction.ByAge))
+	s.stats.byMemory.Add(int64(eviction.ByMemory))
+	if s.onCompact != nil && eviction.Total() > 0 {
+		s.onCompact(eviction)
+	}
+
+	return eviction
+}
+
+// evictExpired - returns count of the oldest entries beyond retention
+func (s *Storage) evictExpired(entries []Entry, retention domain.Retention, now time.Time, eviction *Eviction) int {
+	var evicted int
+	if retention.MaxTxs > 0 && len(entries) > retention.MaxTxs {
+		evicted = len(entries) - retention.MaxTxs
+		eviction.ByCount += evicted
+	}
+	// entries are stored in order of processing, so expired entries are prefix
+	for _, entry := range entries[evicted:] {
+		if retention.MaxAge > 0 && now.Sub(entry.StoredAt) > retention.MaxAge {
+			eviction.ByAge++
+			evicted++
+
+			continue
+		}
+		number, err := converter.ParseHexInt(entry.Tx.BlockNumber)
+		if retention.MaxBlocks > 0 && err == nil && s.head-number > retention.MaxBlocks {
+			eviction.ByBlocks++
+			evicted++
+
+			continue
+		}
+
+		break
+	}
+
+	return evicted
+}
+
+// evict - removes count of the oldest address entries, caller must hold txMu
+func (s *Storage) evict(addr domain.Address, count int) {
+	if count == 0 {
+		return
+	}
+	entries := s.txs[addr]
+	s.forget(addr, entries[:count])
+	if count == len(entries) {
+		delete(s.txs, addr)
+
+		return
+	}
+	// deleted entries are cleared, so evicted transactions are released
+	s.txs[addr] = slices.Delete(entries, 0, count)
+}
+
+// evictOldest - evicts the oldest entries of all addresses until size fits memory budget, caller must hold txMu
+func (s *Storage) evictOldest() int {
+	var (
+		oldest  = make(oldestEntries, 0, len(s.txs))
+		evicted = make(map[domain.Address]int)
+		count   int
+		freed   int64
+	)
+	for addr, entries := range s.txs {
+		oldest = append(oldest, oldestEntry{addr: addr, seq: entries[0].Seq})
+	}
+	heap.Init(&oldest)
+	for s.size-freed > s.memoryBudget && oldest.Len() > 0 {
+		next := &oldest[0]
+		var (
+			entries = s.txs[next.addr]
+			idx     = evicted[next.addr]
+		)
+		freed += txSize(entries[idx].Tx)
+		evicted[next.addr] = idx + 1
+		count++
+		if idx+1 == len(entries) {
+			heap.Pop(&oldest)
+
+			continue
+		}
+		next.seq = entries[idx+1].Seq
+		heap.Fix(&oldest, 0)
+	}
+	for addr, n := range evicted {
+		s.evict(addr, n)
+	}
+
+	return count
+}
+
+type oldestEntry struct {
+	addr domain.Address
+	seq  uint64
+}
+
+// oldestEntries - min heap of the oldest entries of addresses by sequence number
+type oldestEntries []oldestEntry
+
+func (h oldestEntries) Len() int           { return len(h) }
+func (h oldestEntries) Less(i, j int) bool { return h[i].seq < h[j].seq }
+func (h oldestEntries) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *oldestEntries) Push(x any)        { *h = append(*h, x.(oldestEntry)) }
+func (h *oldestEntries) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return entry
+}
+
+const (
+	// entryOverhead - estimated bytes of entry, transaction struct and map bookkeeping besides strings
+	entryOverhead = 512
+	logOverhead   = 128
+)
+
+// txSize - estimated memory used by stored transaction
+func txSize(tx domain.Transaction) int64 {
+	size := entryOverhead + len(tx.BlockHash) + len(tx.BlockNumber) + len(tx.From) + len(tx.Gas) +
+		len(tx.GasPrice) + 2*len(tx.Hash) + len(tx.Input) + len(tx.Nonce) + len(tx.To) +
+		len(tx.TransactionIndex) + len(tx.Value) + len(tx.V) + len(tx.R) + len(tx.S) +
+		len(tx.Status) + len(tx.GasUsed) + len(tx.EffectiveGasPrice) + len(tx.ContractAddress) +
+		len(tx.TraceAddress)
+	for _, log := range tx.Logs {
+		size += logOverhead + len(log.Address) + len(log.Data) + len(log.LogIndex) + len(log.TransactionHash)
+		for _, topic := range log.Topics {
+			size += len(topic)
+		}
+	}
+	if transfer := tx.TokenTransfer; transfer != nil {
+		size += len(transfer.Token) + len(transfer.From) + len(transfer.To) + len(transfer.Amount) + len(transfer.LogIndex)
+	}
+
+	return int64(size)
+}
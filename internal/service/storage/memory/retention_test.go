@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/storagetest"
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
+	"github.com/stretchr/testify/require"
+)
+
+func addTxs(t *testing.T, storage *Storage, addr domain.Address, fromBlock, count int) {
+	for number := fromBlock; number < fromBlock+count; number++ {
+		storagetest.AddTx(t, storage, addr, domain.Transaction{
+			Hash:        genAddress(),
+			BlockNumber: converter.FormatHexInt(number),
+		})
+	}
+}
+
+func blockNumbers(t *testing.T, storage *Storage, addr domain.Address) []string {
+	page, err := storage.GetTransactions(context.Background(), addr, domain.TxQuery{})
+	require.NoError(t, err)
+	numbers := make([]string, 0, len(page.Transactions))
+	for _, tx := range page.Transactions {
+		numbers = append(numbers, tx.BlockNumber)
+	}
+
+	return numbers
+}
+
+func TestCompactRetention(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		now     = time.Now()
+		addr    = domain.Address(genAddress())
+		wallet  = domain.Address(genAddress())
+		storage = NewStorage(WithRetention(domain.Retention{MaxTxs: 3, MaxBlocks: 5, MaxAge: time.Hour}))
+	)
+	storage.now = func() time.Time { return now.Add(-2 * time.Hour) }
+	addTxs(t, storage, addr, 1, 1)
+	storage.now = func() time.Time { return now }
+	addTxs(t, storage, addr, 2, 9)
+	addTxs(t, storage, wallet, 2, 9)
+	require.NoError(t, storage.SetRetention(ctx, wallet, domain.Retention{MaxTxs: 5}))
+
+	eviction := storage.Compact()
+	// block 1 is evicted by count before its age is checked
+	require.Equal(t, Eviction{ByCount: 7 + 4}, eviction)
+	require.Equal(t, []string{"0x8", "0x9", "0xa"}, blockNumbers(t, storage, addr))
+	require.Equal(t, []string{"0x6", "0x7", "0x8", "0x9", "0xa"}, blockNumbers(t, storage, wallet))
+
+	// head moves forward, so old blocks of address are evicted, override of wallet has no blocks limit
+	addTxs(t, storage, domain.Address(genAddress()), 14, 1)
+	eviction = storage.Compact()
+	require.Equal(t, Eviction{ByBlocks: 1}, eviction)
+	require.Equal(t, []string{"0x9", "0xa"}, blockNumbers(t, storage, addr))
+
+	storage.now = func() time.Time { return now.Add(2 * time.Hour) }
+	eviction = storage.Compact()
+	require.Equal(t, Eviction{ByAge: 3}, eviction)
+
+	stats := storage.Stats()
+	require.Equal(t, Eviction{ByCount: 11, ByBlocks: 1, ByAge: 3}, stats.Evicted)
+	require.Equal(t, 5, stats.Transactions)
+}
+
+func TestCompactMemoryBudget(t *testing.T) {
+	var (
+		addr    = domain.Address(genAddress())
+		other   = domain.Address(genAddress())
+		storage = NewStorage()
+	)
+	addTxs(t, storage, addr, 1, 2)
+	addTxs(t, storage, other, 3, 2)
+	addTxs(t, storage, addr, 5, 2)
+
+	size := storage.Stats().Size
+	storage.memoryBudget = size - size/3
+
+	var evicted []Eviction
+	storage.onCompact = func(eviction Eviction) {
+		evicted = append(evicted, eviction)
+	}
+	// the oldest transactions of all addresses are evicted first
+	require.Equal(t, Eviction{ByMemory: 2}, storage.Compact())
+	require.Equal(t, []string{"0x5", "0x6"}, blockNumbers(t, storage, addr))
+	require.Equal(t, []string{"0x3", "0x4"}, blockNumbers(t, storage, other))
+	require.LessOrEqual(t, storage.Stats().Size, storage.memoryBudget)
+
+	require.Equal(t, Eviction{}, storage.Compact())
+	require.Equal(t, []Eviction{{ByMemory: 2}}, evicted)
+}
+
+func TestSetRetentionInvalid(t *testing.T) {
+	storage := NewStorage()
+
+	err := storage.SetRetention(context.Background(), domain.Address(genAddress()), domain.Retention{MaxTxs: -1})
+	require.ErrorIs(t, err, domain.ErrInvalidRetention)
+}
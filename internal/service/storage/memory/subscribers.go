@@ -0,0 +1,238 @@
+package memory
+
+import (
+	"hash/maphash"
+	"iter"
+	"math/bits"
+	"slices"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+const (
+	// trieBits - bits of address hash consumed by each trie level
+	trieBits = 5
+	trieMask = 1<<trieBits - 1
+)
+
+// subscribers - immutable set of subscribed addresses with time of subscription read by matchers
+// without locking. It is hash trie sharing unchanged nodes with set it is derived from, so write
+// copies only nodes on path to address instead of all subscribers
+type subscribers struct {
+	seed  maphash.Seed
+	root  *trieNode
+	count int
+}
+
+// trieNode - children of node ordered by index of their hash bits set in bitmap
+type trieNode struct {
+	bitmap   uint32
+	children []trieChild
+}
+
+// trieChild - subtree or leaf, one of them is set
+type trieChild struct {
+	node *trieNode
+	leaf *trieLeaf
+}
+
+// trieLeaf - subscribers of addresses with the same hash
+type trieLeaf struct {
+	hash uint64
+	subs []subscriber
+}
+
+type subscriber struct {
+	addr domain.Address
+	at   time.Time
+}
+
+func newSubscribers(subs map[domain.Address]time.Time) *subscribers {
+	s := &subscribers{seed: maphash.MakeSeed(), root: &trieNode{}}
+	for addr, at := range subs {
+		s = s.with(addr, at)
+	}
+
+	return s
+}
+
+func (s *subscribers) hash(addr domain.Address) uint64 {
+	return maphash.String(s.seed, string(addr))
+}
+
+// get - time of subscription of address, false if address is not subscribed
+func (s *subscribers) get(addr domain.Address) (time.Time, bool) {
+	hash := s.hash(addr)
+	for node, shift := s.root, uint(0); ; shift += trieBits {
+		bit := uint32(1) << (hash >> shift & trieMask)
+		if node.bitmap&bit == 0 {
+			return time.Time{}, false
+		}
+		child := node.children[bits.OnesCount32(node.bitmap&(bit-1))]
+		if child.node != nil {
+			node = child.node
+
+			continue
+		}
+		if child.leaf.hash == hash {
+			for _, sub := range child.leaf.subs {
+				if sub.addr == addr {
+					return sub.at, true
+				}
+			}
+		}
+
+		return time.Time{}, false
+	}
+}
+
+func (s *subscribers) len() int {
+	return s.count
+}
+
+// all - subscribed addresses with time of subscription in no particular order
+func (s *subscribers) all() iter.Seq2[domain.Address, time.Time] {
+	return func(yield func(domain.Address, time.Time) bool) {
+		s.root.walk(yield)
+	}
+}
+
+func (n *trieNode) walk(yield func(domain.Address, time.Time) bool) bool {
+	for _, child := range n.children {
+		if child.node != nil {
+			if !child.node.walk(yield) {
+				return false
+			}
+
+			continue
+		}
+		for _, sub := range child.leaf.subs {
+			if !yield(sub.addr, sub.at) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// with - set with address subscribed at time at
+func (s *subscribers) with(addr domain.Address, at time.Time) *subscribers {
+	root, added := s.root.with(0, s.hash(addr), subscriber{addr: addr, at: at})
+	count := s.count
+	if added {
+		count++
+	}
+
+	return &subscribers{seed: s.seed, root: root, count: count}
+}
+
+// without - set without address
+func (s *subscribers) without(addr domain.Address) *subscribers {
+	root, removed := s.root.without(0, s.hash(addr), addr)
+	if !removed {
+		return s
+	}
+
+	return &subscribers{seed: s.seed, root: root, count: s.count - 1}
+}
+
+// with - copy of node with subscriber, reports whether address is added rather than replaced
+func (n *trieNode) with(shift uint, hash uint64, sub subscriber) (*trieNode, bool) {
+	bit := uint32(1) << (hash >> shift & trieMask)
+	idx := bits.OnesCount32(n.bitmap & (bit - 1))
+	if n.bitmap&bit == 0 {
+		leaf := &trieLeaf{hash: hash, subs: []subscriber{sub}}
+
+		return &trieNode{
+			bitmap:   n.bitmap | bit,
+			children: slices.Insert(slices.Clone(n.children), idx, trieChild{leaf: leaf}),
+		}, true
+	}
+	var (
+		child = n.children[idx]
+		added bool
+	)
+	switch {
+	case child.node != nil:
+		child.node, added = child.node.with(shift+trieBits, hash, sub)
+	case child.leaf.hash == hash:
+		child.leaf, added = child.leaf.with(sub)
+	default:
+		// leaves of different hashes with the same bits at this level are moved one level down,
+		// hashes differ in some bits, so they are split at last at the deepest level
+		split := &trieNode{bitmap: 1 << (child.leaf.hash >> (shift + trieBits) & trieMask)}
+		split.children = []trieChild{{leaf: child.leaf}}
+		child = trieChild{}
+		child.node, added = split.with(shift+trieBits, hash, sub)
+	}
+	children := slices.Clone(n.children)
+	children[idx] = child
+
+	return &trieNode{bitmap: n.bitmap, children: children}, added
+}
+
+// without - copy of node without address or nil if node is left empty, reports whether address is removed
+func (n *trieNode) without(shift uint, hash uint64, addr domain.Address) (*trieNode, bool) {
+	bit := uint32(1) << (hash >> shift & trieMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	var (
+		idx     = bits.OnesCount32(n.bitmap & (bit - 1))
+		child   = n.children[idx]
+		removed bool
+	)
+	if child.node != nil {
+		child.node, removed = child.node.without(shift+trieBits, hash, addr)
+	} else if child.leaf.hash == hash {
+		child.leaf, removed = child.leaf.without(addr)
+	}
+	if !removed {
+		return n, false
+	}
+	if child.node == nil && child.leaf == nil {
+		if n.bitmap == bit && shift > 0 {
+			return nil, true
+		}
+
+		return &trieNode{
+			bitmap:   n.bitmap &^ bit,
+			children: slices.Delete(slices.Clone(n.children), idx, idx+1),
+		}, true
+	}
+	children := slices.Clone(n.children)
+	children[idx] = child
+
+	return &trieNode{bitmap: n.bitmap, children: children}, true
+}
+
+// with - copy of leaf with subscriber, reports whether address is added rather than replaced
+func (l *trieLeaf) with(sub subscriber) (*trieLeaf, bool) {
+	subs := slices.Clone(l.subs)
+	for i := range subs {
+		if subs[i].addr == sub.addr {
+			subs[i] = sub
+
+			return &trieLeaf{hash: l.hash, subs: subs}, false
+		}
+	}
+
+	return &trieLeaf{hash: l.hash, subs: append(subs, sub)}, true
+}
+
+// without - copy of leaf without address or nil if leaf is left empty, reports whether address is removed
+func (l *trieLeaf) without(addr domain.Address) (*trieLeaf, bool) {
+	idx := slices.IndexFunc(l.subs, func(sub subscriber) bool {
+		return sub.addr == addr
+	})
+	switch {
+	case idx == -1:
+		return l, false
+	case len(l.subs) == 1:
+		return nil, true
+	}
+
+	return &trieLeaf{hash: l.hash, subs: slices.Delete(slices.Clone(l.subs), idx, idx+1)}, true
+}
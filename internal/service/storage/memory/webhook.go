@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+func (s *Storage) SetWebhook(_ context.Context, addr domain.Address, webhook domain.Webhook) error {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.webhooks[addr] = webhook
+
+	return nil
+}
+
+func (s *Storage) GetWebhook(_ context.Context, addr domain.Address) (domain.Webhook, error) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	webhook, ok := s.webhooks[addr]
+	if !ok {
+		return domain.Webhook{}, domain.ErrWebhookNotFound
+	}
+
+	return webhook, nil
+}
+
+func (s *Storage) DelWebhook(_ context.Context, addr domain.Address) error {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	delete(s.webhooks, addr)
+
+	return nil
+}
+
+func (s *Storage) AddDelivery(_ context.Context, delivery domain.Delivery) error {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	if _, ok := s.deliveries[delivery.ID]; !ok {
+		delivery.Attempts = slices.Clone(delivery.Attempts)
+		s.deliveries[delivery.ID] = delivery
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdateDelivery(_ context.Context, delivery domain.Delivery) error {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	if _, ok := s.deliveries[delivery.ID]; !ok {
+		return domain.ErrDeliveryNotFound
+	}
+	delivery.Attempts = slices.Clone(delivery.Attempts)
+	s.deliveries[delivery.ID] = delivery
+
+	return nil
+}
+
+func (s *Storage) DelDelivery(_ context.Context, id string) error {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	delete(s.deliveries, id)
+
+	return nil
+}
+
+func (s *Storage) GetDelivery(_ context.Context, id string) (domain.Delivery, error) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return domain.Delivery{}, domain.ErrDeliveryNotFound
+	}
+	delivery.Attempts = slices.Clone(delivery.Attempts)
+
+	return delivery, nil
+}
+
+// DueDeliveries - scans all deliveries, queue of memory storage is expected to be short
+func (s *Storage) DueDeliveries(_ context.Context, now time.Time, limit int) ([]domain.Delivery, error) {
+	due := s.filterDeliveries(func(delivery domain.Delivery) bool {
+		return delivery.Status == domain.DeliveryPending && !delivery.NextAttempt.After(now)
+	})
+	slices.SortFunc(due, func(a, b domain.Delivery) int {
+		return cmp.Or(a.NextAttempt.Compare(b.NextAttempt), cmp.Compare(a.ID, b.ID))
+	})
+
+	return page(due, limit), nil
+}
+
+func (s *Storage) DeadDeliveries(_ context.Context, query domain.DeliveryQuery) ([]domain.Delivery, error) {
+	dead := s.filterDeliveries(func(delivery domain.Delivery) bool {
+		return delivery.Status == domain.DeliveryDead && delivery.ID > query.After
+	})
+	slices.SortFunc(dead, func(a, b domain.Delivery) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return page(dead, query.Limit), nil
+}
+
+func (s *Storage) filterDeliveries(keep func(domain.Delivery) bool) []domain.Delivery {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+
+	var result []domain.Delivery
+	for _, delivery := range s.deliveries {
+		if keep(delivery) {
+			delivery.Attempts = slices.Clone(delivery.Attempts)
+			result = append(result, delivery)
+		}
+	}
+
+	return result
+}
+
+// page - first limit deliveries, all if limit is 0
+func page(deliveries []domain.Delivery, limit int) []domain.Delivery {
+	if limit > 0 && len(deliveries) > limit {
+		return deliveries[:limit]
+	}
+
+	return deliveries
+}
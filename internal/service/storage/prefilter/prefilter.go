@@ -0,0 +1,223 @@
+// Package prefilter - storage decorator answering definite misses of subscriber lookups from in-process bloom filter
+package prefilter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/pkg/bloom"
+)
+
+var (
+	ErrRebuildInProgress = errors.New("prefilter rebuild in progress")
+	// ErrSharedBackend - backend shared by replicas gets subscribers which filter of process does not have
+	ErrSharedBackend = errors.New("prefilter does not support backend shared by replicas")
+)
+
+// Storage - decorator of backend storage, subscriber lookups pass to backend only for addresses
+// possibly added to filter, it is meant for remote backends where lookups are network calls.
+// Backend must not be shared with other processes adding subscribers, they are not added to filter
+// until rebuild, so their transactions are skipped. Optional interfaces of backend are used through Unwrap
+type Storage struct {
+	service.Storage
+
+	// mu - serializes filter writers, readers load filter without locking
+	mu     sync.Mutex
+	filter atomic.Pointer[bloom.Filter]
+	// rebuilding, added - subscribers added while filter is rebuilt are added to new filter too
+	rebuilding bool
+	added      []domain.Address
+
+	expected          int
+	falsePositiveRate float64
+
+	subscribers atomic.Int64
+	filtered    atomic.Int64
+	passed      atomic.Int64
+}
+
+var _ service.StorageWrapper = (*Storage)(nil)
+
+type Option func(*Storage)
+
+// WithExpectedSubscribers - count of subscribers filter is sized for, rebuilt filter is sized
+// for twice the count of subscribers when they exceed it
+func WithExpectedSubscribers(expected int) Option {
+	return func(s *Storage) {
+		s.expected = max(expected, 1)
+	}
+}
+
+// WithFalsePositiveRate - target rate of lookups of not subscribed addresses passed to backend
+func WithFalsePositiveRate(rate float64) Option {
+	return func(s *Storage) {
+		s.falsePositiveRate = rate
+	}
+}
+
+const (
+	defaultExpectedSubscribers = 100_000
+	defaultFalsePositiveRate   = 0.01
+)
+
+// New - creates decorator of backend with filter built from backend subscribers
+func New(ctx context.Context, backend service.Storage, options ...Option) (*Storage, error) {
+	s := &Storage{
+		Storage:           backend,
+		expected:          defaultExpectedSubscribers,
+		falsePositiveRate: defaultFalsePositiveRate,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	if err := s.Rebuild(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Rebuild - replaces filter by new one built from backend subscribers, should be called
+// when false positive rate grows beyond target
+func (s *Storage) Rebuild(ctx context.Context) error {
+	s.mu.Lock()
+	if s.rebuilding {
+		s.mu.Unlock()
+
+		return ErrRebuildInProgress
+	}
+	s.rebuilding = true
+	s.mu.Unlock()
+
+	addrs, err := s.Storage.Subscribers(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := s.added
+	s.rebuilding, s.added = false, nil
+	if err != nil {
+		return err
+	}
+	filter := bloom.New(max(s.expected, 2*(len(addrs)+len(added))), s.falsePositiveRate)
+	for _, addr := range addrs {
+		filter.Add(string(addr))
+	}
+	for _, addr := range added {
+		filter.Add(string(addr))
+	}
+	s.filter.Store(filter)
+	s.subscribers.Store(int64(len(addrs) + len(added)))
+
+	return nil
+}
+
+// Run - rebuilds filter on interval until ctx is done when its false positive rate exceeds twice
+// the target rate, onRebuild is called with rebuild result
+func (s *Storage) Run(ctx context.Context, interval time.Duration, onRebuild func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.filter.Load().FalsePositiveRate() <= 2*s.falsePositiveRate {
+				continue
+			}
+			err := s.Rebuild(ctx)
+			if onRebuild != nil {
+				onRebuild(err)
+			}
+		}
+	}
+}
+
+// Unwrap - backend storage
+func (s *Storage) Unwrap() service.Storage {
+	return s.Storage
+}
+
+func (s *Storage) AddSubscriber(ctx context.Context, addr domain.Address) error {
+	err := s.Storage.AddSubscriber(ctx, addr)
+	// subscriber added before filter was built is repaired by being added again
+	if err != nil && !errors.Is(err, domain.ErrAddressAlreadySubscribed) {
+		return err
+	}
+
+	s.mu.Lock()
+	s.filter.Load().Add(string(addr))
+	if s.rebuilding {
+		s.added = append(s.added, addr)
+	}
+	s.mu.Unlock()
+	if err == nil {
+		s.subscribers.Add(1)
+	}
+
+	return err
+}
+
+func (s *Storage) ExistsSubscriber(ctx context.Context, addr domain.Address) (bool, error) {
+	if !s.filter.Load().Test(string(addr)) {
+		s.filtered.Add(1)
+
+		return false, nil
+	}
+	s.passed.Add(1)
+
+	return s.Storage.ExistsSubscriber(ctx, addr)
+}
+
+// ExistsSubscribers - checks in backend only addresses possibly added to filter
+func (s *Storage) ExistsSubscribers(ctx context.Context, addrs []domain.Address) ([]bool, error) {
+	var (
+		filter = s.filter.Load()
+		exists = make([]bool, len(addrs))
+		maybe  = make([]domain.Address, 0, len(addrs))
+		idxs   = make([]int, 0, len(addrs))
+	)
+	for i, addr := range addrs {
+		if filter.Test(string(addr)) {
+			maybe = append(maybe, addr)
+			idxs = append(idxs, i)
+		}
+	}
+	s.filtered.Add(int64(len(addrs) - len(maybe)))
+	s.passed.Add(int64(len(maybe)))
+	if len(maybe) == 0 {
+		return exists, nil
+	}
+	found, err := s.Storage.ExistsSubscribers(ctx, maybe)
+	if err != nil {
+		return nil, err
+	}
+	for i, idx := range idxs {
+		exists[idx] = found[i]
+	}
+
+	return exists, nil
+}
+
+// Stats - lookups answered by filter and passed to backend since creation
+type Stats struct {
+	// Subscribers - approximate count of subscribers added to filter
+	Subscribers int
+	Filtered    int64
+	Passed      int64
+	// FalsePositiveRate - estimated rate of not subscribed addresses passed to backend
+	FalsePositiveRate float64
+}
+
+func (s *Storage) Stats() Stats {
+	return Stats{
+		Subscribers:       int(s.subscribers.Load()),
+		Filtered:          s.filtered.Load(),
+		Passed:            s.passed.Load(),
+		FalsePositiveRate: s.filter.Load().FalsePositiveRate(),
+	}
+}
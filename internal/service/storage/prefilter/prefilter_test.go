@@ -0,0 +1,122 @@
+package prefilter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/memory"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func genAddress() domain.Address {
+	var addr [20]byte
+	_, _ = rand.Read(addr[:])
+
+	return domain.Address("0x" + hex.EncodeToString(addr[:]))
+}
+
+// countingBackend - counts addresses looked up in backend
+type countingBackend struct {
+	*memory.Storage
+	lookups atomic.Int64
+}
+
+func (c *countingBackend) ExistsSubscriber(ctx context.Context, addr domain.Address) (bool, error) {
+	c.lookups.Add(1)
+
+	return c.Storage.ExistsSubscriber(ctx, addr)
+}
+
+func (c *countingBackend) ExistsSubscribers(ctx context.Context, addrs []domain.Address) ([]bool, error) {
+	c.lookups.Add(int64(len(addrs)))
+
+	return c.Storage.ExistsSubscribers(ctx, addrs)
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		storage, err := New(context.Background(), memory.NewStorage())
+		require.NoError(t, err)
+
+		return storage
+	})
+}
+
+func TestUnwrap(t *testing.T) {
+	storage, err := New(context.Background(), memory.NewStorage())
+	require.NoError(t, err)
+
+	_, ok := service.StorageAs[service.RetentionStorage](storage)
+	require.True(t, ok, "retention of backend is used through decorator")
+	_, ok = service.StorageAs[service.WebhookStorage](storage)
+	require.True(t, ok, "webhooks of backend are used through decorator")
+}
+
+func TestPrefilter(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		backend = &countingBackend{Storage: memory.NewStorage()}
+		stored  = genAddress()
+	)
+	// subscriber stored before decorator creation is added to filter by rebuild
+	require.NoError(t, backend.AddSubscriber(ctx, stored))
+	storage, err := New(ctx, backend, WithExpectedSubscribers(1000), WithFalsePositiveRate(0.001))
+	require.NoError(t, err)
+
+	addr := genAddress()
+	require.NoError(t, storage.AddSubscriber(ctx, addr))
+
+	addrs := []domain.Address{stored, addr}
+	for range 100 {
+		addrs = append(addrs, genAddress())
+	}
+	exists, err := storage.ExistsSubscribers(ctx, addrs)
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, true}, exists[:2])
+	for _, subscribed := range exists[2:] {
+		require.False(t, subscribed)
+	}
+	// definite misses are answered without backend
+	require.Less(t, backend.lookups.Load(), int64(10))
+
+	exists1, err := storage.ExistsSubscriber(ctx, stored)
+	require.NoError(t, err)
+	require.True(t, exists1)
+
+	stats := storage.Stats()
+	require.Equal(t, 2, stats.Subscribers)
+	require.Equal(t, int64(len(addrs)+1), stats.Filtered+stats.Passed)
+	require.Equal(t, backend.lookups.Load(), stats.Passed)
+	require.Less(t, stats.FalsePositiveRate, 0.001)
+}
+
+func TestRebuild(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		backend = memory.NewStorage()
+	)
+	storage, err := New(ctx, backend, WithExpectedSubscribers(10))
+	require.NoError(t, err)
+
+	addrs := make([]domain.Address, 0, 100)
+	for range 100 {
+		addr := genAddress()
+		require.NoError(t, storage.AddSubscriber(ctx, addr))
+		addrs = append(addrs, addr)
+	}
+	overfilled := storage.Stats().FalsePositiveRate
+	require.Greater(t, overfilled, 0.5)
+
+	require.NoError(t, storage.Rebuild(ctx))
+	require.Less(t, storage.Stats().FalsePositiveRate, overfilled)
+
+	exists, err := storage.ExistsSubscribers(ctx, addrs)
+	require.NoError(t, err)
+	require.NotContains(t, exists, false)
+}
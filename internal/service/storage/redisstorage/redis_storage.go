@@ -0,0 +1,617 @@
+package redisstorage
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
+	"github.com/dmitrorezn/tx-parser/pkg/redis"
+)
+
+// Storage - storage of subscribers, matched transactions and processing checkpoint in Redis shared by replicas.
+//
+// Keys under prefix:
+//
+//	subscribers             set of subscribed addresses
+//	subscription:{address}  hash of subscription time in unix milliseconds and count of matched transactions
+//	seq                     sequence number of the last stored transaction
+//	txs:{address}           sorted set of address entries scored by sequence number
+//	keys:{address}          hash of stored transaction keys of address to sequence number
+//	block:{block hash}      set of entry references of block
+//	hash:{tx hash}          set of entry references of transaction hash
+//	blocks                  sorted set of entry references scored by block number
+//	current_block           processed block
+//	processed_txs           hash of block number to last processed transaction index
+//	block_hashes            hash of block number to processed block hash
+type Storage struct {
+	client       *redis.Client
+	prefix       string
+	queryTimeout time.Duration
+
+	mu sync.Mutex
+	// err - first failed command of block storage methods which can not return it
+	err error
+}
+
+const (
+	defaultPrefix       = "tx-parser:"
+	defaultQueryTimeout = 5 * time.Second
+	// pageSize - count of entries read per command while filtering transactions
+	pageSize = 256
+)
+
+type Option func(*Storage)
+
+// WithPrefix - prefix of all keys, so several chains or environments can share one Redis
+func WithPrefix(prefix string) Option {
+	return func(s *Storage) {
+		s.prefix = prefix
+	}
+}
+
+// WithQueryTimeout - timeout of block storage commands which are called without context
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(s *Storage) {
+		s.queryTimeout = timeout
+	}
+}
+
+func New(client *redis.Client, options ...Option) *Storage {
+	s := &Storage{
+		client:       client,
+		prefix:       defaultPrefix,
+		queryTimeout: defaultQueryTimeout,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// Err - first command error of block storage methods since the previous call, cleared by the call
+func (s *Storage) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.err
+	s.err = nil
+
+	return err
+}
+
+func (s *Storage) Close() error {
+	return s.client.Close()
+}
+
+func (s *Storage) key(parts ...string) string {
+	return s.prefix + strings.Join(parts, ":")
+}
+
+// entry - stored transaction with its sequence number, sequence number keeps members of sorted set unique
+type entry struct {
+	Seq uint64             `json:"seq"`
+	Tx  domain.Transaction `json:"tx"`
+}
+
+// ref - reference to entry of address, zero padded sequence number orders references by storing
+func ref(seq uint64, addr domain.Address) string {
+	return fmt.Sprintf("%020d:%s", seq, addr)
+}
+
+func parseRef(r string) (uint64, domain.Address, error) {
+	seq, addr, ok := strings.Cut(r, ":")
+	if !ok {
+		return 0, "", fmt.Errorf("invalid reference %q", r)
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+
+	return n, domain.Address(addr), err
+}
+
+func (s *Storage) AddSubscriber(ctx context.Context, addr domain.Address) error {
+	replies, err := s.client.Tx(ctx,
+		[]any{"SADD", s.key("subscribers"), addr},
+		[]any{"HSETNX", s.key("subscription", string(addr)), "created_at", time.Now().UnixMilli()},
+	)
+	if err != nil {
+		return err
+	}
+	if added, err := redis.Int64(replies[0], nil); err != nil || added == 0 {
+		return cmp.Or(err, domain.ErrAddressAlreadySubscribed)
+	}
+
+	return nil
+}
+
+// Unsubscribe - removes subscriber, stored transactions of address are removed in the same transaction if purge is set
+func (s *Storage) Unsubscribe(ctx context.Context, addr domain.Address, purge bool) (int, error) {
+	exists, err := s.ExistsSubscriber(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, domain.ErrAddressNotSubscribed
+	}
+	cmds := [][]any{
+		{"SREM", s.key("subscribers"), addr},
+		{"DEL", s.key("subscription", string(addr))},
+	}
+	var entries []entry
+	if purge {
+		members, err := redis.Strings(s.client.Do(ctx, "ZRANGEBYSCORE", s.key("txs", string(addr)), "-inf", "+inf"))
+		if err != nil {
+			return 0, err
+		}
+		if entries, err = decodeEntries(members); err != nil {
+			return 0, err
+		}
+		for _, e := range entries {
+			cmds = append(cmds, s.unindex(addr, e)...)
+		}
+	}
+	replies, err := s.client.Tx(ctx, cmds...)
+	if err != nil {
+		return 0, err
+	}
+	// concurrent unsubscribe removed subscriber first
+	if removed, err := redis.Int64(replies[0], nil); err != nil || removed == 0 {
+		return 0, cmp.Or(err, domain.ErrAddressNotSubscribed)
+	}
+
+	return len(entries), nil
+}
+
+func (s *Storage) GetSubscription(ctx context.Context, addr domain.Address) (domain.Subscription, error) {
+	exists, err := s.ExistsSubscriber(ctx, addr)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+	if !exists {
+		return domain.Subscription{}, domain.ErrAddressNotSubscribed
+	}
+	subs, err := s.subscriptions(ctx, []domain.Address{addr})
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+
+	return subs[0], nil
+}
+
+// ListSubscriptions - subscriptions of query page ordered by address
+func (s *Storage) ListSubscriptions(ctx context.Context, query domain.SubscriptionQuery) (domain.SubscriptionPage, error) {
+	addrs, err := s.Subscribers(ctx)
+	if err != nil {
+		return domain.SubscriptionPage{}, err
+	}
+	slices.Sort(addrs)
+	addrs, next := query.Page(addrs)
+	subs, err := s.subscriptions(ctx, addrs)
+	if err != nil {
+		return domain.SubscriptionPage{}, err
+	}
+
+	return domain.SubscriptionPage{
+		Subscriptions: subs,
+		Next:          next,
+	}, nil
+}
+
+// subscriptions - subscriptions of addresses with their counters read in single round trip
+func (s *Storage) subscriptions(ctx context.Context, addrs []domain.Address) ([]domain.Subscription, error) {
+	subs := make([]domain.Subscription, len(addrs))
+	if len(addrs) == 0 {
+		return subs, nil
+	}
+	cmds := make([][]any, 0, 2*len(addrs))
+	for _, addr := range addrs {
+		cmds = append(cmds,
+			[]any{"HMGET", s.key("subscription", string(addr)), "created_at", "matched"},
+			[]any{"ZCARD", s.key("txs", string(addr))},
+		)
+	}
+	replies, err := s.client.Pipeline(ctx, cmds...)
+	if err != nil {
+		return nil, err
+	}
+	for i, addr := range addrs {
+		fields, err := redis.Strings(replyOf(replies[2*i]))
+		if err != nil {
+			return nil, err
+		}
+		stored, err := redis.Int64(replyOf(replies[2*i+1]))
+		if err != nil {
+			return nil, err
+		}
+		// subscription hash is created with subscriber, so it is missing only after concurrent unsubscribe
+		if fields[0] == "" {
+			return nil, fmt.Errorf("%w: %s", domain.ErrAddressNotSubscribed, addr)
+		}
+		createdAt, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		subs[i] = domain.Subscription{
+			Address:   addr,
+			CreatedAt: time.UnixMilli(createdAt),
+			Stored:    int(stored),
+		}
+		// matched counter is missing till the first matched transaction
+		subs[i].Matched, _ = strconv.Atoi(fields[1])
+	}
+
+	return subs, nil
+}
+
+// replyOf - reply of pipelined command with error reply as error
+func replyOf(reply any) (any, error) {
+	if err, ok := reply.(redis.Error); ok {
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+func (s *Storage) ExistsSubscriber(ctx context.Context, addr domain.Address) (bool, error) {
+	exists, err := redis.Int64(s.client.Do(ctx, "SISMEMBER", s.key("subscribers"), addr))
+
+	return exists == 1, err
+}
+
+func (s *Storage) ExistsSubscribers(ctx context.Context, addrs []domain.Address) ([]bool, error) {
+	exists := make([]bool, len(addrs))
+	if len(addrs) == 0 {
+		return exists, nil
+	}
+	args := make([]any, 0, len(addrs)+2)
+	args = append(args, "SMISMEMBER", s.key("subscribers"))
+	for _, addr := range addrs {
+		args = append(args, addr)
+	}
+	reply, err := s.client.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	flags, ok := reply.([]any)
+	if !ok || len(flags) != len(addrs) {
+		return nil, fmt.Errorf("%w: unexpected SMISMEMBER reply", redis.ErrProtocol)
+	}
+	for i, flag := range flags {
+		exists[i] = flag == int64(1)
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) Subscribers(ctx context.Context) ([]domain.Address, error) {
+	members, err := redis.Strings(s.client.Do(ctx, "SMEMBERS", s.key("subscribers")))
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]domain.Address, len(members))
+	for i, member := range members {
+		addrs[i] = domain.Address(member)
+	}
+
+	return addrs, nil
+}
+
+// AddTx - claims key, takes sequence and indexes entry in one optimistic transaction watching the sequence,
+// so entry is never left half written and entries become visible in order of their sequences
+func (s *Storage) AddTx(ctx context.Context, addr domain.Address, tx domain.Transaction) (bool, error) {
+	var (
+		seqKey  = s.key("seq")
+		keysKey = s.key("keys", string(addr))
+	)
+	for {
+		replies, err := s.client.Watch(ctx, []any{seqKey}, func(do func(args ...any) (any, error)) ([][]any, error) {
+			// transaction of key claimed by concurrent write changes watched sequence
+			claimed, err := do("HEXISTS", keysKey, tx.Key())
+			if err != nil || claimed != int64(0) {
+				return nil, err
+			}
+			seq, err := redis.Int64(do("GET", seqKey))
+			if err != nil && !errors.Is(err, redis.ErrNil) {
+				return nil, err
+			}
+			seq++
+			data, err := json.Marshal(entry{Seq: uint64(seq), Tx: tx})
+			if err != nil {
+				return nil, err
+			}
+			r := ref(uint64(seq), addr)
+			cmds := [][]any{
+				{"SET", seqKey, seq},
+				{"HSET", keysKey, tx.Key(), seq},
+				{"ZADD", s.key("txs", string(addr)), seq, data},
+				{"SADD", s.key("block", tx.BlockHash), r},
+				{"SADD", s.key("hash", tx.Hash), r},
+				{"HINCRBY", s.key("subscription", string(addr)), "matched", 1},
+			}
+			if number, err := converter.ParseHexInt(tx.BlockNumber); err == nil {
+				cmds = append(cmds, []any{"ZADD", s.key("blocks"), number, r})
+			}
+
+			return cmds, nil
+		})
+		// sequence was taken by concurrent write, so claim and sequence are read again
+		if errors.Is(err, redis.ErrTxAborted) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		return replies != nil, nil
+	}
+}
+
+// unindex - commands removing entry of address with its key and references
+func (s *Storage) unindex(addr domain.Address, e entry) [][]any {
+	r := ref(e.Seq, addr)
+
+	return [][]any{
+		{"ZREMRANGEBYSCORE", s.key("txs", string(addr)), e.Seq, e.Seq},
+		{"HDEL", s.key("keys", string(addr)), e.Tx.Key()},
+		{"SREM", s.key("block", e.Tx.BlockHash), r},
+		{"SREM", s.key("hash", e.Tx.Hash), r},
+		{"ZREM", s.key("blocks"), r},
+	}
+}
+
+func decodeEntries(members []string) ([]entry, error) {
+	entries := make([]entry, len(members))
+	for i, member := range members {
+		if err := json.Unmarshal([]byte(member), &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// addrEntry - entry with address it is stored for
+type addrEntry struct {
+	addr  domain.Address
+	entry entry
+}
+
+// resolve - entries of references in order of references, missing entries are skipped
+func (s *Storage) resolve(ctx context.Context, refs []string) ([]addrEntry, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	var (
+		cmds  = make([][]any, len(refs))
+		addrs = make([]domain.Address, len(refs))
+	)
+	for i, r := range refs {
+		seq, addr, err := parseRef(r)
+		if err != nil {
+			return nil, err
+		}
+		addrs[i] = addr
+		cmds[i] = []any{"ZRANGEBYSCORE", s.key("txs", string(addr)), seq, seq}
+	}
+	replies, err := s.client.Pipeline(ctx, cmds...)
+	if err != nil {
+		return nil, err
+	}
+	resolved := make([]addrEntry, 0, len(refs))
+	for i, reply := range replies {
+		if replyErr, ok := reply.(redis.Error); ok {
+			return nil, replyErr
+		}
+		members, err := redis.Strings(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := decodeEntries(members)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			resolved = append(resolved, addrEntry{addr: addrs[i], entry: e})
+		}
+	}
+
+	return resolved, nil
+}
+
+func (s *Storage) matched(ctx context.Context, refs []string) ([]domain.MatchedTx, error) {
+	resolved, err := s.resolve(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]domain.MatchedTx, len(resolved))
+	for i, r := range resolved {
+		matched[i] = domain.MatchedTx{Address: r.addr, Transaction: r.entry.Tx}
+	}
+
+	return matched, nil
+}
+
+func (s *Storage) DelBlockTxs(ctx context.Context, blockHash string) (int, error) {
+	refs, err := redis.Strings(s.client.Do(ctx, "SMEMBERS", s.key("block", blockHash)))
+	if err != nil {
+		return 0, err
+	}
+	resolved, err := s.resolve(ctx, refs)
+	if err != nil {
+		return 0, err
+	}
+	var cmds [][]any
+	for _, r := range resolved {
+		cmds = append(cmds, s.unindex(r.addr, r.entry)...)
+	}
+	cmds = append(cmds, []any{"DEL", s.key("block", blockHash)})
+	if _, err = s.client.Tx(ctx, cmds...); err != nil {
+		return 0, err
+	}
+
+	return len(resolved), nil
+}
+
+func (s *Storage) GetTransactions(ctx context.Context, addr domain.Address, query domain.TxQuery) (domain.TxPage, error) {
+	page := domain.TxPage{
+		Next: query.Cursor(),
+	}
+	// exclusive score bounds are moved past read entries
+	lower, upper := "("+strconv.FormatUint(query.After, 10), "+inf"
+	if query.Before != 0 {
+		upper = "(" + strconv.FormatUint(query.Before, 10)
+	}
+	for {
+		args := []any{"ZRANGEBYSCORE", s.key("txs", string(addr)), lower, upper, "LIMIT", 0, pageSize}
+		if query.Desc() {
+			args = []any{"ZREVRANGEBYSCORE", s.key("txs", string(addr)), upper, lower, "LIMIT", 0, pageSize}
+		}
+		members, err := redis.Strings(s.client.Do(ctx, args...))
+		if err != nil {
+			return domain.TxPage{}, err
+		}
+		entries, err := decodeEntries(members)
+		if err != nil {
+			return domain.TxPage{}, err
+		}
+		for _, e := range entries {
+			if query.Limit > 0 && len(page.Transactions) == query.Limit {
+				return page, nil
+			}
+			if query.Desc() {
+				upper = "(" + strconv.FormatUint(e.Seq, 10)
+			} else {
+				lower = "(" + strconv.FormatUint(e.Seq, 10)
+			}
+			if !query.Matches(addr, e.Seq, e.Tx) {
+				continue
+			}
+			page.Transactions = append(page.Transactions, e.Tx)
+			page.Next = e.Seq
+		}
+		if len(entries) < pageSize {
+			return page, nil
+		}
+	}
+}
+
+func (s *Storage) GetTransactionsByHash(ctx context.Context, hash string) ([]domain.MatchedTx, error) {
+	refs, err := redis.Strings(s.client.Do(ctx, "SMEMBERS", s.key("hash", hash)))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(refs)
+
+	return s.matched(ctx, refs)
+}
+
+func (s *Storage) GetTransactionsInRange(ctx context.Context, fromBlock, toBlock int) ([]domain.MatchedTx, error) {
+	// references of the same block are ordered lexicographically, so by sequence number
+	refs, err := redis.Strings(s.client.Do(ctx, "ZRANGEBYSCORE", s.key("blocks"), fromBlock, toBlock))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.matched(ctx, refs)
+}
+
+func (s *Storage) AckTransactions(ctx context.Context, addr domain.Address, upTo uint64) (int, error) {
+	members, err := redis.Strings(s.client.Do(ctx, "ZRANGEBYSCORE", s.key("txs", string(addr)), "-inf", upTo))
+	if err != nil {
+		return 0, err
+	}
+	entries, err := decodeEntries(members)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+	var cmds [][]any
+	for _, e := range entries {
+		cmds = append(cmds, s.unindex(addr, e)...)
+	}
+	if _, err = s.client.Tx(ctx, cmds...); err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+// blocksCommand - runs command of block storage method, failure is kept to be reported by Err
+func (s *Storage) blocksCommand(args ...any) any {
+	ctx, cancel := context.WithTimeout(context.Background(), s.queryTimeout)
+	defer cancel()
+	reply, err := s.client.Do(ctx, args...)
+	if err != nil {
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+	}
+
+	return reply
+}
+
+// blocksInt - integer value of block storage key or hash field, false if it is missing
+func (s *Storage) blocksInt(args ...any) (int, bool) {
+	reply := s.blocksCommand(args...)
+	if reply == nil {
+		return 0, false
+	}
+	value, err := redis.Int64(reply, nil)
+	if err != nil {
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+
+		return 0, false
+	}
+
+	return int(value), true
+}
+
+func (s *Storage) GetCurrentBlock() int {
+	block, _ := s.blocksInt("GET", s.key("current_block"))
+
+	return block
+}
+
+func (s *Storage) SetCurrentBlock(currBlock int) {
+	s.blocksCommand("SET", s.key("current_block"), currBlock)
+}
+
+func (s *Storage) DelLastProcessedTxIndex(blockNumber int) {
+	s.blocksCommand("HDEL", s.key("processed_txs"), blockNumber)
+}
+
+func (s *Storage) GetLastProcessedTxIndex(block int) (int, bool) {
+	return s.blocksInt("HGET", s.key("processed_txs"), block)
+}
+
+func (s *Storage) SetLastProcessedTxIndex(block int, idx int) {
+	s.blocksCommand("HSET", s.key("processed_txs"), block, idx)
+}
+
+func (s *Storage) GetBlockHash(block int) (string, bool) {
+	hash, ok := s.blocksCommand("HGET", s.key("block_hashes"), block).(string)
+
+	return hash, ok
+}
+
+func (s *Storage) SetBlockHash(block int, hash string) {
+	s.blocksCommand("HSET", s.key("block_hashes"), block, hash)
+}
+
+func (s *Storage) DelBlockHash(block int) {
+	s.blocksCommand("HDEL", s.key("block_hashes"), block)
+}
@@ -0,0 +1,154 @@
+package redisstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/storagetest"
+	"github.com/dmitrorezn/tx-parser/pkg/redis"
+	"github.com/dmitrorezn/tx-parser/pkg/redis/redistest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestClient - client of REDIS_TEST_ADDR or of in-process stand-in when it is not set
+func openTestClient(t *testing.T) *redis.Client {
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		server := redistest.NewServer()
+		t.Cleanup(server.Close)
+		addr = server.Addr()
+	}
+	client := redis.New(addr)
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+	})
+
+	return client
+}
+
+// testPrefix - random prefix isolating keys of test on shared Redis
+func testPrefix() string {
+	var prefix [8]byte
+	_, _ = rand.Read(prefix[:])
+
+	return "test:" + hex.EncodeToString(prefix[:]) + ":"
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		return New(openTestClient(t), WithPrefix(testPrefix()))
+	})
+}
+
+func TestPrefix(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		client  = openTestClient(t)
+		mainnet = New(client, WithPrefix(testPrefix()))
+		testnet = New(client, WithPrefix(testPrefix()))
+		addr    = domain.Address("0xaddr")
+	)
+	require.NoError(t, mainnet.AddSubscriber(ctx, addr))
+	require.NoError(t, testnet.AddSubscriber(ctx, addr))
+	storagetest.AddTx(t, mainnet, addr, domain.Transaction{Hash: "0x1", BlockHash: "0xa", BlockNumber: "0x1"})
+	mainnet.SetCurrentBlock(10)
+
+	page, err := testnet.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Empty(t, page.Transactions)
+	require.Zero(t, testnet.GetCurrentBlock())
+
+	// replicas sharing prefix see the same state
+	replica := New(client, WithPrefix(mainnet.prefix))
+	page, err = replica.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+	require.Equal(t, 10, replica.GetCurrentBlock())
+}
+
+func TestBlocksStorage(t *testing.T) {
+	storage := New(openTestClient(t), WithPrefix(testPrefix()))
+
+	require.Equal(t, 0, storage.GetCurrentBlock())
+	storage.SetCurrentBlock(10)
+	storage.SetCurrentBlock(11)
+	require.Equal(t, 11, storage.GetCurrentBlock())
+
+	_, ok := storage.GetLastProcessedTxIndex(11)
+	require.False(t, ok)
+	storage.SetLastProcessedTxIndex(11, 2)
+	storage.SetLastProcessedTxIndex(11, 3)
+	idx, ok := storage.GetLastProcessedTxIndex(11)
+	require.True(t, ok)
+	require.Equal(t, 3, idx)
+	storage.DelLastProcessedTxIndex(11)
+	_, ok = storage.GetLastProcessedTxIndex(11)
+	require.False(t, ok)
+
+	storage.SetBlockHash(11, "0xa")
+	hash, ok := storage.GetBlockHash(11)
+	require.True(t, ok)
+	require.Equal(t, "0xa", hash)
+	storage.DelBlockHash(11)
+	_, ok = storage.GetBlockHash(11)
+	require.False(t, ok)
+
+	require.NoError(t, storage.Err())
+}
+
+func TestConcurrentAddTx(t *testing.T) {
+	const (
+		writers = 8
+		txs     = 25
+	)
+	var (
+		ctx     = context.Background()
+		client  = openTestClient(t)
+		prefix  = testPrefix()
+		addr    = domain.Address("0xaddr")
+		added   atomic.Int32
+		wg      sync.WaitGroup
+		storage = New(client, WithPrefix(prefix))
+	)
+	require.NoError(t, storage.AddSubscriber(ctx, addr))
+	// every transaction is written by two replicas
+	for writer := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			replica := New(client, WithPrefix(prefix))
+			for i := range txs {
+				number := writer/2*txs + i
+				ok, err := replica.AddTx(ctx, addr, domain.Transaction{
+					Hash:        "0x" + strconv.Itoa(number),
+					BlockHash:   "0xb",
+					BlockNumber: "0x1",
+				})
+				assert.NoError(t, err)
+				if ok {
+					added.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, writers/2*txs, added.Load())
+
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, writers/2*txs)
+	sub, err := storage.GetSubscription(ctx, addr)
+	require.NoError(t, err)
+	require.Equal(t, writers/2*txs, sub.Matched)
+	// sequences are taken without gaps only by stored entries
+	require.Equal(t, uint64(writers/2*txs), page.Next)
+}
@@ -0,0 +1,164 @@
+package redisstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/pkg/redis"
+)
+
+func (s *Storage) SetWebhook(ctx context.Context, addr domain.Address, webhook domain.Webhook) error {
+	_, err := s.client.Do(ctx, "HSET", s.key("webhook", string(addr)), "url", webhook.URL, "secret", webhook.Secret)
+
+	return err
+}
+
+func (s *Storage) GetWebhook(ctx context.Context, addr domain.Address) (domain.Webhook, error) {
+	fields, err := redis.Strings(s.client.Do(ctx, "HMGET", s.key("webhook", string(addr)), "url", "secret"))
+	if err != nil {
+		return domain.Webhook{}, err
+	}
+	if fields[0] == "" {
+		return domain.Webhook{}, domain.ErrWebhookNotFound
+	}
+
+	return domain.Webhook{
+		URL:    fields[0],
+		Secret: fields[1],
+	}, nil
+}
+
+func (s *Storage) DelWebhook(ctx context.Context, addr domain.Address) error {
+	_, err := s.client.Do(ctx, "DEL", s.key("webhook", string(addr)))
+
+	return err
+}
+
+// AddDelivery - stores delivery and adds it to pending queue in one transaction if it is not stored yet
+func (s *Storage) AddDelivery(ctx context.Context, delivery domain.Delivery) error {
+	_, err := s.GetDelivery(ctx, delivery.ID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, domain.ErrDeliveryNotFound) {
+		return err
+	}
+
+	return s.putDelivery(ctx, delivery)
+}
+
+func (s *Storage) UpdateDelivery(ctx context.Context, delivery domain.Delivery) error {
+	if _, err := s.GetDelivery(ctx, delivery.ID); err != nil {
+		return err
+	}
+
+	return s.putDelivery(ctx, delivery)
+}
+
+// putDelivery - writes delivery and moves it to the queue of its status
+func (s *Storage) putDelivery(ctx context.Context, delivery domain.Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	cmds := [][]any{
+		{"SET", s.key("delivery", delivery.ID), data},
+		{"ZREM", s.key("deliveries", "pending"), delivery.ID},
+		{"ZREM", s.key("deliveries", "dead"), delivery.ID},
+	}
+	if delivery.Status == domain.DeliveryDead {
+		cmds = append(cmds, []any{"ZADD", s.key("deliveries", "dead"), 0, delivery.ID})
+	} else {
+		cmds = append(cmds, []any{"ZADD", s.key("deliveries", "pending"), delivery.NextAttempt.UnixMilli(), delivery.ID})
+	}
+	_, err = s.client.Tx(ctx, cmds...)
+
+	return err
+}
+
+func (s *Storage) DelDelivery(ctx context.Context, id string) error {
+	_, err := s.client.Tx(ctx,
+		[]any{"DEL", s.key("delivery", id)},
+		[]any{"ZREM", s.key("deliveries", "pending"), id},
+		[]any{"ZREM", s.key("deliveries", "dead"), id},
+	)
+
+	return err
+}
+
+func (s *Storage) GetDelivery(ctx context.Context, id string) (domain.Delivery, error) {
+	deliveries, err := s.deliveries(ctx, []string{id})
+	if err != nil {
+		return domain.Delivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return domain.Delivery{}, domain.ErrDeliveryNotFound
+	}
+
+	return deliveries[0], nil
+}
+
+func (s *Storage) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.Delivery, error) {
+	args := []any{"ZRANGEBYSCORE", s.key("deliveries", "pending"), "-inf", now.UnixMilli()}
+	if limit > 0 {
+		args = append(args, "LIMIT", 0, limit)
+	}
+	ids, err := redis.Strings(s.client.Do(ctx, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.deliveries(ctx, ids)
+}
+
+func (s *Storage) DeadDeliveries(ctx context.Context, query domain.DeliveryQuery) ([]domain.Delivery, error) {
+	lower := "-"
+	if query.After != "" {
+		lower = "(" + query.After
+	}
+	args := []any{"ZRANGEBYLEX", s.key("deliveries", "dead"), lower, "+"}
+	if query.Limit > 0 {
+		args = append(args, "LIMIT", 0, query.Limit)
+	}
+	ids, err := redis.Strings(s.client.Do(ctx, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.deliveries(ctx, ids)
+}
+
+// deliveries - stored deliveries of ids in order of ids, deliveries removed after ids were read are skipped
+func (s *Storage) deliveries(ctx context.Context, ids []string) ([]domain.Delivery, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	cmds := make([][]any, 0, len(ids))
+	for _, id := range ids {
+		cmds = append(cmds, []any{"GET", s.key("delivery", id)})
+	}
+	replies, err := s.client.Pipeline(ctx, cmds...)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]domain.Delivery, 0, len(ids))
+	for _, reply := range replies {
+		data, err := redis.String(replyOf(reply))
+		if errors.Is(err, redis.ErrNil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var delivery domain.Delivery
+		if err = json.Unmarshal([]byte(data), &delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,92 @@
+package sqlstorage
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect - differences of SQL databases used by storage queries
+type Dialect struct {
+	// Serial - definition of auto incremented primary key column, ids of deleted rows must not be
+	// reused as transactions cursors are ids
+	Serial string
+	// Numbered - placeholders are $1, $2, ... instead of ?
+	Numbered bool
+}
+
+var (
+	SQLite = Dialect{
+		// without AUTOINCREMENT sqlite reuses rowids of deleted last rows
+		Serial: "INTEGER PRIMARY KEY AUTOINCREMENT",
+	}
+	Postgres = Dialect{
+		Serial:   "BIGSERIAL PRIMARY KEY",
+		Numbered: true,
+	}
+)
+
+// DialectByDriver - dialect of known driver name, SQLite for unknown drivers
+func DialectByDriver(driver string) Dialect {
+	switch driver {
+	case "postgres", "pgx":
+		return Postgres
+	default:
+		return SQLite
+	}
+}
+
+func (d Dialect) schema(statement string) string {
+	return strings.ReplaceAll(statement, "{{serial}}", d.Serial)
+}
+
+// rebind - replaces ? placeholders with numbered ones if dialect requires
+func (d Dialect) rebind(query string) string {
+	if !d.Numbered {
+		return query
+	}
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+// sqliteBusyTimeout - time connection waits for lock of database held by other writer before SQLITE_BUSY
+const sqliteBusyTimeout = 10 * time.Second
+
+// SQLiteDSN - data source name of sqlite driver with busy timeout, WAL journal and immediate transactions,
+// so concurrent writers of file database wait for each other instead of failing with SQLITE_BUSY.
+// Parameters already set by dsn are kept
+func SQLiteDSN(dsn string) string {
+	var params []string
+	if !strings.Contains(dsn, "busy_timeout") {
+		params = append(params, "_pragma=busy_timeout("+strconv.FormatInt(sqliteBusyTimeout.Milliseconds(), 10)+")")
+	}
+	if !strings.Contains(dsn, "journal_mode") {
+		params = append(params, "_pragma=journal_mode(WAL)")
+	}
+	// deferred transaction which read before write fails on lock upgrade without waiting for busy timeout
+	if !strings.Contains(dsn, "_txlock") {
+		params = append(params, "_txlock=immediate")
+	}
+	if len(params) == 0 {
+		return dsn
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+
+	return dsn + separator + strings.Join(params, "&")
+}
@@ -0,0 +1,96 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migration - schema change applied once in its own transaction, versions must not be changed after release
+type migration struct {
+	version    int
+	statements []string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		statements: []string{
+			// created_at - unix milliseconds of subscription
+			`CREATE TABLE subscribers (
+				address TEXT PRIMARY KEY,
+				created_at BIGINT NOT NULL,
+				matched BIGINT NOT NULL DEFAULT 0
+			)`,
+			`CREATE TABLE transactions (
+				id {{serial}},
+				address TEXT NOT NULL,
+				block_number BIGINT NOT NULL,
+				block_hash TEXT NOT NULL,
+				tx_hash TEXT NOT NULL,
+				tx_key TEXT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX transactions_address_idx ON transactions (address, id)`,
+			`CREATE UNIQUE INDEX transactions_key_idx ON transactions (address, tx_key)`,
+			`CREATE INDEX transactions_block_number_idx ON transactions (block_number)`,
+			`CREATE INDEX transactions_block_hash_idx ON transactions (block_hash)`,
+			`CREATE INDEX transactions_tx_hash_idx ON transactions (tx_hash)`,
+			`CREATE TABLE checkpoint (
+				id INTEGER PRIMARY KEY,
+				current_block BIGINT NOT NULL
+			)`,
+			`CREATE TABLE processed_txs (
+				block_number BIGINT PRIMARY KEY,
+				tx_index INTEGER NOT NULL
+			)`,
+			`CREATE TABLE block_hashes (
+				block_number BIGINT PRIMARY KEY,
+				hash TEXT NOT NULL
+			)`,
+			`CREATE TABLE webhooks (
+				address TEXT PRIMARY KEY,
+				url TEXT NOT NULL,
+				secret TEXT NOT NULL
+			)`,
+			// next_attempt - unix milliseconds pending delivery is due at, data - delivery JSON
+			`CREATE TABLE deliveries (
+				id TEXT PRIMARY KEY,
+				status TEXT NOT NULL,
+				next_attempt BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX deliveries_status_idx ON deliveries (status, next_attempt)`,
+		},
+	},
+}
+
+// migrate - applies migrations newer than stored schema version
+func (s *Storage) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+	var version int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err := s.inTx(ctx, func(tx *sql.Tx) error {
+			for _, statement := range m.statements {
+				if _, err := tx.ExecContext(ctx, s.dialect.schema(statement)); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), m.version)
+
+			return err
+		}); err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,571 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/pkg/converter"
+)
+
+// Storage - storage of subscribers, matched transactions and processing checkpoint in SQL database,
+// transactions are kept as JSON with indexed address, block number and hashes columns
+type Storage struct {
+	db           *sql.DB
+	dialect      Dialect
+	queryTimeout time.Duration
+
+	mu sync.Mutex
+	// err - first failed query of block storage methods which can not return it
+	err error
+}
+
+const (
+	defaultQueryTimeout = 5 * time.Second
+	checkpointID        = 1
+)
+
+type Option func(*Storage)
+
+func WithDialect(dialect Dialect) Option {
+	return func(s *Storage) {
+		s.dialect = dialect
+	}
+}
+
+// WithQueryTimeout - timeout of block storage queries which are called without context
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(s *Storage) {
+		s.queryTimeout = timeout
+	}
+}
+
+// New - creates storage over opened database and applies schema migrations
+func New(ctx context.Context, db *sql.DB, options ...Option) (*Storage, error) {
+	s := &Storage{
+		db:           db,
+		dialect:      SQLite,
+		queryTimeout: defaultQueryTimeout,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	if err := s.migrate(ctx); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	return s, nil
+}
+
+// Err - first query error of block storage methods since the previous call, cleared by the call
+func (s *Storage) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.err
+	s.err = nil
+
+	return err
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+func (s *Storage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *Storage) AddSubscriber(ctx context.Context, addr domain.Address) error {
+	res, err := s.exec(ctx,
+		`INSERT INTO subscribers (address, created_at) VALUES (?, ?) ON CONFLICT (address) DO NOTHING`,
+		addr, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return domain.ErrAddressAlreadySubscribed
+	}
+
+	return nil
+}
+
+// Unsubscribe - removes subscriber, stored transactions of address are removed in the same transaction if purge is set
+func (s *Storage) Unsubscribe(ctx context.Context, addr domain.Address, purge bool) (int, error) {
+	var removed int64
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, s.dialect.rebind(`DELETE FROM subscribers WHERE address = ?`), addr)
+		if err != nil {
+			return err
+		}
+		deleted, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return domain.ErrAddressNotSubscribed
+		}
+		if !purge {
+			return nil
+		}
+		res, err = tx.ExecContext(ctx, s.dialect.rebind(`DELETE FROM transactions WHERE address = ?`), addr)
+		if err != nil {
+			return err
+		}
+		removed, err = res.RowsAffected()
+
+		return err
+	})
+
+	return int(removed), err
+}
+
+const subscriptionQuery = `SELECT address, created_at, matched,
+	(SELECT COUNT(*) FROM transactions WHERE transactions.address = subscribers.address)
+	FROM subscribers`
+
+func (s *Storage) GetSubscription(ctx context.Context, addr domain.Address) (domain.Subscription, error) {
+	subs, err := s.querySubscriptions(ctx, subscriptionQuery+` WHERE address = ?`, addr)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+	if len(subs) == 0 {
+		return domain.Subscription{}, domain.ErrAddressNotSubscribed
+	}
+
+	return subs[0], nil
+}
+
+// ListSubscriptions - subscriptions of query page ordered by address
+func (s *Storage) ListSubscriptions(ctx context.Context, query domain.SubscriptionQuery) (domain.SubscriptionPage, error) {
+	var (
+		statement = subscriptionQuery + ` WHERE address > ? ORDER BY address`
+		args      = []any{query.After}
+	)
+	// one more row tells whether there is the next page
+	if query.Limit > 0 {
+		statement += ` LIMIT ?`
+		args = append(args, query.Limit+1)
+	}
+	subs, err := s.querySubscriptions(ctx, statement, args...)
+	if err != nil {
+		return domain.SubscriptionPage{}, err
+	}
+	page := domain.SubscriptionPage{
+		Subscriptions: subs,
+	}
+	if query.Limit > 0 && len(subs) > query.Limit {
+		page.Subscriptions = subs[:query.Limit]
+		page.Next = subs[query.Limit-1].Address
+	}
+
+	return page, nil
+}
+
+func (s *Storage) querySubscriptions(ctx context.Context, query string, args ...any) ([]domain.Subscription, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []domain.Subscription
+	for rows.Next() {
+		var (
+			sub       domain.Subscription
+			createdAt int64
+		)
+		if err = rows.Scan(&sub.Address, &createdAt, &sub.Matched, &sub.Stored); err != nil {
+			return nil, err
+		}
+		if createdAt != 0 {
+			sub.CreatedAt = time.UnixMilli(createdAt)
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func (s *Storage) ExistsSubscriber(ctx context.Context, addr domain.Address) (bool, error) {
+	var exists int
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`SELECT 1 FROM subscribers WHERE address = ?`), addr).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *Storage) Subscribers(ctx context.Context) ([]domain.Address, error) {
+	subscribed := make(map[domain.Address]struct{})
+	if err := s.collectSubscribed(ctx, `SELECT address FROM subscribers`, nil, subscribed); err != nil {
+		return nil, err
+	}
+	addrs := make([]domain.Address, 0, len(subscribed))
+	for addr := range subscribed {
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
+
+// maxQueryParams - max count of addresses checked by single query, below SQLite default limit of parameters
+const maxQueryParams = 500
+
+func (s *Storage) ExistsSubscribers(ctx context.Context, addrs []domain.Address) ([]bool, error) {
+	subscribed := make(map[domain.Address]struct{})
+	for start := 0; start < len(addrs); start += maxQueryParams {
+		chunk := addrs[start:min(start+maxQueryParams, len(addrs))]
+		args := make([]any, len(chunk))
+		for i, addr := range chunk {
+			args[i] = addr
+		}
+		query := `SELECT address FROM subscribers WHERE address IN (?` + strings.Repeat(`, ?`, len(chunk)-1) + `)`
+		if err := s.collectSubscribed(ctx, query, args, subscribed); err != nil {
+			return nil, err
+		}
+	}
+	exists := make([]bool, len(addrs))
+	for i, addr := range addrs {
+		_, exists[i] = subscribed[addr]
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) collectSubscribed(ctx context.Context, query string, args []any, subscribed map[domain.Address]struct{}) error {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var addr domain.Address
+		if err = rows.Scan(&addr); err != nil {
+			return err
+		}
+		subscribed[addr] = struct{}{}
+	}
+
+	return rows.Err()
+}
+
+func (s *Storage) AddTx(ctx context.Context, addr domain.Address, tx domain.Transaction) (bool, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return false, err
+	}
+	// pending or malformed block number is kept as 0
+	blockNumber, _ := converter.ParseHexInt(tx.BlockNumber)
+
+	var added bool
+	err = s.inTx(ctx, func(sqlTx *sql.Tx) error {
+		res, err := sqlTx.ExecContext(ctx, s.dialect.rebind(
+			`INSERT INTO transactions (address, block_number, block_hash, tx_hash, tx_key, data) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (address, tx_key) DO NOTHING`),
+			addr, blockNumber, tx.BlockHash, tx.Hash, tx.Key(), string(data),
+		)
+		if err != nil {
+			return err
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil || inserted == 0 {
+			return err
+		}
+		_, err = sqlTx.ExecContext(ctx, s.dialect.rebind(`UPDATE subscribers SET matched = matched + 1 WHERE address = ?`), addr)
+		added = err == nil
+
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return added, nil
+}
+
+func (s *Storage) DelBlockTxs(ctx context.Context, blockHash string) (int, error) {
+	res, err := s.exec(ctx, `DELETE FROM transactions WHERE block_hash = ?`, blockHash)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := res.RowsAffected()
+
+	return int(removed), err
+}
+
+// GetTransactions - cursor, block range and order of query are pushed down to database,
+// the rest of filters is applied to rows read in chunks
+func (s *Storage) GetTransactions(ctx context.Context, addr domain.Address, query domain.TxQuery) (domain.TxPage, error) {
+	page := domain.TxPage{
+		Next: query.Cursor(),
+	}
+	cursor := query
+	for {
+		var (
+			statement = `SELECT id, data FROM transactions WHERE address = ? AND id > ? AND block_number >= ?`
+			args      = []any{addr, toID(cursor.After), cursor.FromBlock}
+		)
+		if cursor.Before != 0 {
+			statement += ` AND id < ?`
+			args = append(args, toID(cursor.Before))
+		}
+		if cursor.ToBlock != 0 {
+			statement += ` AND block_number <= ?`
+			args = append(args, cursor.ToBlock)
+		}
+		if cursor.Desc() {
+			statement += ` ORDER BY id DESC`
+		} else {
+			statement += ` ORDER BY id`
+		}
+		statement += ` LIMIT ?`
+		args = append(args, pageSize)
+
+		rows, err := s.queryEntries(ctx, statement, args...)
+		if err != nil {
+			return domain.TxPage{}, err
+		}
+		for _, row := range rows {
+			if query.Limit > 0 && len(page.Transactions) == query.Limit {
+				return page, nil
+			}
+			cursor = cursor.Continue(row.seq)
+			if !query.Matches(addr, row.seq, row.tx) {
+				continue
+			}
+			page.Transactions = append(page.Transactions, row.tx)
+			page.Next = row.seq
+		}
+		if len(rows) < pageSize {
+			return page, nil
+		}
+	}
+}
+
+// pageSize - count of rows read per query while filtering transactions
+const pageSize = 256
+
+type entryRow struct {
+	seq uint64
+	tx  domain.Transaction
+}
+
+func (s *Storage) queryEntries(ctx context.Context, query string, args ...any) ([]entryRow, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []entryRow
+	for rows.Next() {
+		var (
+			entry entryRow
+			data  string
+		)
+		if err = rows.Scan(&entry.seq, &data); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(data), &entry.tx); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *Storage) GetTransactionsByHash(ctx context.Context, hash string) ([]domain.MatchedTx, error) {
+	return s.queryMatched(ctx, `SELECT address, data FROM transactions WHERE tx_hash = ? ORDER BY id`, hash)
+}
+
+func (s *Storage) GetTransactionsInRange(ctx context.Context, fromBlock, toBlock int) ([]domain.MatchedTx, error) {
+	return s.queryMatched(ctx,
+		`SELECT address, data FROM transactions WHERE block_number BETWEEN ? AND ? ORDER BY block_number, id`,
+		fromBlock, toBlock,
+	)
+}
+
+func (s *Storage) queryMatched(ctx context.Context, query string, args ...any) ([]domain.MatchedTx, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matched []domain.MatchedTx
+	for rows.Next() {
+		var (
+			data string
+			tx   domain.MatchedTx
+		)
+		if err = rows.Scan(&tx.Address, &data); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(data), &tx.Transaction); err != nil {
+			return nil, err
+		}
+		matched = append(matched, tx)
+	}
+
+	return matched, rows.Err()
+}
+
+func (s *Storage) AckTransactions(ctx context.Context, addr domain.Address, upTo uint64) (int, error) {
+	res, err := s.exec(ctx, `DELETE FROM transactions WHERE address = ? AND id <= ?`, addr, toID(upTo))
+	if err != nil {
+		return 0, err
+	}
+	removed, err := res.RowsAffected()
+
+	return int(removed), err
+}
+
+// toID - sequence number as signed id column value, drivers do not support uint64 with high bit set
+func toID(seq uint64) int64 {
+	return int64(min(seq, math.MaxInt64))
+}
+
+// blocksQuery - runs query of block storage method, failure is kept to be reported by Err
+func (s *Storage) blocksQuery(fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.queryTimeout)
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Storage) GetCurrentBlock() int {
+	var block int
+	s.blocksQuery(func(ctx context.Context) error {
+		err := s.db.QueryRowContext(ctx, s.dialect.rebind(`SELECT current_block FROM checkpoint WHERE id = ?`), checkpointID).Scan(&block)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		return err
+	})
+
+	return block
+}
+
+func (s *Storage) SetCurrentBlock(currBlock int) {
+	s.blocksQuery(func(ctx context.Context) error {
+		_, err := s.exec(ctx,
+			`INSERT INTO checkpoint (id, current_block) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET current_block = excluded.current_block`,
+			checkpointID, currBlock,
+		)
+
+		return err
+	})
+}
+
+func (s *Storage) DelLastProcessedTxIndex(blockNumber int) {
+	s.blocksQuery(func(ctx context.Context) error {
+		_, err := s.exec(ctx, `DELETE FROM processed_txs WHERE block_number = ?`, blockNumber)
+
+		return err
+	})
+}
+
+func (s *Storage) GetLastProcessedTxIndex(block int) (int, bool) {
+	var (
+		idx int
+		ok  bool
+	)
+	s.blocksQuery(func(ctx context.Context) error {
+		err := s.db.QueryRowContext(ctx, s.dialect.rebind(`SELECT tx_index FROM processed_txs WHERE block_number = ?`), block).Scan(&idx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		ok = err == nil
+
+		return err
+	})
+
+	return idx, ok
+}
+
+func (s *Storage) SetLastProcessedTxIndex(block int, idx int) {
+	s.blocksQuery(func(ctx context.Context) error {
+		_, err := s.exec(ctx,
+			`INSERT INTO processed_txs (block_number, tx_index) VALUES (?, ?)
+			ON CONFLICT (block_number) DO UPDATE SET tx_index = excluded.tx_index`,
+			block, idx,
+		)
+
+		return err
+	})
+}
+
+func (s *Storage) GetBlockHash(block int) (string, bool) {
+	var (
+		hash string
+		ok   bool
+	)
+	s.blocksQuery(func(ctx context.Context) error {
+		err := s.db.QueryRowContext(ctx, s.dialect.rebind(`SELECT hash FROM block_hashes WHERE block_number = ?`), block).Scan(&hash)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		ok = err == nil
+
+		return err
+	})
+
+	return hash, ok
+}
+
+func (s *Storage) SetBlockHash(block int, hash string) {
+	s.blocksQuery(func(ctx context.Context) error {
+		_, err := s.exec(ctx,
+			`INSERT INTO block_hashes (block_number, hash) VALUES (?, ?)
+			ON CONFLICT (block_number) DO UPDATE SET hash = excluded.hash`,
+			block, hash,
+		)
+
+		return err
+	})
+}
+
+func (s *Storage) DelBlockHash(block int) {
+	s.blocksQuery(func(ctx context.Context) error {
+		_, err := s.exec(ctx, `DELETE FROM block_hashes WHERE block_number = ?`, block)
+
+		return err
+	})
+}
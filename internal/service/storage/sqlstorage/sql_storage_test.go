@@ -0,0 +1,187 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestDB - opens database of SQL_TEST_DRIVER (sqlite by default) and SQL_TEST_DSN,
+// test is skipped when driver of SQL_TEST_DRIVER is not linked, sqlite driver is always linked
+func openTestDB(t *testing.T) *Storage {
+	driver, dsn := os.Getenv("SQL_TEST_DRIVER"), os.Getenv("SQL_TEST_DSN")
+	if driver == "" {
+		driver, dsn = "sqlite", ":memory:"
+	}
+	if !slices.Contains(sql.Drivers(), driver) {
+		t.Skipf("sql driver %s is not registered", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	require.NoError(t, err)
+	// every connection of in-memory sqlite has its own database
+	db.SetMaxOpenConns(1)
+
+	storage, err := New(context.Background(), db, WithDialect(DialectByDriver(driver)))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, storage.Close())
+	})
+
+	return storage
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		return openTestDB(t)
+	})
+}
+
+func TestStorage(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		storage = openTestDB(t)
+		addr    = domain.Address("0xaddr")
+	)
+	require.NoError(t, storage.AddSubscriber(ctx, addr))
+	require.ErrorIs(t, storage.AddSubscriber(ctx, addr), domain.ErrAddressAlreadySubscribed)
+	exists, err := storage.ExistsSubscriber(ctx, addr)
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = storage.ExistsSubscriber(ctx, "0xother")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x1", BlockHash: "0xa", BlockNumber: "0xa"})
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x2", BlockHash: "0xb", BlockNumber: "0xb"})
+	removed, err := storage.DelBlockTxs(ctx, "0xb")
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+
+	storagetest.AddTx(t, storage, addr, domain.Transaction{Hash: "0x3", BlockHash: "0xc", BlockNumber: "0xc"})
+
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+	require.Equal(t, "0x1", page.Transactions[0].Hash)
+	page, err = storage.GetTransactions(ctx, addr, domain.TxQuery{After: page.Next})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+	require.Equal(t, "0x3", page.Transactions[0].Hash)
+	page, err = storage.GetTransactions(ctx, addr, domain.TxQuery{FromBlock: 0xc})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+
+	removed, err = storage.AckTransactions(ctx, addr, page.Next)
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	page, err = storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Empty(t, page.Transactions)
+}
+
+func TestBlocksStorage(t *testing.T) {
+	storage := openTestDB(t)
+
+	require.Equal(t, 0, storage.GetCurrentBlock())
+	storage.SetCurrentBlock(10)
+	storage.SetCurrentBlock(11)
+	require.Equal(t, 11, storage.GetCurrentBlock())
+
+	_, ok := storage.GetLastProcessedTxIndex(11)
+	require.False(t, ok)
+	storage.SetLastProcessedTxIndex(11, 2)
+	storage.SetLastProcessedTxIndex(11, 3)
+	idx, ok := storage.GetLastProcessedTxIndex(11)
+	require.True(t, ok)
+	require.Equal(t, 3, idx)
+	storage.DelLastProcessedTxIndex(11)
+	_, ok = storage.GetLastProcessedTxIndex(11)
+	require.False(t, ok)
+
+	storage.SetBlockHash(11, "0xa")
+	hash, ok := storage.GetBlockHash(11)
+	require.True(t, ok)
+	require.Equal(t, "0xa", hash)
+	storage.DelBlockHash(11)
+	_, ok = storage.GetBlockHash(11)
+	require.False(t, ok)
+
+	require.NoError(t, storage.Err())
+}
+
+func TestSQLiteConcurrentWriters(t *testing.T) {
+	const (
+		writers = 10
+		txs     = 50
+	)
+	var (
+		ctx = context.Background()
+		dsn = SQLiteDSN(filepath.Join(t.TempDir(), "tx-parser.db"))
+	)
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	storage, err := New(ctx, db)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, storage.Close())
+	}()
+	addr := domain.Address("0xaddr")
+	require.NoError(t, storage.AddSubscriber(ctx, addr))
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, writers*txs)
+	)
+	for writer := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range txs {
+				number := writer*txs + i
+				_, err := storage.AddTx(ctx, addr, domain.Transaction{
+					Hash:        "0x" + strconv.Itoa(number),
+					BlockHash:   "0xb" + strconv.Itoa(number),
+					BlockNumber: "0x" + strconv.FormatInt(int64(number), 16),
+				})
+				if err != nil {
+					errs <- err
+				}
+				storage.SetBlockHash(number, "0xb"+strconv.Itoa(number))
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.NoError(t, storage.Err())
+
+	sub, err := storage.GetSubscription(ctx, addr)
+	require.NoError(t, err)
+	require.Equal(t, writers*txs, sub.Stored)
+	require.Equal(t, writers*txs, sub.Matched)
+}
+
+func TestRebind(t *testing.T) {
+	query := `SELECT 1 FROM t WHERE a = ? AND b = ?`
+	require.Equal(t, query, SQLite.rebind(query))
+	require.Equal(t, `SELECT 1 FROM t WHERE a = $1 AND b = $2`, Postgres.rebind(query))
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	require.Equal(t, "tx-parser.db?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate",
+		SQLiteDSN("tx-parser.db"))
+	require.Equal(t, "file:tx-parser.db?_pragma=journal_mode(DELETE)&_pragma=busy_timeout(10000)&_txlock=immediate",
+		SQLiteDSN("file:tx-parser.db?_pragma=journal_mode(DELETE)"))
+}
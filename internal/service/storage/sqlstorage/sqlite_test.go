@@ -0,0 +1,5 @@
+package sqlstorage
+
+import (
+	_ "modernc.org/sqlite"
+)
@@ -0,0 +1,144 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+func (s *Storage) SetWebhook(ctx context.Context, addr domain.Address, webhook domain.Webhook) error {
+	_, err := s.exec(ctx,
+		`INSERT INTO webhooks (address, url, secret) VALUES (?, ?, ?)
+		ON CONFLICT (address) DO UPDATE SET url = excluded.url, secret = excluded.secret`,
+		addr, webhook.URL, webhook.Secret,
+	)
+
+	return err
+}
+
+func (s *Storage) GetWebhook(ctx context.Context, addr domain.Address) (domain.Webhook, error) {
+	var webhook domain.Webhook
+	err := s.db.QueryRowContext(ctx,
+		s.dialect.rebind(`SELECT url, secret FROM webhooks WHERE address = ?`), addr,
+	).Scan(&webhook.URL, &webhook.Secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Webhook{}, domain.ErrWebhookNotFound
+	}
+
+	return webhook, err
+}
+
+func (s *Storage) DelWebhook(ctx context.Context, addr domain.Address) error {
+	_, err := s.exec(ctx, `DELETE FROM webhooks WHERE address = ?`, addr)
+
+	return err
+}
+
+func (s *Storage) AddDelivery(ctx context.Context, delivery domain.Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx,
+		`INSERT INTO deliveries (id, status, next_attempt, data) VALUES (?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+		delivery.ID, delivery.Status, delivery.NextAttempt.UnixMilli(), string(data),
+	)
+
+	return err
+}
+
+func (s *Storage) UpdateDelivery(ctx context.Context, delivery domain.Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	res, err := s.exec(ctx,
+		`UPDATE deliveries SET status = ?, next_attempt = ?, data = ? WHERE id = ?`,
+		delivery.Status, delivery.NextAttempt.UnixMilli(), string(data), delivery.ID,
+	)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return domain.ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) DelDelivery(ctx context.Context, id string) error {
+	_, err := s.exec(ctx, `DELETE FROM deliveries WHERE id = ?`, id)
+
+	return err
+}
+
+func (s *Storage) GetDelivery(ctx context.Context, id string) (domain.Delivery, error) {
+	deliveries, err := s.queryDeliveries(ctx, `SELECT data FROM deliveries WHERE id = ?`, id)
+	if err != nil {
+		return domain.Delivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return domain.Delivery{}, domain.ErrDeliveryNotFound
+	}
+
+	return deliveries[0], nil
+}
+
+func (s *Storage) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.Delivery, error) {
+	var (
+		query = `SELECT data FROM deliveries WHERE status = ? AND next_attempt <= ? ORDER BY next_attempt, id`
+		args  = []any{domain.DeliveryPending, now.UnixMilli()}
+	)
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	return s.queryDeliveries(ctx, query, args...)
+}
+
+func (s *Storage) DeadDeliveries(ctx context.Context, query domain.DeliveryQuery) ([]domain.Delivery, error) {
+	var (
+		statement = `SELECT data FROM deliveries WHERE status = ? AND id > ? ORDER BY id`
+		args      = []any{domain.DeliveryDead, query.After}
+	)
+	if query.Limit > 0 {
+		statement += ` LIMIT ?`
+		args = append(args, query.Limit)
+	}
+
+	return s.queryDeliveries(ctx, statement, args...)
+}
+
+func (s *Storage) queryDeliveries(ctx context.Context, query string, args ...any) ([]domain.Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []domain.Delivery
+	for rows.Next() {
+		var (
+			delivery domain.Delivery
+			data     string
+		)
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(data), &delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,594 @@
+// Package storagetest - conformance tests every service.Storage implementation must pass
+package storagetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+// NewStorage - creates empty storage for single test
+type NewStorage func(t *testing.T) service.Storage
+
+// Run - runs conformance tests against storages created by newStorage
+func Run(t *testing.T, newStorage NewStorage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, storage service.Storage)
+	}{
+		{name: "Subscribers", test: testSubscribers},
+		{name: "Cursor", test: testCursor},
+		{name: "CursorAfterTailDeletion", test: testCursorAfterTailDeletion},
+		{name: "Filters", test: testFilters},
+		{name: "Desc", test: testDesc},
+		{name: "Ack", test: testAck},
+		{name: "DelBlockTxs", test: testDelBlockTxs},
+		{name: "Idempotent", test: testIdempotent},
+		{name: "TransferKeys", test: testTransferKeys},
+		{name: "ByHash", test: testByHash},
+		{name: "InRange", test: testInRange},
+		{name: "Subscriptions", test: testSubscriptions},
+		{name: "Unsubscribe", test: testUnsubscribe},
+		{name: "Webhooks", test: testWebhooks},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+// AddTx - stores transaction of address failing test on error, reports whether it is added
+func AddTx(t *testing.T, storage service.Storage, addr domain.Address, tx domain.Transaction) bool {
+	t.Helper()
+	added, err := storage.AddTx(context.Background(), addr, tx)
+	require.NoError(t, err)
+
+	return added
+}
+
+func genAddress() domain.Address {
+	var addr [20]byte
+	_, _ = rand.Read(addr[:])
+
+	return domain.Address("0x" + hex.EncodeToString(addr[:]))
+}
+
+func hashes(txs []domain.Transaction) []string {
+	result := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		result = append(result, tx.Hash)
+	}
+
+	return result
+}
+
+func testSubscribers(t *testing.T, storage service.Storage) {
+	var (
+		ctx  = context.Background()
+		addr = genAddress()
+	)
+	exists, err := storage.ExistsSubscriber(ctx, addr)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, storage.AddSubscriber(ctx, addr))
+	require.ErrorIs(t, storage.AddSubscriber(ctx, addr), domain.ErrAddressAlreadySubscribed)
+
+	exists, err = storage.ExistsSubscriber(ctx, addr)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	batch, err := storage.ExistsSubscribers(ctx, []domain.Address{genAddress(), addr, addr})
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, true, true}, batch)
+
+	batch, err = storage.ExistsSubscribers(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, batch)
+
+	other := genAddress()
+	require.NoError(t, storage.AddSubscriber(ctx, other))
+	subscribers, err := storage.Subscribers(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []domain.Address{addr, other}, subscribers)
+}
+
+func testSubscriptions(t *testing.T, storage service.Storage) {
+	var (
+		ctx   = context.Background()
+		addrs = []domain.Address{genAddress(), genAddress(), genAddress()}
+		start = time.Now().Add(-time.Second)
+	)
+	slices.Sort(addrs)
+	_, err := storage.GetSubscription(ctx, addrs[0])
+	require.ErrorIs(t, err, domain.ErrAddressNotSubscribed)
+
+	for _, addr := range addrs {
+		require.NoError(t, storage.AddSubscriber(ctx, addr))
+	}
+	for _, hash := range []string{"0x1", "0x2"} {
+		AddTx(t, storage, addrs[1], domain.Transaction{Hash: hash, BlockHash: "0xa", BlockNumber: "0x1"})
+	}
+	// repeated transaction is not counted
+	AddTx(t, storage, addrs[1], domain.Transaction{Hash: "0x1", BlockHash: "0xa", BlockNumber: "0x1"})
+	_, err = storage.AckTransactions(ctx, addrs[1], math.MaxUint64)
+	require.NoError(t, err)
+	AddTx(t, storage, addrs[1], domain.Transaction{Hash: "0x3", BlockHash: "0xb", BlockNumber: "0x2"})
+
+	sub, err := storage.GetSubscription(ctx, addrs[1])
+	require.NoError(t, err)
+	require.Equal(t, addrs[1], sub.Address)
+	require.Equal(t, 3, sub.Matched)
+	require.Equal(t, 1, sub.Stored)
+	require.True(t, sub.CreatedAt.After(start), sub.CreatedAt)
+
+	page, err := storage.ListSubscriptions(ctx, domain.SubscriptionQuery{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Subscriptions, 2)
+	require.Equal(t, addrs[0], page.Subscriptions[0].Address)
+	require.Equal(t, sub, page.Subscriptions[1])
+	require.Equal(t, addrs[1], page.Next)
+
+	page, err = storage.ListSubscriptions(ctx, domain.SubscriptionQuery{After: page.Next, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Subscriptions, 1)
+	require.Equal(t, addrs[2], page.Subscriptions[0].Address)
+	require.Empty(t, page.Next)
+}
+
+func testUnsubscribe(t *testing.T, storage service.Storage) {
+	var (
+		ctx    = context.Background()
+		kept   = genAddress()
+		purged = genAddress()
+	)
+	_, err := storage.Unsubscribe(ctx, kept, false)
+	require.ErrorIs(t, err, domain.ErrAddressNotSubscribed)
+
+	for _, addr := range []domain.Address{kept, purged} {
+		require.NoError(t, storage.AddSubscriber(ctx, addr))
+		AddTx(t, storage, addr, domain.Transaction{Hash: "0x1", BlockHash: "0xa", BlockNumber: "0x1"})
+		AddTx(t, storage, addr, domain.Transaction{Hash: "0x2", BlockHash: "0xa", BlockNumber: "0x1"})
+	}
+
+	removed, err := storage.Unsubscribe(ctx, kept, false)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+	removed, err = storage.Unsubscribe(ctx, purged, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	_, err = storage.Unsubscribe(ctx, purged, true)
+	require.ErrorIs(t, err, domain.ErrAddressNotSubscribed)
+
+	exists, err := storage.ExistsSubscribers(ctx, []domain.Address{kept, purged})
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, false}, exists)
+	_, err = storage.GetSubscription(ctx, kept)
+	require.ErrorIs(t, err, domain.ErrAddressNotSubscribed)
+
+	page, err := storage.GetTransactions(ctx, kept, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 2)
+	empty, err := storage.GetTransactions(ctx, purged, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Empty(t, empty.Transactions)
+	matched, err := storage.GetTransactionsByHash(ctx, "0x1")
+	require.NoError(t, err)
+	require.Equal(t, []domain.MatchedTx{{Address: kept, Transaction: page.Transactions[0]}}, matched)
+
+	// subscription starts over, purged transaction can be stored again
+	require.NoError(t, storage.AddSubscriber(ctx, purged))
+	AddTx(t, storage, purged, domain.Transaction{Hash: "0x1", BlockHash: "0xa", BlockNumber: "0x1"})
+	sub, err := storage.GetSubscription(ctx, purged)
+	require.NoError(t, err)
+	require.Equal(t, 1, sub.Matched)
+	require.Equal(t, 1, sub.Stored)
+}
+
+func testCursor(t *testing.T, storage service.Storage) {
+	var (
+		ctx  = context.Background()
+		addr = genAddress()
+	)
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Empty(t, page.Transactions)
+	require.Zero(t, page.Next)
+
+	for _, number := range []string{"0x1", "0x2", "0x3"} {
+		AddTx(t, storage, addr, domain.Transaction{Hash: "0xa" + number, BlockNumber: number})
+		// transactions of other address do not affect address cursor
+		AddTx(t, storage, genAddress(), domain.Transaction{Hash: "0xb" + number, BlockNumber: number})
+	}
+
+	page, err = storage.GetTransactions(ctx, addr, domain.TxQuery{Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0xa0x1", "0xa0x2"}, hashes(page.Transactions))
+
+	next, err := storage.GetTransactions(ctx, addr, domain.TxQuery{After: page.Next})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0xa0x3"}, hashes(next.Transactions))
+	require.Greater(t, next.Next, page.Next)
+
+	// read is not destructive
+	retained, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, retained.Transactions, 3)
+	require.Equal(t, next.Next, retained.Next)
+
+	empty, err := storage.GetTransactions(ctx, addr, domain.TxQuery{After: next.Next})
+	require.NoError(t, err)
+	require.Empty(t, empty.Transactions)
+	require.Equal(t, next.Next, empty.Next)
+
+	fromBlock, err := storage.GetTransactions(ctx, addr, domain.TxQuery{FromBlock: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0xa0x2", "0xa0x3"}, hashes(fromBlock.Transactions))
+}
+
+// testCursorAfterTailDeletion - cursor survives deletion of tail rows, sequences of removed
+// transactions are not reused by transactions stored after them
+func testCursorAfterTailDeletion(t *testing.T, storage service.Storage) {
+	var (
+		ctx  = context.Background()
+		addr = genAddress()
+	)
+	for _, hash := range []string{"0x1", "0x2", "0x3"} {
+		AddTx(t, storage, addr, domain.Transaction{Hash: hash, BlockHash: "0xa", BlockNumber: "0x1"})
+	}
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 3)
+
+	// orphaned block holds the last stored rows
+	removed, err := storage.DelBlockTxs(ctx, "0xa")
+	require.NoError(t, err)
+	require.Equal(t, 3, removed)
+	AddTx(t, storage, addr, domain.Transaction{Hash: "0x4", BlockHash: "0xb", BlockNumber: "0x1"})
+
+	next, err := storage.GetTransactions(ctx, addr, domain.TxQuery{After: page.Next})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x4"}, hashes(next.Transactions))
+
+	// acknowledged rows are the last stored ones too
+	removed, err = storage.AckTransactions(ctx, addr, next.Next)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	AddTx(t, storage, addr, domain.Transaction{Hash: "0x5", BlockHash: "0xb", BlockNumber: "0x1"})
+
+	next, err = storage.GetTransactions(ctx, addr, domain.TxQuery{After: next.Next})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x5"}, hashes(next.Transactions))
+}
+
+func testFilters(t *testing.T, storage service.Storage) {
+	var (
+		ctx   = context.Background()
+		addr  = genAddress()
+		other = genAddress()
+	)
+	txs := []domain.Transaction{
+		{Hash: "0x1", BlockNumber: "0x1", From: addr, To: other, Value: "0x64", Status: domain.TxStatusSuccess},
+		{Hash: "0x2", BlockNumber: "0x2", From: other, To: addr, Value: "0x1", Status: domain.TxStatusFailed},
+		{Hash: "0x3", BlockNumber: "0x3", From: addr, To: addr, Value: "0x0", Status: domain.TxStatusSuccess},
+		{
+			Hash: "0x4", BlockNumber: "0x4", From: other, To: genAddress(), Kind: domain.TxKindToken,
+			TokenTransfer: &domain.TokenTransfer{From: other, To: addr, Amount: "1000", LogIndex: "0x0"},
+		},
+	}
+	for _, tx := range txs {
+		AddTx(t, storage, addr, tx)
+	}
+
+	tests := []struct {
+		name   string
+		query  domain.TxQuery
+		hashes []string
+	}{
+		{name: "in", query: domain.TxQuery{Direction: domain.DirectionIn}, hashes: []string{"0x2", "0x4"}},
+		{name: "out", query: domain.TxQuery{Direction: domain.DirectionOut}, hashes: []string{"0x1"}},
+		{name: "self", query: domain.TxQuery{Direction: domain.DirectionSelf}, hashes: []string{"0x3"}},
+		{name: "block range", query: domain.TxQuery{FromBlock: 2, ToBlock: 3}, hashes: []string{"0x2", "0x3"}},
+		{name: "min value", query: domain.TxQuery{MinValue: big.NewInt(100)}, hashes: []string{"0x1", "0x4"}},
+		{name: "succeeded", query: domain.TxQuery{Status: domain.TxResultSucceeded}, hashes: []string{"0x1", "0x3"}},
+		{name: "failed", query: domain.TxQuery{Status: domain.TxResultFailed}, hashes: []string{"0x2"}},
+		{name: "limit after filter", query: domain.TxQuery{Direction: domain.DirectionIn, Limit: 1}, hashes: []string{"0x2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := storage.GetTransactions(ctx, addr, tt.query)
+			require.NoError(t, err)
+			require.Equal(t, tt.hashes, hashes(page.Transactions))
+		})
+	}
+}
+
+func testDesc(t *testing.T, storage service.Storage) {
+	var (
+		ctx  = context.Background()
+		addr = genAddress()
+	)
+	for _, hash := range []string{"0x1", "0x2", "0x3", "0x4"} {
+		AddTx(t, storage, addr, domain.Transaction{Hash: hash, BlockNumber: "0x1"})
+	}
+	asc, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+
+	query := domain.TxQuery{Order: domain.TxOrderDesc, Limit: 3}
+	page, err := storage.GetTransactions(ctx, addr, query)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x4", "0x3", "0x2"}, hashes(page.Transactions))
+
+	page, err = storage.GetTransactions(ctx, addr, query.Continue(page.Next))
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x1"}, hashes(page.Transactions))
+
+	// cursor bounds are exclusive in both orders
+	page, err = storage.GetTransactions(ctx, addr, domain.TxQuery{After: page.Next, Before: asc.Next})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x2", "0x3"}, hashes(page.Transactions))
+
+	empty, err := storage.GetTransactions(ctx, addr, domain.TxQuery{Order: domain.TxOrderDesc, Before: page.Next, After: page.Next - 1})
+	require.NoError(t, err)
+	require.Empty(t, empty.Transactions)
+	require.Equal(t, page.Next, empty.Next)
+}
+
+func testAck(t *testing.T, storage service.Storage) {
+	var (
+		ctx  = context.Background()
+		addr = genAddress()
+	)
+	for _, hash := range []string{"0x1", "0x2", "0x3"} {
+		AddTx(t, storage, addr, domain.Transaction{Hash: hash})
+	}
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{Limit: 2})
+	require.NoError(t, err)
+
+	removed, err := storage.AckTransactions(ctx, addr, page.Next)
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+
+	rest, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x3"}, hashes(rest.Transactions))
+
+	removed, err = storage.AckTransactions(ctx, addr, page.Next)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+}
+
+func testDelBlockTxs(t *testing.T, storage service.Storage) {
+	var (
+		ctx   = context.Background()
+		addr  = genAddress()
+		other = genAddress()
+	)
+	AddTx(t, storage, addr, domain.Transaction{Hash: "0x1", BlockHash: "0xa"})
+	AddTx(t, storage, addr, domain.Transaction{Hash: "0x2", BlockHash: "0xb"})
+	AddTx(t, storage, other, domain.Transaction{Hash: "0x2", BlockHash: "0xb"})
+
+	removed, err := storage.DelBlockTxs(ctx, "0xb")
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x1"}, hashes(page.Transactions))
+
+	// transaction of orphaned block is stored again when canonical block includes it
+	AddTx(t, storage, addr, domain.Transaction{Hash: "0x2", BlockHash: "0xc"})
+	page, err = storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x1", "0x2"}, hashes(page.Transactions))
+}
+
+func testIdempotent(t *testing.T, storage service.Storage) {
+	var (
+		ctx   = context.Background()
+		addr  = genAddress()
+		other = genAddress()
+		tx    = domain.Transaction{Hash: "0x1", BlockHash: "0xa", BlockNumber: "0x1"}
+	)
+	for i := range 3 {
+		require.Equal(t, i == 0, AddTx(t, storage, addr, tx), "only the first write adds transaction")
+	}
+	// the same transaction of other address is stored separately
+	require.True(t, AddTx(t, storage, other, tx))
+
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+
+	// repeated write does not move cursor
+	require.False(t, AddTx(t, storage, addr, tx))
+	next, err := storage.GetTransactions(ctx, addr, domain.TxQuery{After: page.Next})
+	require.NoError(t, err)
+	require.Empty(t, next.Transactions)
+
+	page, err = storage.GetTransactions(ctx, other, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+}
+
+func testTransferKeys(t *testing.T, storage service.Storage) {
+	var (
+		ctx  = context.Background()
+		addr = genAddress()
+		tx   = domain.Transaction{Hash: "0x1", BlockHash: "0xa"}
+	)
+	token := func(logIndex string) domain.Transaction {
+		return tx.AsTokenTransfer(domain.TokenTransfer{Token: genAddress(), From: addr, To: genAddress(), LogIndex: logIndex})
+	}
+	internal := func(traceAddress string) domain.Transaction {
+		return tx.AsInternalTransfer(domain.Transaction{From: addr, To: genAddress(), TraceAddress: traceAddress})
+	}
+	for range 2 {
+		AddTx(t, storage, addr, tx)
+		AddTx(t, storage, addr, token("0x0"))
+		AddTx(t, storage, addr, token("0x1"))
+		AddTx(t, storage, addr, internal("0"))
+		AddTx(t, storage, addr, internal("0-1"))
+	}
+
+	page, err := storage.GetTransactions(ctx, addr, domain.TxQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 5)
+}
+
+func testByHash(t *testing.T, storage service.Storage) {
+	var (
+		ctx   = context.Background()
+		addr  = genAddress()
+		other = genAddress()
+		tx    = domain.Transaction{Hash: "0x" + string(genAddress()[2:]), BlockHash: "0xa", BlockNumber: "0x1"}
+		token = tx.AsTokenTransfer(domain.TokenTransfer{Token: genAddress(), From: other, To: addr, LogIndex: "0x0"})
+	)
+	matched, err := storage.GetTransactionsByHash(ctx, tx.Hash)
+	require.NoError(t, err)
+	require.Empty(t, matched)
+
+	AddTx(t, storage, addr, tx)
+	AddTx(t, storage, other, token)
+	AddTx(t, storage, addr, domain.Transaction{Hash: "0x2", BlockHash: "0xa", BlockNumber: "0x1"})
+
+	matched, err = storage.GetTransactionsByHash(ctx, tx.Hash)
+	require.NoError(t, err)
+	require.Equal(t, []domain.MatchedTx{
+		{Address: addr, Transaction: tx},
+		{Address: other, Transaction: token},
+	}, matched)
+
+	_, err = storage.AckTransactions(ctx, addr, ^uint64(0))
+	require.NoError(t, err)
+	matched, err = storage.GetTransactionsByHash(ctx, tx.Hash)
+	require.NoError(t, err)
+	require.Equal(t, []domain.MatchedTx{{Address: other, Transaction: token}}, matched)
+}
+
+func testInRange(t *testing.T, storage service.Storage) {
+	var (
+		ctx   = context.Background()
+		addr  = genAddress()
+		other = genAddress()
+	)
+	// stored out of block order, returned ordered by block
+	for _, number := range []string{"0x3", "0x1", "0x2", "0x5"} {
+		AddTx(t, storage, addr, domain.Transaction{Hash: "0xa" + number, BlockHash: "0xb" + number, BlockNumber: number})
+	}
+	AddTx(t, storage, other, domain.Transaction{Hash: "0xc", BlockHash: "0xb0x2", BlockNumber: "0x2"})
+
+	matched, err := storage.GetTransactionsInRange(ctx, 2, 4)
+	require.NoError(t, err)
+	require.Equal(t, []domain.MatchedTx{
+		{Address: addr, Transaction: domain.Transaction{Hash: "0xa0x2", BlockHash: "0xb0x2", BlockNumber: "0x2"}},
+		{Address: other, Transaction: domain.Transaction{Hash: "0xc", BlockHash: "0xb0x2", BlockNumber: "0x2"}},
+		{Address: addr, Transaction: domain.Transaction{Hash: "0xa0x3", BlockHash: "0xb0x3", BlockNumber: "0x3"}},
+	}, matched)
+
+	_, err = storage.DelBlockTxs(ctx, "0xb0x2")
+	require.NoError(t, err)
+	matched, err = storage.GetTransactionsInRange(ctx, 2, 2)
+	require.NoError(t, err)
+	require.Empty(t, matched)
+}
+
+func ids(deliveries []domain.Delivery) []string {
+	result := make([]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		result = append(result, delivery.ID)
+	}
+
+	return result
+}
+
+func testWebhooks(t *testing.T, storage service.Storage) {
+	hooks, ok := service.StorageAs[service.WebhookStorage](storage)
+	if !ok {
+		t.Skip("storage does not support webhooks")
+	}
+	var (
+		ctx     = context.Background()
+		addr    = genAddress()
+		webhook = domain.Webhook{URL: "https://example.com/hook", Secret: "secret"}
+		now     = time.Now().Truncate(time.Millisecond)
+	)
+	_, err := hooks.GetWebhook(ctx, addr)
+	require.ErrorIs(t, err, domain.ErrWebhookNotFound)
+	require.NoError(t, hooks.SetWebhook(ctx, addr, webhook))
+	got, err := hooks.GetWebhook(ctx, addr)
+	require.NoError(t, err)
+	require.Equal(t, webhook, got)
+	require.NoError(t, hooks.DelWebhook(ctx, addr))
+	require.NoError(t, hooks.DelWebhook(ctx, addr))
+	_, err = hooks.GetWebhook(ctx, addr)
+	require.ErrorIs(t, err, domain.ErrWebhookNotFound)
+
+	deliveries := make([]domain.Delivery, 0, 3)
+	for i := range 3 {
+		tx := domain.Transaction{Hash: "0x" + strconv.Itoa(i+1), BlockHash: "0xa", BlockNumber: "0x1"}
+		// deliveries are due in reverse order of creation
+		deliveries = append(deliveries, domain.NewDelivery(addr, tx, now.Add(-time.Duration(i)*time.Second)))
+		require.NoError(t, hooks.AddDelivery(ctx, deliveries[i]))
+	}
+	repeated := deliveries[0]
+	repeated.NextAttempt = now.Add(-time.Hour)
+	require.NoError(t, hooks.AddDelivery(ctx, repeated), "stored delivery is ignored")
+
+	got0, err := hooks.GetDelivery(ctx, deliveries[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, deliveries[0].Transaction, got0.Transaction)
+	require.Equal(t, domain.DeliveryPending, got0.Status)
+	require.True(t, deliveries[0].NextAttempt.Equal(got0.NextAttempt), got0.NextAttempt)
+
+	due, err := hooks.DueDeliveries(ctx, now.Add(-time.Second), 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{deliveries[2].ID, deliveries[1].ID}, ids(due))
+	due, err = hooks.DueDeliveries(ctx, now, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{deliveries[2].ID}, ids(due))
+
+	for _, delivery := range deliveries {
+		delivery.Status = domain.DeliveryDead
+		delivery.Attempts = []domain.DeliveryAttempt{{At: now, StatusCode: 500, Error: "unexpected status"}}
+		require.NoError(t, hooks.UpdateDelivery(ctx, delivery))
+	}
+	due, err = hooks.DueDeliveries(ctx, now, 0)
+	require.NoError(t, err)
+	require.Empty(t, due, "dead deliveries are not due")
+
+	dead := ids(deliveries)
+	slices.Sort(dead)
+	page, err := hooks.DeadDeliveries(ctx, domain.DeliveryQuery{Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, dead[:2], ids(page))
+	require.Equal(t, domain.DeliveryDead, page[0].Status)
+	require.Len(t, page[0].Attempts, 1)
+	require.Equal(t, 500, page[0].Attempts[0].StatusCode)
+	page, err = hooks.DeadDeliveries(ctx, domain.DeliveryQuery{After: dead[1]})
+	require.NoError(t, err)
+	require.Equal(t, dead[2:], ids(page))
+
+	require.NoError(t, hooks.DelDelivery(ctx, dead[0]))
+	require.NoError(t, hooks.DelDelivery(ctx, dead[0]))
+	_, err = hooks.GetDelivery(ctx, dead[0])
+	require.ErrorIs(t, err, domain.ErrDeliveryNotFound)
+	page, err = hooks.DeadDeliveries(ctx, domain.DeliveryQuery{})
+	require.NoError(t, err)
+	require.Equal(t, dead[1:], ids(page))
+
+	removed := deliveries[0]
+	removed.ID = dead[0]
+	require.ErrorIs(t, hooks.UpdateDelivery(ctx, removed), domain.ErrDeliveryNotFound)
+}
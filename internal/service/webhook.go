@@ -0,0 +1,433 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+)
+
+// WebhookStorage - storage of subscription webhooks and queue of their deliveries
+type WebhookStorage interface {
+	SetWebhook(ctx context.Context, addr domain.Address, webhook domain.Webhook) error
+	// GetWebhook - webhook of address or domain.ErrWebhookNotFound
+	GetWebhook(ctx context.Context, addr domain.Address) (domain.Webhook, error)
+	// DelWebhook - removes webhook of address, noop if address has no webhook
+	DelWebhook(ctx context.Context, addr domain.Address) error
+	// AddDelivery - enqueues delivery, delivery with already stored id is ignored
+	AddDelivery(ctx context.Context, delivery domain.Delivery) error
+	// UpdateDelivery - replaces stored delivery with the same id or returns domain.ErrDeliveryNotFound
+	UpdateDelivery(ctx context.Context, delivery domain.Delivery) error
+	// DelDelivery - removes delivery, noop if delivery is not stored
+	DelDelivery(ctx context.Context, id string) error
+	// GetDelivery - delivery by id or domain.ErrDeliveryNotFound
+	GetDelivery(ctx context.Context, id string) (domain.Delivery, error)
+	// DueDeliveries - pending deliveries with next attempt not after now ordered by next attempt
+	DueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.Delivery, error)
+	// DeadDeliveries - dead deliveries ordered by id read after query cursor
+	DeadDeliveries(ctx context.Context, query domain.DeliveryQuery) ([]domain.Delivery, error)
+}
+
+const (
+	defaultWebhookAttempts   = 8
+	defaultWebhookBackoff    = 10 * time.Second
+	defaultWebhookMaxBackoff = time.Hour
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookWorkers    = 4
+	// webhookPollInterval - interval of due deliveries check, new deliveries are sent without waiting for it
+	webhookPollInterval = time.Second
+	// webhookBatch - count of due deliveries read per storage call
+	webhookBatch = 100
+	// defaultDeliveriesLimit, maxDeliveriesLimit - page size of dead deliveries list
+	defaultDeliveriesLimit = 100
+	maxDeliveriesLimit     = 1000
+
+	// WebhookIDHeader - id of delivery, the same for all attempts, so receiver can ignore repeated deliveries
+	WebhookIDHeader = "X-Webhook-Id"
+	// WebhookTimestampHeader - unix seconds of attempt, part of signed message
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	// WebhookSignatureHeader - "sha256=" prefixed hex signature of delivery by Sign
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	webhookSignaturePrefix = "sha256="
+)
+
+// WebhookPayload - JSON body of webhook delivery
+type WebhookPayload struct {
+	ID      string         `json:"id"`
+	Address domain.Address `json:"address"`
+	// Attempt - number of delivery attempt starting from 1
+	Attempt     int                `json:"attempt"`
+	Transaction domain.Transaction `json:"transaction"`
+	// Removed - transaction was removed from chain by reorganization, its delivery should be retracted
+	Removed bool `json:"removed,omitempty"`
+}
+
+// DeliveryPage - dead deliveries read by query ordered by id
+type DeliveryPage struct {
+	Deliveries []domain.Delivery
+	// Next - cursor to continue reading with, empty if there are no more deliveries
+	Next string
+}
+
+// Sign - hex HMAC-SHA256 with webhook secret of timestamp and body joined with dot
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WithWebhookRetries - count of delivery attempts before delivery is moved to dead-letter queue,
+// delay after failed attempt is doubled from backoff up to maxBackoff
+func WithWebhookRetries(attempts int, backoff, maxBackoff time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.webhookAttempts = max(attempts, 1)
+		c.webhookBackoff = max(backoff, 0)
+		c.webhookMaxBackoff = max(maxBackoff, c.webhookBackoff)
+	}
+}
+
+// WithWebhookTimeout - timeout of webhook request
+func WithWebhookTimeout(timeout time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.webhookTimeout = timeout
+	}
+}
+
+// WithWebhook - notifies webhook with each transaction matched with subscribed address
+func WithWebhook(webhook domain.Webhook) SubscribeOption {
+	return func(s *subscription) {
+		s.webhook = &webhook
+	}
+}
+
+func (s *Service) webhookStorage() (WebhookStorage, error) {
+	storage, ok := StorageAs[WebhookStorage](s.storage)
+	if !ok {
+		return nil, domain.ErrWebhookNotSupported
+	}
+
+	return storage, nil
+}
+
+// SetWebhook - sets webhook of subscribed address, webhook is replaced if already set
+func (s *Service) SetWebhook(ctx context.Context, address domain.Address, webhook domain.Webhook) error {
+	storage, err := s.webhookStorage()
+	if err != nil {
+		return err
+	}
+	if !webhook.Valid() {
+		return domain.ErrInvalidWebhook
+	}
+	if err = s.checkSubscriber(ctx, address); err != nil {
+		return err
+	}
+
+	return storage.SetWebhook(ctx, address, webhook)
+}
+
+func (s *Service) GetWebhook(ctx context.Context, address domain.Address) (domain.Webhook, error) {
+	storage, err := s.webhookStorage()
+	if err != nil {
+		return domain.Webhook{}, err
+	}
+	if err = s.checkSubscriber(ctx, address); err != nil {
+		return domain.Webhook{}, err
+	}
+
+	return storage.GetWebhook(ctx, address)
+}
+
+// DelWebhook - removes webhook of address, pending deliveries of address are dropped
+func (s *Service) DelWebhook(ctx context.Context, address domain.Address) error {
+	storage, err := s.webhookStorage()
+	if err != nil {
+		return err
+	}
+	if err = s.checkSubscriber(ctx, address); err != nil {
+		return err
+	}
+	if _, err = storage.GetWebhook(ctx, address); err != nil {
+		return err
+	}
+
+	return storage.DelWebhook(ctx, address)
+}
+
+func (s *Service) GetDelivery(ctx context.Context, id string) (domain.Delivery, error) {
+	storage, err := s.webhookStorage()
+	if err != nil {
+		return domain.Delivery{}, err
+	}
+
+	return storage.GetDelivery(ctx, id)
+}
+
+func (s *Service) DeadDeliveries(ctx context.Context, query domain.DeliveryQuery) (DeliveryPage, error) {
+	storage, err := s.webhookStorage()
+	if err != nil {
+		return DeliveryPage{}, err
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultDeliveriesLimit
+	}
+	query.Limit = min(query.Limit, maxDeliveriesLimit)
+
+	limit := query.Limit
+	query.Limit++
+	deliveries, err := storage.DeadDeliveries(ctx, query)
+	if err != nil {
+		return DeliveryPage{}, err
+	}
+	if len(deliveries) <= limit {
+		return DeliveryPage{Deliveries: deliveries}, nil
+	}
+	deliveries = deliveries[:limit]
+
+	return DeliveryPage{
+		Deliveries: deliveries,
+		Next:       deliveries[limit-1].ID,
+	}, nil
+}
+
+// ReplayDelivery - moves dead delivery back to queue with all attempts available
+func (s *Service) ReplayDelivery(ctx context.Context, id string) error {
+	storage, err := s.webhookStorage()
+	if err != nil {
+		return err
+	}
+	delivery, err := storage.GetDelivery(ctx, id)
+	if err != nil {
+		return err
+	}
+	if delivery.Status != domain.DeliveryDead {
+		return domain.ErrDeliveryNotDead
+	}
+	if err = s.replay(ctx, storage, delivery); err != nil {
+		return err
+	}
+	s.notifyDeliveries()
+
+	return nil
+}
+
+// ReplayDeadDeliveries - moves all dead deliveries back to queue, returns count of replayed
+func (s *Service) ReplayDeadDeliveries(ctx context.Context) (int, error) {
+	storage, err := s.webhookStorage()
+	if err != nil {
+		return 0, err
+	}
+	var replayed int
+	defer s.notifyDeliveries()
+
+	for query := (domain.DeliveryQuery{Limit: webhookBatch}); ; {
+		deliveries, err := storage.DeadDeliveries(ctx, query)
+		if err != nil {
+			return replayed, err
+		}
+		for _, delivery := range deliveries {
+			if err = s.replay(ctx, storage, delivery); err != nil {
+				return replayed, err
+			}
+			replayed++
+		}
+		if len(deliveries) < query.Limit {
+			return replayed, nil
+		}
+		query.After = deliveries[len(deliveries)-1].ID
+	}
+}
+
+func (s *Service) replay(ctx context.Context, storage WebhookStorage, delivery domain.Delivery) error {
+	delivery.Status = domain.DeliveryPending
+	delivery.NextAttempt = time.Now()
+	delivery.Attempts = nil
+
+	return storage.UpdateDelivery(ctx, delivery)
+}
+
+// enqueueDelivery - enqueues delivery to address which has webhook
+func (s *Service) enqueueDelivery(ctx context.Context, delivery domain.Delivery) error {
+	storage, ok := StorageAs[WebhookStorage](s.storage)
+	if !ok {
+		return nil
+	}
+	_, err := storage.GetWebhook(ctx, delivery.Address)
+	if errors.Is(err, domain.ErrWebhookNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = storage.AddDelivery(ctx, delivery); err != nil {
+		return err
+	}
+	s.notifyDeliveries()
+
+	return nil
+}
+
+// notifyDeliveries - wakes up webhook dispatcher without waiting for poll interval
+func (s *Service) notifyDeliveries() {
+	select {
+	case s.deliveries <- struct{}{}:
+	default:
+	}
+}
+
+// RunWebhooks - delivers queued webhook deliveries till ctx done, noop if storage does not support webhooks.
+// Deliveries are sent at least once, failed ones are retried with backoff and moved to dead-letter queue
+// after the last attempt
+func (s *Service) RunWebhooks(ctx context.Context) {
+	storage, ok := StorageAs[WebhookStorage](s.storage)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.deliverDue(ctx, storage); err != nil && ctx.Err() == nil {
+			s.logger.Error(ctx, "deliverDue", slog.Any("error", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.deliveries:
+		}
+	}
+}
+
+// deliverDue - attempts due deliveries by batches with configured count of concurrent requests
+func (s *Service) deliverDue(ctx context.Context, storage WebhookStorage) error {
+	for ctx.Err() == nil {
+		due, err := storage.DueDeliveries(ctx, time.Now(), webhookBatch)
+		if err != nil {
+			return err
+		}
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			joinedErr error
+			workers   = make(chan struct{}, defaultWebhookWorkers)
+		)
+		for _, delivery := range due {
+			workers <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-workers
+					wg.Done()
+				}()
+				if err := s.deliver(ctx, storage, delivery); err != nil {
+					mu.Lock()
+					joinedErr = errors.Join(joinedErr, err)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if joinedErr != nil || len(due) < webhookBatch {
+			return joinedErr
+		}
+	}
+
+	return nil
+}
+
+// deliver - sends delivery and removes it on success, otherwise records failed attempt
+// and schedules the next one or moves delivery to dead-letter queue
+func (s *Service) deliver(ctx context.Context, storage WebhookStorage, delivery domain.Delivery) error {
+	webhook, err := storage.GetWebhook(ctx, delivery.Address)
+	if errors.Is(err, domain.ErrWebhookNotFound) {
+		// webhook was removed after delivery was enqueued
+		return storage.DelDelivery(ctx, delivery.ID)
+	}
+	if err != nil {
+		return err
+	}
+	attempt := domain.DeliveryAttempt{
+		At: time.Now(),
+	}
+	attempt.StatusCode, err = s.post(ctx, webhook, delivery)
+	if err == nil {
+		return storage.DelDelivery(ctx, delivery.ID)
+	}
+	if ctx.Err() != nil {
+		// interrupted attempt is repeated after restart
+		return nil
+	}
+	attempt.Error = err.Error()
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	if len(delivery.Attempts) >= s.cfg.webhookAttempts {
+		delivery.Status = domain.DeliveryDead
+		s.logger.Info(ctx, "webhook delivery is dead",
+			slog.String("id", delivery.ID),
+			slog.String("address", string(delivery.Address)),
+			slog.String("error", attempt.Error),
+		)
+	} else {
+		backoff := s.cfg.webhookBackoff << (len(delivery.Attempts) - 1)
+		if backoff < s.cfg.webhookBackoff || backoff > s.cfg.webhookMaxBackoff {
+			backoff = s.cfg.webhookMaxBackoff
+		}
+		delivery.NextAttempt = attempt.At.Add(backoff)
+	}
+
+	return storage.UpdateDelivery(ctx, delivery)
+}
+
+// post - sends signed payload of delivery to webhook, returns response status code
+// and error if delivery is not acknowledged with 2xx status
+func (s *Service) post(ctx context.Context, webhook domain.Webhook, delivery domain.Delivery) (int, error) {
+	body, err := json.Marshal(WebhookPayload{
+		ID:          delivery.ID,
+		Address:     delivery.Address,
+		Attempt:     len(delivery.Attempts) + 1,
+		Transaction: delivery.Transaction,
+		Removed:     delivery.Removed,
+	})
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, delivery.ID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, webhookSignaturePrefix+Sign(webhook.Secret, timestamp, body))
+
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drained body lets connection be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,226 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/internal/domain"
+	"github.com/dmitrorezn/tx-parser/internal/service"
+	"github.com/dmitrorezn/tx-parser/internal/service/storage/memory"
+	"github.com/dmitrorezn/tx-parser/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		secret   = "secret"
+		failing  atomic.Bool
+		payloads = make(chan service.WebhookPayload, 10)
+	)
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		timestamp, err := strconv.ParseInt(r.Header.Get(service.WebhookTimestampHeader), 10, 64)
+		require.NoError(t, err)
+		require.Equal(t, "sha256="+service.Sign(secret, timestamp, body), r.Header.Get(service.WebhookSignatureHeader))
+
+		var payload service.WebhookPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		require.Equal(t, payload.ID, r.Header.Get(service.WebhookIDHeader))
+		payloads <- payload
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var (
+		chain = &ChainClient{}
+		addr  = genAddress()
+		cfg   = service.NewConfig(100*time.Millisecond, 10,
+			service.WithWebhookRetries(2, 10*time.Millisecond, 10*time.Millisecond),
+		)
+		svc = service.NewService(chain, memory.NewBlockNumberStorage(), memory.NewStorage(), logger.NewAttrLogger(logger.NewLogger()), cfg)
+	)
+	require.ErrorIs(t, svc.Subscribe(ctx, addr, service.WithWebhook(domain.Webhook{URL: "ftp://example.com", Secret: secret})), domain.ErrInvalidWebhook)
+	require.NoError(t, svc.Subscribe(ctx, addr, service.WithWebhook(domain.Webhook{URL: server.URL, Secret: secret})))
+	go svc.RunWebhooks(ctx)
+
+	chain.Extend(0, "a", 1, addr)
+	_, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+
+	var payload service.WebhookPayload
+	for attempt := 1; attempt <= 2; attempt++ {
+		select {
+		case payload = <-payloads:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("attempt %d is not delivered", attempt)
+		}
+		require.Equal(t, attempt, payload.Attempt)
+		require.Equal(t, addr, payload.Address)
+		require.Equal(t, addr, payload.Transaction.From)
+	}
+
+	var page service.DeliveryPage
+	require.Eventually(t, func() bool {
+		page, err = svc.DeadDeliveries(ctx, domain.DeliveryQuery{})
+		require.NoError(t, err)
+
+		return len(page.Deliveries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	dead := page.Deliveries[0]
+	require.Equal(t, payload.ID, dead.ID)
+	require.Equal(t, domain.DeliveryDead, dead.Status)
+	require.Len(t, dead.Attempts, 2)
+	require.Equal(t, http.StatusServiceUnavailable, dead.Attempts[1].StatusCode)
+
+	failing.Store(false)
+	require.NoError(t, svc.ReplayDelivery(ctx, dead.ID))
+	require.ErrorIs(t, svc.ReplayDelivery(ctx, dead.ID), domain.ErrDeliveryNotDead)
+	select {
+	case payload = <-payloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replayed delivery is not delivered")
+	}
+	require.Equal(t, dead.ID, payload.ID)
+	require.Equal(t, 1, payload.Attempt)
+	require.Eventually(t, func() bool {
+		_, err = svc.GetDelivery(ctx, dead.ID)
+
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.ErrorIs(t, err, domain.ErrDeliveryNotFound)
+
+	_, err = svc.Unsubscribe(ctx, addr)
+	require.NoError(t, err)
+	require.NoError(t, svc.Subscribe(ctx, addr))
+	_, err = svc.GetWebhook(ctx, addr)
+	require.ErrorIs(t, err, domain.ErrWebhookNotFound, "webhook is removed with subscription")
+}
+
+func TestWebhooksReorg(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	payloads := make(chan service.WebhookPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var payload service.WebhookPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads <- payload
+	}))
+	defer server.Close()
+
+	const (
+		ancestor = 100
+	)
+	var (
+		chain            = &ChainClient{}
+		addr             = genAddress()
+		blockNumberStore = memory.NewBlockNumberStorage()
+		svc              = service.NewService(chain, blockNumberStore, memory.NewStorage(), logger.NewAttrLogger(logger.NewLogger()),
+			service.NewConfig(100*time.Millisecond, 10),
+		)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr, service.WithWebhook(domain.Webhook{URL: server.URL, Secret: "secret"})))
+	go svc.RunWebhooks(ctx)
+
+	receive := func() service.WebhookPayload {
+		select {
+		case payload := <-payloads:
+			return payload
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook is not delivered")
+		}
+
+		return service.WebhookPayload{}
+	}
+
+	chain.Extend(0, "a", ancestor+1, addr)
+	blockNumberStore.SetCurrentBlock(ancestor)
+	_, err := svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	delivered := receive()
+	require.False(t, delivered.Removed)
+
+	// orphan delivered block
+	chain.Extend(ancestor, "b", 2, addr)
+	_, err = svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	retracted := receive()
+	require.True(t, retracted.Removed)
+	require.NotEqual(t, delivered.ID, retracted.ID)
+	require.Equal(t, delivered.Transaction, retracted.Transaction)
+}
+
+// FailingDeliveries - memory storage failing to enqueue the first deliveries
+type FailingDeliveries struct {
+	*memory.Storage
+	failures atomic.Int32
+}
+
+func (s *FailingDeliveries) AddDelivery(ctx context.Context, delivery domain.Delivery) error {
+	if s.failures.Add(-1) >= 0 {
+		return errors.New("add delivery failed")
+	}
+
+	return s.Storage.AddDelivery(ctx, delivery)
+}
+
+func TestWebhooksStoredNotDelivered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	payloads := make(chan service.WebhookPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var payload service.WebhookPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads <- payload
+	}))
+	defer server.Close()
+
+	const (
+		ancestor = 100
+	)
+	var (
+		chain            = &ChainClient{}
+		addr             = genAddress()
+		blockNumberStore = memory.NewBlockNumberStorage()
+		storage          = &FailingDeliveries{Storage: memory.NewStorage()}
+		svc              = service.NewService(chain, blockNumberStore, storage, logger.NewAttrLogger(logger.NewLogger()),
+			service.NewConfig(100*time.Millisecond, 10),
+		)
+	)
+	require.NoError(t, svc.Subscribe(ctx, addr, service.WithWebhook(domain.Webhook{URL: server.URL, Secret: "secret"})))
+	go svc.RunWebhooks(ctx)
+
+	chain.Extend(0, "a", ancestor+1, addr)
+	blockNumberStore.SetCurrentBlock(ancestor)
+	storage.failures.Store(1)
+	_, err := svc.ProcessTransactions(ctx)
+	require.Error(t, err)
+	require.Equal(t, ancestor, svc.GetCurrentBlock(), "block with failed delivery is reprocessed")
+
+	// transaction is already stored, but its delivery is enqueued on reprocess
+	_, err = svc.ProcessTransactions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ancestor+1, svc.GetCurrentBlock())
+	select {
+	case payload := <-payloads:
+		require.Equal(t, "0xa101tx", payload.Transaction.Hash)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stored transaction is not delivered")
+	}
+}
@@ -0,0 +1,80 @@
+// Package bloom - bloom filter answering whether item was possibly added or definitely not
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+// Filter - bloom filter safe for concurrent use, items can not be removed
+type Filter struct {
+	words  []atomic.Uint64
+	bits   uint64
+	hashes int
+	seed   maphash.Seed
+}
+
+// New - creates filter sized for expected count of items with target false positive rate
+func New(expected int, falsePositiveRate float64) *Filter {
+	expected = max(expected, 1)
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+	// optimal size m = -n*ln(p)/ln(2)^2 and count of hashes k = m/n*ln(2)
+	size := math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	words := (uint64(size) + 63) / 64
+	hashes := int(math.Round(float64(words*64) / float64(expected) * math.Ln2))
+
+	return &Filter{
+		words:  make([]atomic.Uint64, words),
+		bits:   words * 64,
+		hashes: max(hashes, 1),
+		seed:   maphash.MakeSeed(),
+	}
+}
+
+// locations - double hashing of item, the i-th bit is h1 + i*h2
+func (f *Filter) locations(item string) (uint64, uint64) {
+	h := maphash.String(f.seed, item)
+
+	return h, h>>32 | h<<32 | 1
+}
+
+func (f *Filter) Add(item string) {
+	h1, h2 := f.locations(item)
+	for i := range f.hashes {
+		bit := (h1 + uint64(i)*h2) % f.bits
+		word, mask := &f.words[bit/64], uint64(1)<<(bit%64)
+		for {
+			old := word.Load()
+			if old&mask != 0 || word.CompareAndSwap(old, old|mask) {
+				break
+			}
+		}
+	}
+}
+
+// Test - false if item was definitely not added
+func (f *Filter) Test(item string) bool {
+	h1, h2 := f.locations(item)
+	for i := range f.hashes {
+		bit := (h1 + uint64(i)*h2) % f.bits
+		if f.words[bit/64].Load()&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FalsePositiveRate - estimated probability that Test is true for not added item, grows with fill of filter
+func (f *Filter) FalsePositiveRate() float64 {
+	var set int
+	for i := range f.words {
+		set += bits.OnesCount64(f.words[i].Load())
+	}
+
+	return math.Pow(float64(set)/float64(f.bits), float64(f.hashes))
+}
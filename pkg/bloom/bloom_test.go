@@ -0,0 +1,33 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	const (
+		expected = 10_000
+		rate     = 0.01
+	)
+	filter := New(expected, rate)
+	require.Zero(t, filter.FalsePositiveRate())
+
+	for i := range expected {
+		filter.Add("added" + strconv.Itoa(i))
+	}
+	for i := range expected {
+		require.True(t, filter.Test("added"+strconv.Itoa(i)))
+	}
+
+	var positives int
+	for i := range expected {
+		if filter.Test("missing" + strconv.Itoa(i)) {
+			positives++
+		}
+	}
+	require.Less(t, float64(positives)/expected, 2*rate)
+	require.InDelta(t, rate, filter.FalsePositiveRate(), rate/2)
+}
@@ -0,0 +1,446 @@
+// Package redis - minimal Redis client speaking RESP2 over pooled connections
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNil - reply is null, e.g. GET of missing key
+	ErrNil = errors.New("redis: nil reply")
+	// ErrTxAborted - EXEC returned null reply
+	ErrTxAborted = errors.New("redis: transaction aborted")
+	ErrProtocol  = errors.New("redis: protocol error")
+)
+
+// Error - error reply of server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+type Client struct {
+	addr        string
+	password    string
+	db          int
+	dialTimeout time.Duration
+	// pool - idle connections, connection is dialed when pool is empty
+	pool chan *conn
+}
+
+type Option func(*Client)
+
+func WithPassword(password string) Option {
+	return func(c *Client) {
+		c.password = password
+	}
+}
+
+func WithDB(db int) Option {
+	return func(c *Client) {
+		c.db = db
+	}
+}
+
+// WithPoolSize - max count of idle connections kept open
+func WithPoolSize(size int) Option {
+	return func(c *Client) {
+		c.pool = make(chan *conn, max(size, 1))
+	}
+}
+
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = timeout
+	}
+}
+
+const (
+	defaultPoolSize    = 10
+	defaultDialTimeout = 5 * time.Second
+)
+
+// New - creates client of server at addr, connections are dialed on demand
+func New(addr string, options ...Option) *Client {
+	c := &Client{
+		addr:        addr,
+		dialTimeout: defaultDialTimeout,
+		pool:        make(chan *conn, defaultPoolSize),
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+
+	return c
+}
+
+// Do - sends command and returns its reply: string, int64, []any, nil for null reply or error reply as Error
+func (c *Client) Do(ctx context.Context, args ...any) (any, error) {
+	replies, err := c.Pipeline(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := replies[0].(Error); ok {
+		return nil, err
+	}
+
+	return replies[0], nil
+}
+
+// Pipeline - sends commands in single round trip, error replies are returned as Error in replies
+func (c *Client) Pipeline(ctx context.Context, cmds ...[]any) ([]any, error) {
+	cn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := cn.roundTrip(ctx, cmds)
+	if err != nil {
+		// connection state is unknown after failed round trip
+		_ = cn.Close()
+
+		return nil, err
+	}
+	c.put(cn)
+
+	return replies, nil
+}
+
+// Tx - runs commands atomically in MULTI/EXEC and returns their replies, error replies of executed
+// commands are joined into returned error as Redis does not roll back the rest of transaction
+func (c *Client) Tx(ctx context.Context, cmds ...[]any) ([]any, error) {
+	replies, err := c.Pipeline(ctx, txCommands(cmds)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return txReplies(replies)
+}
+
+// Watch - optimistic transaction on single connection: keys are watched, fn reads state with do and
+// returns commands which are run in MULTI/EXEC. ErrTxAborted is returned if watched key was changed
+// after WATCH, so caller retries. Nothing is run and nil replies are returned if fn returns no commands
+func (c *Client) Watch(
+	ctx context.Context,
+	keys []any,
+	fn func(do func(args ...any) (any, error)) ([][]any, error),
+) ([]any, error) {
+	cn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := cn.watch(ctx, keys, fn)
+	var replyErr Error
+	if err != nil && !errors.Is(err, ErrTxAborted) && !errors.As(err, &replyErr) {
+		// connection state is unknown after failed round trip
+		_ = cn.Close()
+
+		return nil, err
+	}
+	c.put(cn)
+
+	return replies, err
+}
+
+func (cn *conn) watch(
+	ctx context.Context,
+	keys []any,
+	fn func(do func(args ...any) (any, error)) ([][]any, error),
+) ([]any, error) {
+	if _, err := cn.do(ctx, append([]any{"WATCH"}, keys...)...); err != nil {
+		return nil, err
+	}
+	cmds, err := fn(func(args ...any) (any, error) {
+		return cn.do(ctx, args...)
+	})
+	if err != nil || len(cmds) == 0 {
+		_, unwatchErr := cn.do(ctx, "UNWATCH")
+
+		return nil, errors.Join(err, unwatchErr)
+	}
+	replies, err := cn.roundTrip(ctx, txCommands(cmds))
+	if err != nil {
+		return nil, err
+	}
+
+	return txReplies(replies)
+}
+
+// do - sends command over connection and returns its reply or error reply as Error
+func (cn *conn) do(ctx context.Context, args ...any) (any, error) {
+	replies, err := cn.roundTrip(ctx, [][]any{args})
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := replies[0].(Error); ok {
+		return nil, err
+	}
+
+	return replies[0], nil
+}
+
+// txCommands - commands wrapped in MULTI/EXEC
+func txCommands(cmds [][]any) [][]any {
+	all := make([][]any, 0, len(cmds)+2)
+	all = append(all, []any{"MULTI"})
+	all = append(all, cmds...)
+	all = append(all, []any{"EXEC"})
+
+	return all
+}
+
+// txReplies - replies of commands executed by EXEC of MULTI/EXEC replies
+func txReplies(replies []any) ([]any, error) {
+	// commands rejected while queued abort the transaction
+	for _, reply := range replies[:len(replies)-1] {
+		if err, ok := reply.(Error); ok {
+			return nil, err
+		}
+	}
+	switch exec := replies[len(replies)-1].(type) {
+	case Error:
+		return nil, exec
+	case []any:
+		var err error
+		for _, reply := range exec {
+			if replyErr, ok := reply.(Error); ok {
+				err = errors.Join(err, replyErr)
+			}
+		}
+
+		return exec, err
+	default:
+		return nil, ErrTxAborted
+	}
+}
+
+// Close - closes idle connections
+func (c *Client) Close() error {
+	var err error
+	for {
+		select {
+		case cn := <-c.pool:
+			err = errors.Join(err, cn.Close())
+		default:
+			return err
+		}
+	}
+}
+
+func (c *Client) conn(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+	dialer := net.Dialer{Timeout: c.dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+		writer: bufio.NewWriter(netConn),
+	}
+	var setup [][]any
+	if c.password != "" {
+		setup = append(setup, []any{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []any{"SELECT", c.db})
+	}
+	if len(setup) == 0 {
+		return cn, nil
+	}
+	replies, err := cn.roundTrip(ctx, setup)
+	if err == nil {
+		for _, reply := range replies {
+			if replyErr, ok := reply.(Error); ok {
+				err = replyErr
+			}
+		}
+	}
+	if err != nil {
+		return nil, errors.Join(err, cn.Close())
+	}
+
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		_ = cn.Close()
+	}
+}
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func (cn *conn) roundTrip(ctx context.Context, cmds [][]any) ([]any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	// cancellation interrupts blocked reads and writes
+	stop := context.AfterFunc(ctx, func() {
+		_ = cn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	for _, cmd := range cmds {
+		if err := writeCommand(cn.writer, cmd); err != nil {
+			return nil, err
+		}
+	}
+	if err := cn.writer.Flush(); err != nil {
+		return nil, errors.Join(ctx.Err(), err)
+	}
+	replies := make([]any, len(cmds))
+	for i := range replies {
+		reply, err := ReadReply(cn.reader)
+		if err != nil {
+			return nil, errors.Join(ctx.Err(), err)
+		}
+		replies[i] = reply
+	}
+
+	return replies, nil
+}
+
+func writeCommand(w *bufio.Writer, args []any) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		var value string
+		switch arg := arg.(type) {
+		case string:
+			value = arg
+		case []byte:
+			value = string(arg)
+		case int:
+			value = strconv.Itoa(arg)
+		case int64:
+			value = strconv.FormatInt(arg, 10)
+		case uint64:
+			value = strconv.FormatUint(arg, 10)
+		case float64:
+			value = strconv.FormatFloat(arg, 'f', -1, 64)
+		default:
+			value = fmt.Sprint(arg)
+		}
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadReply - reads single RESP2 reply
+func ReadReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrProtocol
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return Error(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+
+		return string(buf[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		array := make([]any, size)
+		for i := range array {
+			if array[i], err = ReadReply(r); err != nil {
+				return nil, err
+			}
+		}
+
+		return array, nil
+	default:
+		return nil, ErrProtocol
+	}
+}
+
+// Int64 - integer reply
+func Int64(reply any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch reply := reply.(type) {
+	case int64:
+		return reply, nil
+	case string:
+		return strconv.ParseInt(reply, 10, 64)
+	case nil:
+		return 0, ErrNil
+	default:
+		return 0, fmt.Errorf("%w: unexpected reply %T", ErrProtocol, reply)
+	}
+}
+
+// String - bulk or simple string reply
+func String(reply any, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch reply := reply.(type) {
+	case string:
+		return reply, nil
+	case nil:
+		return "", ErrNil
+	default:
+		return "", fmt.Errorf("%w: unexpected reply %T", ErrProtocol, reply)
+	}
+}
+
+// Strings - array reply of bulk strings, null elements are returned as empty strings
+func Strings(reply any, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	array, ok := reply.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected reply %T", ErrProtocol, reply)
+	}
+	values := make([]string, len(array))
+	for i, item := range array {
+		values[i], _ = item.(string)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,130 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmitrorezn/tx-parser/pkg/redis"
+	"github.com/dmitrorezn/tx-parser/pkg/redis/redistest"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T) *redis.Client {
+	server := redistest.NewServer()
+	client := redis.New(server.Addr(), redis.WithPoolSize(2))
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+		server.Close()
+	})
+
+	return client
+}
+
+func TestDo(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		client = setup(t)
+	)
+	_, err := redis.String(client.Do(ctx, "GET", "key"))
+	require.ErrorIs(t, err, redis.ErrNil)
+
+	reply, err := client.Do(ctx, "SET", "key", 42)
+	require.NoError(t, err)
+	require.Equal(t, "OK", reply)
+
+	value, err := redis.Int64(client.Do(ctx, "GET", "key"))
+	require.NoError(t, err)
+	require.Equal(t, int64(42), value)
+
+	_, err = client.Do(ctx, "SADD", "key", "member")
+	var replyErr redis.Error
+	require.ErrorAs(t, err, &replyErr)
+}
+
+func TestPipeline(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		client = setup(t)
+	)
+	replies, err := client.Pipeline(ctx,
+		[]any{"ZADD", "z", 2, "b", 1, "a", 3, "c"},
+		[]any{"ZRANGEBYSCORE", "z", "(1", "+inf", "LIMIT", 0, 1},
+		[]any{"UNKNOWN"},
+	)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), replies[0])
+	require.Equal(t, []any{"b"}, replies[1])
+	require.IsType(t, redis.Error(""), replies[2])
+}
+
+func TestTx(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		client = setup(t)
+	)
+	replies, err := client.Tx(ctx,
+		[]any{"INCR", "seq"},
+		[]any{"SADD", "set", "a", "b"},
+		[]any{"SMISMEMBER", "set", "a", "c"},
+	)
+	require.NoError(t, err)
+	require.Equal(t, []any{int64(1), int64(2), []any{int64(1), int64(0)}}, replies)
+
+	_, err = client.Tx(ctx, []any{"INCR"})
+	require.Error(t, err)
+}
+
+func TestWatch(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		client = setup(t)
+	)
+	// increment - sets seq to the next value, concurrent change of seq is made after it is read if set
+	increment := func(concurrent bool) func(do func(args ...any) (any, error)) ([][]any, error) {
+		return func(do func(args ...any) (any, error)) ([][]any, error) {
+			seq, err := redis.Int64(do("GET", "seq"))
+			if err != nil && !errors.Is(err, redis.ErrNil) {
+				return nil, err
+			}
+			if concurrent {
+				if _, err = client.Do(ctx, "INCR", "seq"); err != nil {
+					return nil, err
+				}
+			}
+
+			return [][]any{{"SET", "seq", seq + 1}}, nil
+		}
+	}
+	replies, err := client.Watch(ctx, []any{"seq"}, increment(false))
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+
+	_, err = client.Watch(ctx, []any{"seq"}, increment(true))
+	require.ErrorIs(t, err, redis.ErrTxAborted)
+	seq, err := redis.Int64(client.Do(ctx, "GET", "seq"))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, seq, "aborted transaction is not applied")
+
+	replies, err = client.Watch(ctx, []any{"seq"}, func(func(args ...any) (any, error)) ([][]any, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.Nil(t, replies)
+
+	// connection is reusable after unwatch
+	replies, err = client.Watch(ctx, []any{"seq"}, increment(false))
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+}
+
+func TestCanceled(t *testing.T) {
+	client := setup(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	_, err := client.Do(ctx, "PING")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,819 @@
+// Package redistest - in-process Redis stand-in implementing commands used by tx-parser storages
+package redistest
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dmitrorezn/tx-parser/pkg/redis"
+)
+
+// Server - Redis stand-in listening on loopback, data is kept in memory of single database
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+
+	mu   sync.Mutex
+	data map[string]any
+}
+
+// NewServer - starts server on random loopback port, panics if listening fails as httptest.NewServer does
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("redistest: failed to listen: %v", err))
+	}
+	s := &Server{
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+		data:     make(map[string]any),
+	}
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close - stops listening, closes open connections and waits for their handlers
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.connsMu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.connsMu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.connsMu.Lock()
+		s.conns[conn] = struct{}{}
+		s.connsMu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+
+			s.connsMu.Lock()
+			delete(s.conns, conn)
+			s.connsMu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	var (
+		reader = bufio.NewReader(conn)
+		writer = bufio.NewWriter(conn)
+		queued [][]string
+		inTx   bool
+		// aborted - command rejected while queued discards transaction
+		aborted bool
+		// watched - values of watched keys at WATCH, transaction is discarded if any of them is changed
+		watched map[string]watchedValue
+	)
+	for {
+		request, err := redis.ReadReply(reader)
+		if err != nil {
+			return
+		}
+		args, err := redis.Strings(request, nil)
+		if err != nil || len(args) == 0 {
+			writeReply(writer, redis.Error("ERR protocol error"))
+		} else {
+			name := strings.ToUpper(args[0])
+			switch {
+			case name == "MULTI" && !inTx:
+				inTx, queued, aborted = true, nil, false
+				writeReply(writer, status("OK"))
+			case name == "WATCH" && !inTx && len(args) > 1:
+				if watched == nil {
+					watched = make(map[string]watchedValue)
+				}
+				s.mu.Lock()
+				for _, key := range args[1:] {
+					watched[key] = s.watch(key)
+				}
+				s.mu.Unlock()
+				writeReply(writer, status("OK"))
+			case name == "UNWATCH":
+				watched = nil
+				writeReply(writer, status("OK"))
+			case name == "EXEC" && inTx && aborted:
+				inTx, watched = false, nil
+				writeReply(writer, redis.Error("EXECABORT Transaction discarded because of previous errors."))
+			case name == "EXEC" && inTx:
+				s.mu.Lock()
+				var replies []any
+				if s.unchanged(watched) {
+					replies = make([]any, len(queued))
+					for i, cmd := range queued {
+						replies[i] = s.exec(cmd)
+					}
+				}
+				s.mu.Unlock()
+				inTx, watched = false, nil
+				if replies == nil {
+					// null reply of transaction discarded by changed watched key
+					writeReply(writer, nil)
+
+					break
+				}
+				writeReply(writer, replies)
+			case name == "EXEC":
+				writeReply(writer, redis.Error("ERR EXEC without MULTI"))
+			case name == "MULTI":
+				writeReply(writer, redis.Error("ERR MULTI calls can not be nested"))
+			case inTx:
+				if err := validate(args); err != nil {
+					aborted = true
+					writeReply(writer, err)
+
+					break
+				}
+				queued = append(queued, args)
+				writeReply(writer, status("QUEUED"))
+			default:
+				s.mu.Lock()
+				reply := s.exec(args)
+				s.mu.Unlock()
+				writeReply(writer, reply)
+			}
+		}
+		// replies of pipelined commands are flushed together
+		if reader.Buffered() == 0 {
+			if err = writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// watchedValue - copy of value of watched key
+type watchedValue struct {
+	value  any
+	exists bool
+}
+
+// watch - copy of value of key, caller must hold mu
+func (s *Server) watch(key string) watchedValue {
+	value, ok := s.data[key]
+	switch typed := value.(type) {
+	case hash:
+		value = maps.Clone(typed)
+	case set:
+		value = maps.Clone(typed)
+	case zset:
+		value = maps.Clone(typed)
+	}
+
+	return watchedValue{value: value, exists: ok}
+}
+
+// unchanged - reports whether watched keys have the same values, caller must hold mu
+func (s *Server) unchanged(watched map[string]watchedValue) bool {
+	for key, at := range watched {
+		value, ok := s.data[key]
+		if ok != at.exists || !reflect.DeepEqual(value, at.value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeReply(w *bufio.Writer, reply any) {
+	switch reply := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case redis.Error:
+		_, _ = fmt.Fprintf(w, "-%s\r\n", reply)
+	case status:
+		_, _ = fmt.Fprintf(w, "+%s\r\n", reply)
+	case string:
+		_, _ = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(reply), reply)
+	case int:
+		_, _ = fmt.Fprintf(w, ":%d\r\n", reply)
+	case []any:
+		_, _ = fmt.Fprintf(w, "*%d\r\n", len(reply))
+		for _, item := range reply {
+			writeReply(w, item)
+		}
+	}
+}
+
+// status - simple string reply
+type status string
+
+var (
+	errWrongType = redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSyntax    = redis.Error("ERR syntax error")
+	errNotInt    = redis.Error("ERR value is not an integer or out of range")
+	errNotFloat  = redis.Error("ERR min or max is not a float")
+)
+
+type (
+	hash    map[string]string
+	set     map[string]struct{}
+	zset    map[string]float64
+	command func(s *Server, args []string) any
+)
+
+var commands = map[string]struct {
+	arity   int
+	command command
+}{
+	"PING":             {1, func(*Server, []string) any { return status("PONG") }},
+	"AUTH":             {-2, func(*Server, []string) any { return status("OK") }},
+	"SELECT":           {2, func(*Server, []string) any { return status("OK") }},
+	"FLUSHALL":         {1, (*Server).flushAll},
+	"GET":              {2, (*Server).get},
+	"SET":              {3, (*Server).set},
+	"DEL":              {-2, (*Server).del},
+	"INCR":             {2, (*Server).incr},
+	"HGET":             {3, (*Server).hget},
+	"HMGET":            {-3, (*Server).hmget},
+	"HSET":             {-4, (*Server).hset},
+	"HSETNX":           {4, (*Server).hsetnx},
+	"HEXISTS":          {3, (*Server).hexists},
+	"HDEL":             {-3, (*Server).hdel},
+	"HINCRBY":          {4, (*Server).hincrBy},
+	"SADD":             {-3, (*Server).sadd},
+	"SREM":             {-3, (*Server).srem},
+	"SISMEMBER":        {3, (*Server).sismember},
+	"SMISMEMBER":       {-3, (*Server).smismember},
+	"SMEMBERS":         {2, (*Server).smembers},
+	"ZADD":             {-4, (*Server).zadd},
+	"ZREM":             {-3, (*Server).zrem},
+	"ZCARD":            {2, (*Server).zcard},
+	"ZRANGEBYSCORE":    {-4, (*Server).zrangeByScore},
+	"ZREVRANGEBYSCORE": {-4, (*Server).zrevrangeByScore},
+	"ZREMRANGEBYSCORE": {4, (*Server).zremRangeByScore},
+	"ZRANGEBYLEX":      {-4, (*Server).zrangeByLex},
+}
+
+// validate - checks that command is known and has valid count of arguments
+func validate(args []string) any {
+	name := strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		return redis.Error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	if cmd.arity > 0 && len(args) != cmd.arity || cmd.arity < 0 && len(args) < -cmd.arity {
+		return redis.Error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+	}
+
+	return nil
+}
+
+// exec - executes command, caller must hold mu
+func (s *Server) exec(args []string) any {
+	if err := validate(args); err != nil {
+		return err
+	}
+
+	return commands[strings.ToUpper(args[0])].command(s, args[1:])
+}
+
+// lookup - value of key of type T, created by create if missing and create is not nil
+func lookup[T any](s *Server, key string, create func() T) (T, bool, error) {
+	value, ok := s.data[key]
+	if !ok {
+		var zero T
+		if create == nil {
+			return zero, false, nil
+		}
+		created := create()
+		s.data[key] = created
+
+		return created, true, nil
+	}
+	typed, ok := value.(T)
+	if !ok {
+		var zero T
+
+		return zero, false, errWrongType
+	}
+
+	return typed, true, nil
+}
+
+// cleanup - removes emptied collection as Redis does
+func (s *Server) cleanup(key string, size int) {
+	if size == 0 {
+		delete(s.data, key)
+	}
+}
+
+func (s *Server) flushAll([]string) any {
+	s.data = make(map[string]any)
+
+	return status("OK")
+}
+
+func (s *Server) get(args []string) any {
+	value, ok, err := lookup[string](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	return value
+}
+
+func (s *Server) set(args []string) any {
+	s.data[args[0]] = args[1]
+
+	return status("OK")
+}
+
+func (s *Server) del(args []string) any {
+	var deleted int
+	for _, key := range args {
+		if _, ok := s.data[key]; ok {
+			delete(s.data, key)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+func (s *Server) incr(args []string) any {
+	value, _, err := lookup(s, args[0], func() string { return "0" })
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return errNotInt
+	}
+	s.data[args[0]] = strconv.Itoa(n + 1)
+
+	return n + 1
+}
+
+func (s *Server) hget(args []string) any {
+	h, _, err := lookup[hash](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	value, ok := h[args[1]]
+	if !ok {
+		return nil
+	}
+
+	return value
+}
+
+func (s *Server) hmget(args []string) any {
+	h, _, err := lookup[hash](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	replies := make([]any, len(args)-1)
+	for i, field := range args[1:] {
+		if value, ok := h[field]; ok {
+			replies[i] = value
+		}
+	}
+
+	return replies
+}
+
+func (s *Server) hset(args []string) any {
+	if len(args)%2 == 0 {
+		return errSyntax
+	}
+	h, _, err := lookup(s, args[0], func() hash { return make(hash) })
+	if err != nil {
+		return err
+	}
+	var added int
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			added++
+		}
+		h[args[i]] = args[i+1]
+	}
+
+	return added
+}
+
+func (s *Server) hexists(args []string) any {
+	h, _, err := lookup[hash](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return 1
+	}
+
+	return 0
+}
+
+func (s *Server) hsetnx(args []string) any {
+	h, _, err := lookup(s, args[0], func() hash { return make(hash) })
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return 0
+	}
+	h[args[1]] = args[2]
+
+	return 1
+}
+
+func (s *Server) hdel(args []string) any {
+	h, _, err := lookup[hash](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	var deleted int
+	for _, field := range args[1:] {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			deleted++
+		}
+	}
+	s.cleanup(args[0], len(h))
+
+	return deleted
+}
+
+func (s *Server) hincrBy(args []string) any {
+	increment, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errNotInt
+	}
+	h, _, err := lookup(s, args[0], func() hash { return make(hash) })
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(cmp.Or(h[args[1]], "0"))
+	if err != nil {
+		return errNotInt
+	}
+	h[args[1]] = strconv.Itoa(n + increment)
+
+	return n + increment
+}
+
+func (s *Server) sadd(args []string) any {
+	members, _, err := lookup(s, args[0], func() set { return make(set) })
+	if err != nil {
+		return err
+	}
+	var added int
+	for _, member := range args[1:] {
+		if _, ok := members[member]; !ok {
+			members[member] = struct{}{}
+			added++
+		}
+	}
+
+	return added
+}
+
+func (s *Server) srem(args []string) any {
+	members, _, err := lookup[set](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	var removed int
+	for _, member := range args[1:] {
+		if _, ok := members[member]; ok {
+			delete(members, member)
+			removed++
+		}
+	}
+	s.cleanup(args[0], len(members))
+
+	return removed
+}
+
+func (s *Server) sismember(args []string) any {
+	members, _, err := lookup[set](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	if _, ok := members[args[1]]; ok {
+		return 1
+	}
+
+	return 0
+}
+
+func (s *Server) smismember(args []string) any {
+	members, _, err := lookup[set](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	replies := make([]any, len(args)-1)
+	for i, member := range args[1:] {
+		replies[i] = 0
+		if _, ok := members[member]; ok {
+			replies[i] = 1
+		}
+	}
+
+	return replies
+}
+
+func (s *Server) smembers(args []string) any {
+	members, _, err := lookup[set](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	replies := make([]any, 0, len(members))
+	for member := range members {
+		replies = append(replies, member)
+	}
+
+	return replies
+}
+
+func (s *Server) zadd(args []string) any {
+	if len(args)%2 == 0 {
+		return errSyntax
+	}
+	z, _, err := lookup(s, args[0], func() zset { return make(zset) })
+	if err != nil {
+		return err
+	}
+	var added int
+	for i := 1; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return redis.Error("ERR value is not a valid float")
+		}
+		if _, ok := z[args[i+1]]; !ok {
+			added++
+		}
+		z[args[i+1]] = score
+	}
+
+	return added
+}
+
+func (s *Server) zrem(args []string) any {
+	z, _, err := lookup[zset](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	var removed int
+	for _, member := range args[1:] {
+		if _, ok := z[member]; ok {
+			delete(z, member)
+			removed++
+		}
+	}
+	s.cleanup(args[0], len(z))
+
+	return removed
+}
+
+func (s *Server) zcard(args []string) any {
+	z, _, err := lookup[zset](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+
+	return len(z)
+}
+
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseBound(arg string) (scoreBound, error) {
+	var bound scoreBound
+	if strings.HasPrefix(arg, "(") {
+		bound.exclusive, arg = true, arg[1:]
+	}
+	var err error
+	switch strings.ToLower(arg) {
+	case "-inf":
+		bound.value = math.Inf(-1)
+	case "+inf", "inf":
+		bound.value = math.Inf(1)
+	default:
+		bound.value, err = strconv.ParseFloat(arg, 64)
+	}
+
+	return bound, err
+}
+
+type scored struct {
+	member string
+	score  float64
+}
+
+// rangeByScore - members of sorted set within bounds ordered by score and then lexicographically
+func rangeByScore(z zset, minArg, maxArg string) ([]scored, error) {
+	lower, err := parseBound(minArg)
+	if err != nil {
+		return nil, errNotFloat
+	}
+	upper, err := parseBound(maxArg)
+	if err != nil {
+		return nil, errNotFloat
+	}
+	var result []scored
+	for member, score := range z {
+		if score < lower.value || lower.exclusive && score == lower.value ||
+			score > upper.value || upper.exclusive && score == upper.value {
+			continue
+		}
+		result = append(result, scored{member: member, score: score})
+	}
+	slices.SortFunc(result, func(a, b scored) int {
+		if a.score != b.score {
+			if a.score < b.score {
+				return -1
+			}
+
+			return 1
+		}
+
+		return strings.Compare(a.member, b.member)
+	})
+
+	return result, nil
+}
+
+func (s *Server) zrangeByScore(args []string) any {
+	return s.scoreRange(args, false)
+}
+
+// zrevrangeByScore - ZREVRANGEBYSCORE key max min, members are ordered from the highest score
+func (s *Server) zrevrangeByScore(args []string) any {
+	return s.scoreRange(args, true)
+}
+
+func (s *Server) scoreRange(args []string, rev bool) any {
+	z, _, err := lookup[zset](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	var (
+		withScores    bool
+		offset, count = 0, -1
+	)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			var offsetErr, countErr error
+			offset, offsetErr = strconv.Atoi(args[i+1])
+			count, countErr = strconv.Atoi(args[i+2])
+			if errors.Join(offsetErr, countErr) != nil {
+				return errNotInt
+			}
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+	minArg, maxArg := args[1], args[2]
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	members, err := rangeByScore(z, minArg, maxArg)
+	if err != nil {
+		return err
+	}
+	if rev {
+		slices.Reverse(members)
+	}
+	members = members[min(max(offset, 0), len(members)):]
+	if count >= 0 {
+		members = members[:min(count, len(members))]
+	}
+	replies := make([]any, 0, len(members))
+	for _, m := range members {
+		replies = append(replies, m.member)
+		if withScores {
+			replies = append(replies, strconv.FormatFloat(m.score, 'f', -1, 64))
+		}
+	}
+
+	return replies
+}
+
+func (s *Server) zremRangeByScore(args []string) any {
+	z, _, err := lookup[zset](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	members, err := rangeByScore(z, args[1], args[2])
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		delete(z, m.member)
+	}
+	s.cleanup(args[0], len(z))
+
+	return len(members)
+}
+
+// lexBound - checks member against ZRANGEBYLEX bound: "-", "+", "[member" or "(member"
+func lexBound(arg string, lower bool) (func(member string) bool, error) {
+	switch {
+	case arg == "-":
+		return func(string) bool { return lower }, nil
+	case arg == "+":
+		return func(string) bool { return !lower }, nil
+	case strings.HasPrefix(arg, "["), strings.HasPrefix(arg, "("):
+		value, inclusive := arg[1:], arg[0] == '['
+
+		return func(member string) bool {
+			c := strings.Compare(member, value)
+			if lower {
+				return c > 0 || inclusive && c == 0
+			}
+
+			return c < 0 || inclusive && c == 0
+		}, nil
+	default:
+		return nil, redis.Error("ERR min or max not valid string range item")
+	}
+}
+
+// zrangeByLex - ZRANGEBYLEX key min max [LIMIT offset count], members are expected to have equal scores
+func (s *Server) zrangeByLex(args []string) any {
+	z, _, err := lookup[zset](s, args[0], nil)
+	if err != nil {
+		return err
+	}
+	lower, err := lexBound(args[1], true)
+	if err != nil {
+		return err
+	}
+	upper, err := lexBound(args[2], false)
+	if err != nil {
+		return err
+	}
+	offset, count := 0, -1
+	if len(args) > 3 {
+		if len(args) != 6 || !strings.EqualFold(args[3], "LIMIT") {
+			return errSyntax
+		}
+		var offsetErr, countErr error
+		offset, offsetErr = strconv.Atoi(args[4])
+		count, countErr = strconv.Atoi(args[5])
+		if errors.Join(offsetErr, countErr) != nil {
+			return errNotInt
+		}
+	}
+	members := make([]string, 0, len(z))
+	for member := range z {
+		if lower(member) && upper(member) {
+			members = append(members, member)
+		}
+	}
+	slices.Sort(members)
+	members = members[min(max(offset, 0), len(members)):]
+	if count >= 0 {
+		members = members[:min(count, len(members))]
+	}
+	replies := make([]any, 0, len(members))
+	for _, member := range members {
+		replies = append(replies, member)
+	}
+
+	return replies
+}
@@ -0,0 +1,119 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEcho(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, err := Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	tests := map[string]struct {
+		messageType MessageType
+		message     []byte
+	}{
+		"1. Success: short text":      {messageType: TextMessage, message: []byte(`{"method":"ping"}`)},
+		"2. Success: 16 bit length":   {messageType: BinaryMessage, message: bytes.Repeat([]byte{1}, 1<<10)},
+		"3. Success: 64 bit length":   {messageType: TextMessage, message: bytes.Repeat([]byte("a"), 1<<17)},
+		"4. Success: empty message":   {messageType: TextMessage, message: []byte{}},
+		"5. Success: after ping msgs": {messageType: TextMessage, message: []byte("pong")},
+	}
+	for name, testCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, conn.Ping([]byte("ping")))
+			require.NoError(t, conn.WriteMessage(testCase.messageType, testCase.message))
+
+			messageType, message, err := conn.ReadMessage()
+			require.NoError(t, err)
+			require.Equal(t, testCase.messageType, messageType)
+			require.Equal(t, testCase.message, message)
+		})
+	}
+}
+
+func TestUpgradeRequired(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := Upgrade(w, r)
+		require.ErrorIs(t, err, ErrBadHandshake)
+	}))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestUpgradeOrigin(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, WithAllowedOrigins("https://app.example.com"))
+		if err != nil {
+			return
+		}
+		_ = conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	addr := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	tests := map[string]struct {
+		origin string
+		err    error
+	}{
+		"1. Success: without origin":     {},
+		"2. Success: same origin":        {origin: srv.URL},
+		"3. Success: allowed origin":     {origin: "https://APP.example.com"},
+		"4. Fail: cross origin":          {origin: "https://evil.example.com", err: ErrBadHandshake},
+		"5. Fail: opaque origin":         {origin: "null", err: ErrBadHandshake},
+		"6. Fail: other port of host":    {origin: "http://127.0.0.1:1", err: ErrBadHandshake},
+		"7. Fail: allowed origin scheme": {origin: "http://app.example.com", err: ErrBadHandshake},
+	}
+	for name, testCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			header := http.Header{}
+			if testCase.origin != "" {
+				header.Set("Origin", testCase.origin)
+			}
+			conn, err := Dial(ctx, addr, header)
+			if testCase.err != nil {
+				require.ErrorIs(t, err, testCase.err)
+				require.ErrorContains(t, err, "status 403")
+
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, conn.Close())
+		})
+	}
+}
@@ -233,7 +233,7 @@ func TestGetTransactions(t *testing.T) {
 					testCase.txs = txs
 				}
 			}
-			tsx, err := svcClient.GetTransactions(ctx, testCase.address)
+			tsx, _, err := svcClient.GetTransactions(ctx, testCase.address, client.TxOptions{})
 			require.ErrorIs(t, err, testCase.expectedErr)
 			require.Equal(t, testCase.txs, tsx)
 		})